@@ -5,14 +5,17 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/emrzvv/fl-compiler/internal/classes"
 	"github.com/emrzvv/fl-compiler/internal/compiler"
 	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/prelude"
 )
 
 func run() error {
 	inputFile := flag.String("in", "", "Path to input program file")
 	outputFile := flag.String("out", "./out", "Path to output binary file")
 	verbose := flag.Bool("v", false, "Verbose mode")
+	noPrelude := flag.Bool("noprelude", false, "Do not import the prelude")
 	flag.Parse()
 
 	if *inputFile == "" || *outputFile == "" {
@@ -23,6 +26,16 @@ func run() error {
 	if err != nil {
 		return err
 	}
+	if !*noPrelude {
+		program, err = prelude.Import(program)
+		if err != nil {
+			return err
+		}
+	}
+	program, err = classes.Resolve(program)
+	if err != nil {
+		return err
+	}
 	compiler := compiler.NewCompiler()
 	err = compiler.Compile(program)
 	if err != nil {
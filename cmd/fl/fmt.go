@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+)
+
+func runFmt(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "Write result to source files instead of stdout")
+	check := flags.Bool("check", false, "List files whose formatting differs and fail if there are any")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		formatted, err := formatSource("<stdin>", string(source))
+		if err != nil {
+			return err
+		}
+		if *check {
+			if formatted != string(source) {
+				return fmt.Errorf("<stdin> is not formatted")
+			}
+			return nil
+		}
+		_, err = os.Stdout.WriteString(formatted)
+		return err
+	}
+
+	unformatted := []string{}
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		formatted, err := formatSource(path, string(source))
+		if err != nil {
+			return err
+		}
+		switch {
+		case *check:
+			if formatted != string(source) {
+				fmt.Println(path)
+				unformatted = append(unformatted, path)
+			}
+		case *write:
+			if formatted != string(source) {
+				err = os.WriteFile(path, []byte(formatted), 0644)
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			_, err = os.Stdout.WriteString(formatted)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(unformatted) > 0 {
+		return fmt.Errorf("files are not formatted: %s", strings.Join(unformatted, ", "))
+	}
+	return nil
+}
+
+func formatSource(path string, source string) (string, error) {
+	program, err := ast.ParseString(path, source)
+	if err != nil {
+		return "", err
+	}
+	return ast.Format(program), nil
+}
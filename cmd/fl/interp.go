@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/emrzvv/fl-compiler/internal/classes"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/interp"
+	"github.com/emrzvv/fl-compiler/internal/prelude"
+)
+
+func runInterp(args []string) error {
+	flags := flag.NewFlagSet("interp", flag.ContinueOnError)
+	noPrelude := flags.Bool("noprelude", false, "Do not import the prelude")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one source file")
+	}
+
+	program, err := ast.ParseFromFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !*noPrelude {
+		program, err = prelude.Import(program)
+		if err != nil {
+			return err
+		}
+	}
+	program, err = classes.Resolve(program)
+	if err != nil {
+		return err
+	}
+	err = ast.CheckSemantics(
+		program,
+		make(map[ast.TypeDefKey]interface{}),
+		make(map[ast.ConstructorDefKey]interface{}),
+		make(map[ast.FunctionDefKey]interface{}),
+		make(map[ast.VariableDefKey]interface{}),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = interp.NewInterpreter().Run(program)
+	return err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+const usage = `usage: fl <command> [arguments]
+
+commands:
+  fmt       format source files
+  interp    run a source file without compiling it
+  run       compile a source file and run it on the virtual machine
+  test      run .fl programs and compare them with their .out and .err files`
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("command is absent\n%s", usage)
+	}
+	switch args[0] {
+	case "fmt":
+		return runFmt(args[1:])
+	case "interp":
+		return runInterp(args[1:])
+	case "run":
+		return runRun(args[1:])
+	case "test":
+		return runTest(args[1:])
+	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+}
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
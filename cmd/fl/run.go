@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/emrzvv/fl-compiler/internal/classes"
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/jsonvalue"
+	"github.com/emrzvv/fl-compiler/internal/prelude"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+	"github.com/emrzvv/fl-compiler/internal/vm"
+)
+
+func runRun(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	entry := flags.String("entry", "", "Call this function instead of running the top-level calls")
+	argsJSON := []string{}
+	flags.Func("arg-json", "JSON value of the next argument of the entry function, repeat for every argument", func(value string) error {
+		argsJSON = append(argsJSON, value)
+		return nil
+	})
+	resultJSON := flags.Bool("result-json", false, "Print the resulting value as JSON")
+	noPrelude := flags.Bool("noprelude", false, "Do not import the prelude")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one source file")
+	}
+	if *entry == "" && len(argsJSON) > 0 {
+		return fmt.Errorf("arguments need an entry function")
+	}
+
+	program, err := ast.ParseFromFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !*noPrelude {
+		program, err = prelude.Import(program)
+		if err != nil {
+			return err
+		}
+	}
+	// the entry is looked up in the program as written, where functions
+	// with constraints do not take their dictionaries yet
+	resolved, err := classes.Resolve(program)
+	if err != nil {
+		return err
+	}
+	err = ast.CheckSemantics(
+		resolved,
+		make(map[ast.TypeDefKey]interface{}),
+		make(map[ast.ConstructorDefKey]interface{}),
+		make(map[ast.FunctionDefKey]interface{}),
+		make(map[ast.VariableDefKey]interface{}),
+	)
+	if err != nil {
+		return err
+	}
+	c := compiler.NewCompiler()
+	err = c.Compile(resolved)
+	if err != nil {
+		return err
+	}
+	machine := vm.NewFVM(c.Bytecode())
+
+	var result object.Object
+	if *entry == "" {
+		err = machine.Run()
+		if err != nil {
+			return err
+		}
+		result = machine.StackTop()
+	} else {
+		result, err = callEntry(machine, program, *entry, argsJSON)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case result == nil:
+	case *resultJSON:
+		data, err := jsonvalue.Encode(result)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case *entry != "":
+		fmt.Println(result)
+	}
+	return nil
+}
+
+// callEntry decodes the arguments for the signature of the function called
+// name and calls it.
+func callEntry(machine *vm.FVM, program *ast.Program, name string, argsJSON []string) (object.Object, error) {
+	var signature *ast.FunSignature
+	for _, d := range program.Definitions {
+		if d.FunDef != nil && d.FunDef.Signature.Name == name {
+			signature = d.FunDef.Signature
+		}
+	}
+	if signature == nil {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	if len(signature.Constraints) > 0 {
+		return nil, fmt.Errorf("function %s has constraints and cannot be an entry", name)
+	}
+	if len(argsJSON) != len(signature.Parameters) {
+		return nil, fmt.Errorf("function %s takes %d arguments, got %d", name, len(signature.Parameters), len(argsJSON))
+	}
+	types := jsonvalue.NewTypes(program)
+	args := make([]object.Object, len(argsJSON))
+	for i, data := range argsJSON {
+		arg, err := types.Decode([]byte(data), signature.Parameters[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of %s: %w", i, name, err)
+		}
+		args[i] = arg
+	}
+	return machine.Call(name, args...)
+}
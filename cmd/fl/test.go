@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/emrzvv/fl-compiler/internal/fltest"
+	"github.com/emrzvv/fl-compiler/internal/golden"
+)
+
+func runTest(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	update := flags.Bool("update", false, "Write the results to the expectation files instead of comparing")
+	parallel := flags.Int("parallel", 0, "Number of programs to run at once, one per CPU by default")
+	verbose := flags.Bool("v", false, "List passed tests too")
+	noPrelude := flags.Bool("noprelude", false, "Do not import the prelude")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	programs, err := golden.Discover(paths, *update)
+	if err != nil {
+		return err
+	}
+	failures, err := golden.CheckAll(programs, *update, *parallel, !*noPrelude)
+	if err != nil {
+		return err
+	}
+	for _, f := range failures {
+		fmt.Printf("FAIL %s\n%s\n", f.Path, f.Diff)
+	}
+
+	// test definitions are run in every program, with or without
+	// expectation files
+	sources, err := golden.Discover(paths, true)
+	if err != nil {
+		return err
+	}
+	tests, failedTests := 0, 0
+	for _, path := range sources {
+		results, err := fltest.Run(path, !*noPrelude)
+		if err != nil {
+			// programs that do not compile are reported by the golden files
+			continue
+		}
+		tests += len(results)
+		failedTests += fltest.Report(os.Stdout, results, *verbose)
+	}
+
+	if len(failures) > 0 || failedTests > 0 {
+		return fmt.Errorf("%d of %d programs and %d of %d tests failed",
+			len(failures), len(programs), failedTests, tests)
+	}
+	if *update {
+		fmt.Printf("updated %d programs, ok %d tests\n", len(programs), tests)
+		return nil
+	}
+	fmt.Printf("ok %d programs, %d tests\n", len(programs), tests)
+	return nil
+}
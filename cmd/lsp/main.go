@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/emrzvv/fl-compiler/internal/lsp"
+)
+
+func run() error {
+	server := lsp.NewServer(os.Stdin, os.Stdout)
+	return server.Run()
+}
+
+func main() {
+	err := run()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -12,6 +13,10 @@ import (
 func run() error {
 	inputFile := flag.String("in", "", "Path to input binary file")
 	verbose := flag.Bool("v", false, "Verbose mode")
+	overflow := flag.String("overflow", "promote", "Int overflow behaviour: promote or error")
+	maxSteps := flag.Int("max-steps", 0, "Stop after that many instructions, 0 means no limit")
+	maxAllocations := flag.Int("max-allocations", 0, "Stop after allocating that many objects in total, 0 means no limit")
+	timeout := flag.Duration("timeout", 0, "Stop after that much time, 0 means no limit")
 	flag.Parse()
 
 	if *inputFile == "" {
@@ -21,11 +26,34 @@ func run() error {
 	if err != nil {
 		return err
 	}
+	err = vm.Verify(bytecode)
+	if err != nil {
+		return fmt.Errorf("invalid bytecode: %w", err)
+	}
 	if *verbose {
 		fmt.Printf("[COMPILED DATA]\n=========\n%v+\n=========\n", bytecode)
 	}
-	fvm := vm.NewFVM(bytecode)
-	err = fvm.Run()
+	var overflowMode vm.OverflowMode
+	switch *overflow {
+	case "promote":
+		overflowMode = vm.OverflowPromote
+	case "error":
+		overflowMode = vm.OverflowError
+	default:
+		return fmt.Errorf("unknown overflow mode %q", *overflow)
+	}
+	fvm := vm.NewFVM(bytecode,
+		vm.WithIntegerOverflow(overflowMode),
+		vm.WithStepLimit(*maxSteps),
+		vm.WithAllocationLimit(*maxAllocations),
+	)
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	err = fvm.RunContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,862 @@
+// Package classes resolves type classes. Resolve checks the class and
+// instance definitions of a program and compiles them away by dictionary
+// passing, so the compiler and the interpreter only see ordinary functions:
+//
+//   - an instance becomes a function per method, C.m.T for the method m of
+//     the class C on the type T;
+//   - a dictionary is a tuple (, (, methods...) (, contexts...)) of the
+//     method functions of an instance and the dictionaries its constraints
+//     need;
+//   - a function with constraints, fun (f ...) -> ... where [C a], takes a
+//     dictionary for every constraint before its own arguments, and so does
+//     every method function;
+//   - a call of a method is resolved at compile time from the types of its
+//     arguments: to the method function of the instance for their type, or
+//     to the dispatcher C.m, which calls the method from a dictionary the
+//     function got for a type variable.
+//
+// Types are only followed as far as instances need: the type of an
+// expression comes from the signatures, the constructors and the patterns
+// that bound its variables. The only check is that the arguments of a call
+// do not give one type variable of the signature two different types, as
+// Int and [List Int], since no instance could be chosen for it.
+//
+// The methods of a class whose methods are all named like builtins, as
+// show, eq and compare, default to the builtins: a type without an instance
+// and an argument of an unknown type use the builtin.
+package classes
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+)
+
+type constructor struct {
+	typeDef *ast.TypeDef
+	def     *ast.Constructor
+}
+
+type class struct {
+	def *ast.ClassDef
+	// builtin is set when every method is named like a builtin, which the
+	// class falls back to
+	builtin bool
+	// used are the generated functions of the class that are called
+	used map[string]bool
+}
+
+type instanceKey struct {
+	class string
+	head  string
+}
+
+type dictionaryKey struct {
+	class    string
+	variable string
+}
+
+type resolver struct {
+	types        map[string]*ast.TypeDef
+	constructors map[string][]constructor
+	fields       map[string][]constructor
+	functions    map[string]*ast.FunSignature
+	classes      map[string]*class
+	methods      map[string]*class
+	instances    map[instanceKey]*ast.InstanceDef
+}
+
+// scope is what the resolver knows inside a rule or a top-level expression.
+type scope struct {
+	// variables are the types of the pattern variables
+	variables map[string]*typ
+	// dictionaries are the variables holding the dictionaries of the
+	// constraints of the definition
+	dictionaries map[dictionaryKey]string
+}
+
+func errorf(pos lexer.Position, format string, args ...any) error {
+	return &ast.SemanticError{Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// Resolve returns program with its classes and instances compiled to
+// functions. The program itself is not changed.
+func Resolve(program *ast.Program) (*ast.Program, error) {
+	r := &resolver{
+		types:        make(map[string]*ast.TypeDef),
+		constructors: make(map[string][]constructor),
+		fields:       make(map[string][]constructor),
+		functions:    make(map[string]*ast.FunSignature),
+		classes:      make(map[string]*class),
+		methods:      make(map[string]*class),
+		instances:    make(map[instanceKey]*ast.InstanceDef),
+	}
+	err := r.collect(program)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make([][]*ast.Definition, len(program.Definitions))
+	for i, d := range program.Definitions {
+		switch {
+		case d.FunDef != nil:
+			f, err := r.function(d.FunDef)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = []*ast.Definition{{Pos: d.Pos, EndPos: d.EndPos, FunDef: f}}
+		case d.FunCall != nil:
+			e, _, err := r.expression(&ast.Expression{Pos: d.FunCall.Pos, FunCall: d.FunCall}, newScope())
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = []*ast.Definition{{Pos: d.Pos, EndPos: d.EndPos, FunCall: e.FunCall}}
+		case d.Test != nil:
+			e, _, err := r.expression(d.Test.Expression, newScope())
+			if err != nil {
+				return nil, err
+			}
+			test := &ast.TestDef{Pos: d.Test.Pos, Name: d.Test.Name, Expression: e}
+			resolved[i] = []*ast.Definition{{Pos: d.Pos, EndPos: d.EndPos, Test: test}}
+		case d.Instance != nil:
+			functions, err := r.instance(d.Instance)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range functions {
+				resolved[i] = append(resolved[i], &ast.Definition{Pos: d.Pos, EndPos: d.EndPos, FunDef: f})
+			}
+		case d.Class == nil:
+			resolved[i] = []*ast.Definition{d}
+		}
+	}
+	// the functions of a class are generated once all calls are known
+	for i, d := range program.Definitions {
+		if d.Class == nil {
+			continue
+		}
+		for _, f := range r.classFunctions(r.classes[d.Class.Name]) {
+			resolved[i] = append(resolved[i], &ast.Definition{Pos: d.Pos, EndPos: d.EndPos, FunDef: f})
+		}
+	}
+
+	result := &ast.Program{Pos: program.Pos, Comments: program.Comments}
+	for _, definitions := range resolved {
+		result.Definitions = append(result.Definitions, definitions...)
+	}
+	return result, nil
+}
+
+func newScope() *scope {
+	return &scope{variables: make(map[string]*typ), dictionaries: make(map[dictionaryKey]string)}
+}
+
+// collect records the definitions of the program and checks the classes
+// and instances.
+func (r *resolver) collect(program *ast.Program) error {
+	for _, d := range program.Definitions {
+		switch {
+		case d.TypeDef != nil:
+			r.types[d.TypeDef.TypeName.Name] = d.TypeDef
+			for _, alt := range d.TypeDef.TypeAlternatives {
+				c := constructor{typeDef: d.TypeDef, def: alt.Constructor}
+				r.constructors[c.def.Name] = append(r.constructors[c.def.Name], c)
+				for _, field := range c.def.FieldNames() {
+					r.fields[field] = append(r.fields[field], c)
+				}
+			}
+		case d.FunDef != nil:
+			r.functions[d.FunDef.Signature.Name] = d.FunDef.Signature
+		}
+	}
+	for _, d := range program.Definitions {
+		if d.Class == nil {
+			continue
+		}
+		err := r.declareClass(d.Class)
+		if err != nil {
+			return err
+		}
+	}
+	for _, d := range program.Definitions {
+		switch {
+		case d.Instance != nil:
+			err := r.declareInstance(d.Instance)
+			if err != nil {
+				return err
+			}
+		case d.FunDef != nil:
+			signature := d.FunDef.Signature
+			params := []*typ{}
+			for _, p := range signature.Parameters {
+				params = append(params, r.common(p))
+			}
+			err := r.checkConstraints(signature.Constraints, params, "a type variable of "+signature.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *resolver) declareClass(def *ast.ClassDef) error {
+	if _, ok := r.classes[def.Name]; ok {
+		return errorf(def.Pos, "class %v already declared", def.Name)
+	}
+	c := &class{def: def, builtin: true, used: make(map[string]bool)}
+	for _, m := range def.Methods {
+		if _, ok := r.methods[m.Name]; ok {
+			return errorf(m.Pos, "method %v already declared", m.Name)
+		}
+		if _, ok := r.functions[m.Name]; ok {
+			return errorf(m.Pos, "function %v already declared", m.Name)
+		}
+		mentioned := false
+		for _, p := range m.Parameters {
+			subst := map[string]*typ{}
+			variables(r.common(p), subst)
+			_, ok := subst[def.Variable]
+			mentioned = mentioned || ok
+		}
+		if !mentioned {
+			return errorf(m.Pos, "method %v does not mention %v in its parameters", m.Name, def.Variable)
+		}
+		c.builtin = c.builtin && ast.IsBuiltin(m.Name)
+		r.methods[m.Name] = c
+	}
+	r.classes[def.Name] = c
+	return nil
+}
+
+func (r *resolver) declareInstance(def *ast.InstanceDef) error {
+	c, ok := r.classes[def.Class]
+	if !ok {
+		return errorf(def.Pos, "unknown class %v", def.Class)
+	}
+	t := r.parameter(def.Type)
+	head := def.Head()
+	switch {
+	case t == nil || t.name == tupleName:
+		return errorf(def.Type.Pos, "instances are declared for builtin and defined types, not for %v", def.Type)
+	case t.variable != "":
+		return errorf(def.Type.Pos, "unknown type %v", head)
+	}
+	seen := map[string]bool{}
+	for _, arg := range t.args {
+		if arg == nil || arg.variable == "" || len(arg.args) > 0 || seen[arg.variable] {
+			return errorf(def.Type.Pos, "the parameters of %v have to be distinct type variables", def.Type)
+		}
+		seen[arg.variable] = true
+	}
+	key := instanceKey{class: def.Class, head: head}
+	if _, ok := r.instances[key]; ok {
+		return errorf(def.Pos, "instance [%v %v] already declared", def.Class, head)
+	}
+	err := r.checkConstraints(def.Constraints, []*typ{t}, "a variable of "+def.Type.String())
+	if err != nil {
+		return err
+	}
+
+	defined := map[string]bool{}
+	for _, rule := range def.Rules {
+		m := c.def.Method(rule.Pattern.FunName)
+		if m == nil {
+			return errorf(rule.Pattern.Pos, "%v is not a method of class %v", rule.Pattern.FunName, def.Class)
+		}
+		if len(rule.Pattern.Arguments) != len(m.Parameters) {
+			return errorf(
+				rule.Pattern.Pos,
+				"method %v expects %d arguments, rule has %d",
+				m.Name,
+				len(m.Parameters),
+				len(rule.Pattern.Arguments),
+			)
+		}
+		defined[m.Name] = true
+	}
+	for _, m := range c.def.Methods {
+		if !defined[m.Name] {
+			return errorf(def.Pos, "instance [%v %v] does not define %v", def.Class, head, m.Name)
+		}
+	}
+	r.instances[key] = def
+	return nil
+}
+
+// checkConstraints checks that constraints name classes and variables of
+// the types they constrain.
+func (r *resolver) checkConstraints(constraints []*ast.Constraint, types []*typ, what string) error {
+	known := map[string]*typ{}
+	for _, t := range types {
+		variables(t, known)
+	}
+	for _, c := range constraints {
+		if _, ok := r.classes[c.Class]; !ok {
+			return errorf(c.Pos, "unknown class %v", c.Class)
+		}
+		if _, ok := known[c.Variable]; !ok {
+			return errorf(c.Pos, "constraint %v refers to %v, which is not %s", c, c.Variable, what)
+		}
+	}
+	return nil
+}
+
+// function resolves the rules of a function. A function with constraints
+// gets a dictionary parameter for each of them.
+func (r *resolver) function(def *ast.FunDef) (*ast.FunDef, error) {
+	signature := def.Signature
+	params := []*typ{}
+	for _, p := range signature.Parameters {
+		params = append(params, r.common(p))
+	}
+	dictionaries := map[dictionaryKey]string{}
+	hidden := []*ast.PatternArgument{}
+	types := []*ast.TypeCommon{}
+	for _, c := range signature.Constraints {
+		name := dictionaryVariable(c.Class, c.Variable)
+		dictionaries[dictionaryKey{class: c.Class, variable: c.Variable}] = name
+		hidden = append(hidden, &ast.PatternArgument{Pos: c.Pos, Variable: name})
+		types = append(types, dictionaryType(c.Class, &ast.TypeParameter{TypeGeneral: &ast.TypeGeneral{Name: c.Variable}}))
+	}
+
+	result := &ast.FunDef{
+		Pos:    def.Pos,
+		EndPos: def.EndPos,
+		Signature: &ast.FunSignature{
+			Pos:        signature.Pos,
+			Name:       signature.Name,
+			Parameters: append(types, signature.Parameters...),
+			ReturnType: signature.ReturnType,
+		},
+		Comments: def.Comments,
+	}
+	for _, rule := range def.Rules {
+		resolved, err := r.rule(rule, signature.Name, params, hidden, dictionaries)
+		if err != nil {
+			return nil, err
+		}
+		result.Rules = append(result.Rules, resolved)
+	}
+	return result, nil
+}
+
+// instance turns an instance into a function for each method of its class.
+// The functions take the dictionary of the instance first, which holds the
+// dictionaries of its constraints.
+func (r *resolver) instance(def *ast.InstanceDef) ([]*ast.FunDef, error) {
+	c := r.classes[def.Class]
+	instanceType := r.parameter(def.Type)
+	dictionaries := map[dictionaryKey]string{}
+	contexts := []*ast.PatternArgument{}
+	for _, constraint := range def.Constraints {
+		name := dictionaryVariable(constraint.Class, constraint.Variable)
+		dictionaries[dictionaryKey{class: constraint.Class, variable: constraint.Variable}] = name
+		contexts = append(contexts, &ast.PatternArgument{Pos: constraint.Pos, Variable: name})
+	}
+
+	functions := []*ast.FunDef{}
+	for _, m := range c.def.Methods {
+		subst := map[string]*typ{c.def.Variable: instanceType}
+		for _, p := range m.Parameters {
+			variables(r.common(p), subst)
+		}
+		params := []*typ{}
+		for _, p := range m.Parameters {
+			params = append(params, substitute(r.common(p), subst))
+		}
+		name := methodFunction(c.def.Name, m.Name, def.Head())
+		f := &ast.FunDef{
+			Pos:    def.Pos,
+			EndPos: def.EndPos,
+			Signature: &ast.FunSignature{
+				Pos:        def.Pos,
+				Name:       name,
+				Parameters: append([]*ast.TypeCommon{dictionaryType(c.def.Name, def.Type)}, m.Parameters...),
+				ReturnType: m.ReturnType,
+			},
+		}
+		for _, rule := range def.Rules {
+			if rule.Pattern.FunName != m.Name {
+				continue
+			}
+			dictionary := &ast.PatternArgument{Pos: rule.Pattern.Pos, Tuple: &ast.TuplePattern{
+				Pos: rule.Pattern.Pos,
+				Elements: []*ast.PatternArgument{
+					{Pos: rule.Pattern.Pos, Variable: ".methods"},
+					{Pos: rule.Pattern.Pos, Tuple: &ast.TuplePattern{Pos: rule.Pattern.Pos, Elements: contexts}},
+				},
+			}}
+			resolved, err := r.rule(rule, name, params, []*ast.PatternArgument{dictionary}, dictionaries)
+			if err != nil {
+				return nil, err
+			}
+			f.Rules = append(f.Rules, resolved)
+		}
+		functions = append(functions, f)
+	}
+	return functions, nil
+}
+
+// classFunctions generates the functions of a class that calls refer to:
+// dispatchers, which call a method from a dictionary, and the methods of
+// the builtin fallback.
+func (r *resolver) classFunctions(c *class) []*ast.FunDef {
+	functions := []*ast.FunDef{}
+	pos := c.def.Pos
+	variable := func(name string) *ast.Expression {
+		return &ast.Expression{Pos: pos, Variable: name}
+	}
+	for i, m := range c.def.Methods {
+		params := []*ast.PatternArgument{}
+		args := []*ast.Expression{}
+		for j := range m.Parameters {
+			name := ".x" + strconv.Itoa(j)
+			params = append(params, &ast.PatternArgument{Pos: pos, Variable: name})
+			args = append(args, variable(name))
+		}
+		signature := func(name string) *ast.FunSignature {
+			dictionary := dictionaryType(c.def.Name, &ast.TypeParameter{TypeGeneral: &ast.TypeGeneral{Name: c.def.Variable}})
+			return &ast.FunSignature{
+				Pos:        m.Pos,
+				Name:       name,
+				Parameters: append([]*ast.TypeCommon{dictionary}, m.Parameters...),
+				ReturnType: m.ReturnType,
+			}
+		}
+
+		name := dispatcher(c.def.Name, m.Name)
+		if c.used[name] {
+			// (C.m (, (, .m0 .m1) .contexts) x) -> (.mi (, (, .m0 .m1) .contexts) x)
+			methods := []*ast.PatternArgument{}
+			methodValues := []*ast.Expression{}
+			for j := range c.def.Methods {
+				name := ".m" + strconv.Itoa(j)
+				methods = append(methods, &ast.PatternArgument{Pos: pos, Variable: name})
+				methodValues = append(methodValues, variable(name))
+			}
+			dictionary := &ast.PatternArgument{Pos: pos, Tuple: &ast.TuplePattern{Pos: pos, Elements: []*ast.PatternArgument{
+				{Pos: pos, Tuple: &ast.TuplePattern{Pos: pos, Elements: methods}},
+				{Pos: pos, Variable: ".contexts"},
+			}}}
+			dictionaryValue := tuple(pos, tuple(pos, methodValues...), variable(".contexts"))
+			functions = append(functions, &ast.FunDef{
+				Pos:       pos,
+				Signature: signature(name),
+				Rules: []*ast.FunRule{{
+					Pos:     pos,
+					Pattern: &ast.Pattern{Pos: pos, FunName: name, Arguments: append([]*ast.PatternArgument{dictionary}, params...)},
+					Expression: &ast.Expression{Pos: pos, FunCall: &ast.FunCall{
+						Pos:       pos,
+						Name:      ".m" + strconv.Itoa(i),
+						Arguments: append([]*ast.Expression{dictionaryValue}, args...),
+					}},
+				}},
+			})
+		}
+
+		name = methodFunction(c.def.Name, m.Name, builtinHead)
+		if c.used[name] {
+			// (C.m._ .dictionary x) -> (m x), where m is the builtin
+			functions = append(functions, &ast.FunDef{
+				Pos:       pos,
+				Signature: signature(name),
+				Rules: []*ast.FunRule{{
+					Pos: pos,
+					Pattern: &ast.Pattern{Pos: pos, FunName: name, Arguments: append(
+						[]*ast.PatternArgument{{Pos: pos, Variable: ".dictionary"}},
+						params...,
+					)},
+					Expression: &ast.Expression{Pos: pos, FunCall: &ast.FunCall{Pos: pos, Name: m.Name, Arguments: args}},
+				}},
+			})
+		}
+	}
+	return functions
+}
+
+// builtinHead stands for the type in the names of the methods of the
+// builtin fallback; type names cannot start with an underscore.
+const builtinHead = "_"
+
+func dispatcher(class, method string) string {
+	return class + "." + method
+}
+
+func methodFunction(class, method, head string) string {
+	return class + "." + method + "." + head
+}
+
+func dictionaryVariable(class, variable string) string {
+	return class + "." + variable
+}
+
+// dictionaryType is the type written for a dictionary parameter, [C t].
+// Types of parameters are not checked, it only documents the signature.
+func dictionaryType(class string, t *ast.TypeParameter) *ast.TypeCommon {
+	return &ast.TypeCommon{
+		TypeName:       &ast.TypeName{Name: class},
+		TypeParameters: []*ast.TypeParameter{t},
+	}
+}
+
+func tuple(pos lexer.Position, elements ...*ast.Expression) *ast.Expression {
+	return &ast.Expression{Pos: pos, Tuple: &ast.TupleExpression{Pos: pos, Elements: elements}}
+}
+
+// rule resolves a rule of the function name, whose parameters have the
+// types params. hidden are the dictionary parameters added in front of its
+// own ones.
+func (r *resolver) rule(
+	rule *ast.FunRule,
+	name string,
+	params []*typ,
+	hidden []*ast.PatternArgument,
+	dictionaries map[dictionaryKey]string,
+) (*ast.FunRule, error) {
+	s := newScope()
+	s.dictionaries = dictionaries
+	for i, arg := range rule.Pattern.Arguments {
+		var t *typ
+		if i < len(params) {
+			t = params[i]
+		}
+		r.bind(arg, t, s)
+	}
+	for _, arg := range hidden {
+		r.bind(arg, nil, s)
+	}
+	expression, _, err := r.expression(rule.Expression, s)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.FunRule{
+		Pos: rule.Pos,
+		Pattern: &ast.Pattern{
+			Pos:       rule.Pattern.Pos,
+			FunName:   name,
+			Arguments: append(slices.Clone(hidden), rule.Pattern.Arguments...),
+		},
+		Expression: expression,
+		Comments:   rule.Comments,
+	}, nil
+}
+
+// bind records the types of the variables of a pattern matched against a
+// value of type t.
+func (r *resolver) bind(p *ast.PatternArgument, t *typ, s *scope) {
+	switch {
+	case p.Variable != "":
+		s.variables[p.Variable] = t
+		return
+	case p.Const != nil:
+		return
+	case p.Tuple != nil:
+		for i, element := range p.Tuple.Elements {
+			var elementType *typ
+			if t != nil && t.name == tupleName && len(t.args) == len(p.Tuple.Elements) {
+				elementType = t.args[i]
+			}
+			r.bind(element, elementType, s)
+		}
+		return
+	}
+	arity := len(p.Arguments)
+	if p.IsRecord() {
+		arity = -1
+	}
+	c, ok := r.constructor(&p.Name, arity)
+	if !ok {
+		for _, arg := range p.Arguments {
+			r.bind(arg, nil, s)
+		}
+		return
+	}
+	subst := map[string]*typ{}
+	if t != nil && t.name == c.typeDef.TypeName.Name {
+		for i, general := range c.typeDef.TypeGeneral {
+			if i < len(t.args) {
+				subst[general.Name] = t.args[i]
+			}
+		}
+	}
+	if p.IsRecord() {
+		for _, field := range p.Fields {
+			for i, name := range c.def.FieldNames() {
+				if name == field {
+					s.variables[field] = substitute(r.constructorParameter(c.def.Parameters[i], c.typeDef), subst)
+				}
+			}
+		}
+		return
+	}
+	for i, arg := range p.Arguments {
+		r.bind(arg, substitute(r.constructorParameter(c.def.Parameters[i], c.typeDef), subst), s)
+	}
+}
+
+// constructor finds the constructor a name refers to; arity -1 matches any
+// arity.
+func (r *resolver) constructor(name *ast.ConstructorName, arity int) (constructor, bool) {
+	found := []constructor{}
+	for _, c := range r.constructors[name.Name] {
+		if (name.Type == "" || c.typeDef.TypeName.Name == name.Type) && (arity < 0 || len(c.def.Parameters) == arity) {
+			found = append(found, c)
+		}
+	}
+	if len(found) != 1 {
+		return constructor{}, false
+	}
+	return found[0], true
+}
+
+// expression resolves the method calls in e and returns it with its type.
+func (r *resolver) expression(e *ast.Expression, s *scope) (*ast.Expression, *typ, error) {
+	switch {
+	case e.Const != nil:
+		switch {
+		case e.Const.Str != nil:
+			return e, &typ{name: "String"}, nil
+		case e.Const.Char != nil:
+			return e, &typ{name: "Char"}, nil
+		}
+		return e, &typ{name: "Int"}, nil
+	case e.Variable != "":
+		if t, ok := s.variables[e.Variable]; ok {
+			return e, t, nil
+		}
+		if _, ok := r.methods[e.Variable]; ok {
+			return nil, nil, errorf(e.Pos, "method %v cannot be used as a value", e.Variable)
+		}
+		if f, ok := r.functions[e.Variable]; ok && len(f.Constraints) > 0 {
+			return nil, nil, errorf(e.Pos, "function %v has constraints and cannot be used as a value", e.Variable)
+		}
+		return e, nil, nil
+	case e.Tuple != nil:
+		elements, types, err := r.expressions(e.Tuple.Elements, s)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tuple(e.Pos, elements...), &typ{name: tupleName, args: types}, nil
+	case e.Field != nil:
+		value, t, err := r.expression(e.Field.Value, s)
+		if err != nil {
+			return nil, nil, err
+		}
+		field := &ast.FieldAccess{Pos: e.Field.Pos, Field: e.Field.Field, Value: value}
+		return &ast.Expression{Pos: e.Pos, Field: field}, r.fieldType(e.Field, t), nil
+	case e.ExprConstructor != nil:
+		args, types, err := r.expressions(e.ExprConstructor.Arguments, s)
+		if err != nil {
+			return nil, nil, err
+		}
+		ec := &ast.ExprConstructor{Pos: e.ExprConstructor.Pos, Name: e.ExprConstructor.Name, Arguments: args}
+		return &ast.Expression{Pos: e.Pos, ExprConstructor: ec}, r.constructorType(&ec.Name, types), nil
+	case e.FunCall != nil:
+		return r.call(e, s)
+	}
+	return e, nil, nil
+}
+
+func (r *resolver) expressions(es []*ast.Expression, s *scope) ([]*ast.Expression, []*typ, error) {
+	resolved := make([]*ast.Expression, len(es))
+	types := make([]*typ, len(es))
+	for i, e := range es {
+		var err error
+		resolved[i], types[i], err = r.expression(e, s)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return resolved, types, nil
+}
+
+func (r *resolver) fieldType(field *ast.FieldAccess, t *typ) *typ {
+	if field.IsIndex() {
+		index, err := strconv.Atoi(field.Field)
+		if err != nil || t == nil || t.name != tupleName || index >= len(t.args) {
+			return nil
+		}
+		return t.args[index]
+	}
+	for _, c := range r.fields[field.Field] {
+		if t != nil && t.name != c.typeDef.TypeName.Name {
+			continue
+		}
+		subst := map[string]*typ{}
+		for i, general := range c.typeDef.TypeGeneral {
+			if t != nil && i < len(t.args) {
+				subst[general.Name] = t.args[i]
+			}
+		}
+		for i, name := range c.def.FieldNames() {
+			if name == field.Field {
+				return substitute(r.constructorParameter(c.def.Parameters[i], c.typeDef), subst)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *resolver) constructorType(name *ast.ConstructorName, args []*typ) *typ {
+	c, ok := r.constructor(name, len(args))
+	if !ok {
+		return nil
+	}
+	subst := map[string]*typ{}
+	for i, p := range c.def.Parameters {
+		match(r.constructorParameter(p, c.typeDef), args[i], subst)
+	}
+	result := &typ{name: c.typeDef.TypeName.Name}
+	for _, general := range c.typeDef.TypeGeneral {
+		result.args = append(result.args, subst[general.Name])
+	}
+	return result
+}
+
+// call resolves a call of a method or of a function with constraints by
+// passing the dictionaries they need.
+func (r *resolver) call(e *ast.Expression, s *scope) (*ast.Expression, *typ, error) {
+	call := e.FunCall
+	args, types, err := r.expressions(call.Arguments, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolved := func(name string, args []*ast.Expression) *ast.Expression {
+		return &ast.Expression{Pos: e.Pos, FunCall: &ast.FunCall{Pos: call.Pos, Name: name, Arguments: args}}
+	}
+	if _, bound := s.variables[call.Name]; bound {
+		return resolved(call.Name, args), nil, nil
+	}
+	if c, ok := r.methods[call.Name]; ok {
+		return r.method(e, c, args, types, s)
+	}
+	if f, ok := r.functions[call.Name]; ok {
+		subst := map[string]*typ{}
+		if len(f.Parameters) == len(types) {
+			for i, p := range f.Parameters {
+				if c := match(r.common(p), types[i], subst); c != nil {
+					return nil, nil, errorf(call.Pos, "%v cannot be both %v and %v in %v", c.variable, c.first, c.second, call)
+				}
+			}
+		}
+		dictionaries := []*ast.Expression{}
+		for _, constraint := range f.Constraints {
+			dictionary, err := r.dictionary(r.classes[constraint.Class], subst[constraint.Variable], s, call.Pos)
+			if err != nil {
+				return nil, nil, err
+			}
+			dictionaries = append(dictionaries, dictionary)
+		}
+		return resolved(call.Name, append(dictionaries, args...)), substitute(r.common(f.ReturnType), subst), nil
+	}
+	return resolved(call.Name, args), builtinResults[call.Name], nil
+}
+
+// method resolves a call of a method of c from the type its arguments give
+// to the class variable.
+func (r *resolver) method(e *ast.Expression, c *class, args []*ast.Expression, types []*typ, s *scope) (*ast.Expression, *typ, error) {
+	call := e.FunCall
+	m := c.def.Method(call.Name)
+	subst := map[string]*typ{}
+	if len(m.Parameters) == len(types) {
+		for i, p := range m.Parameters {
+			if c := match(r.common(p), types[i], subst); c != nil {
+				return nil, nil, errorf(call.Pos, "%v cannot be both %v and %v in %v", c.variable, c.first, c.second, call)
+			}
+		}
+	}
+	result := substitute(r.common(m.ReturnType), subst)
+	resolved := func(name string, args []*ast.Expression) *ast.Expression {
+		return &ast.Expression{Pos: e.Pos, FunCall: &ast.FunCall{Pos: call.Pos, Name: name, Arguments: args}}
+	}
+
+	t := subst[c.def.Variable]
+	switch {
+	case t == nil:
+		if c.builtin {
+			return resolved(call.Name, args), result, nil
+		}
+		return nil, nil, errorf(call.Pos, "cannot find the instance of %v for %v: the type of the arguments is unknown", c.def.Name, call)
+	case t.variable != "":
+		name, ok := s.dictionaries[dictionaryKey{class: c.def.Name, variable: t.variable}]
+		switch {
+		case ok:
+			c.used[dispatcher(c.def.Name, call.Name)] = true
+			dictionary := &ast.Expression{Pos: call.Pos, Variable: name}
+			return resolved(dispatcher(c.def.Name, call.Name), append([]*ast.Expression{dictionary}, args...)), result, nil
+		case c.builtin:
+			return resolved(call.Name, args), result, nil
+		}
+		return nil, nil, errorf(call.Pos, "no instance of %v for %v: add the constraint where [%v %v]", c.def.Name, t, c.def.Name, t)
+	}
+	head := t.name
+	if _, ok := r.instances[instanceKey{class: c.def.Name, head: head}]; !ok {
+		if c.builtin {
+			return resolved(call.Name, args), result, nil
+		}
+		return nil, nil, errorf(call.Pos, "no instance of %v for %v", c.def.Name, t)
+	}
+	dictionary, err := r.dictionary(c, t, s, call.Pos)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := methodFunction(c.def.Name, call.Name, head)
+	return resolved(name, append([]*ast.Expression{dictionary}, args...)), result, nil
+}
+
+// dictionary builds the dictionary of the instance of c for t.
+func (r *resolver) dictionary(c *class, t *typ, s *scope, pos lexer.Position) (*ast.Expression, error) {
+	builtin := func() *ast.Expression {
+		methods := []*ast.Expression{}
+		for _, m := range c.def.Methods {
+			name := methodFunction(c.def.Name, m.Name, builtinHead)
+			c.used[name] = true
+			methods = append(methods, &ast.Expression{Pos: pos, Variable: name})
+		}
+		return tuple(pos, tuple(pos, methods...), tuple(pos))
+	}
+
+	switch {
+	case t == nil:
+		if c.builtin {
+			return builtin(), nil
+		}
+		return nil, errorf(pos, "cannot find the instance of %v: the type is unknown", c.def.Name)
+	case t.variable != "":
+		name, ok := s.dictionaries[dictionaryKey{class: c.def.Name, variable: t.variable}]
+		switch {
+		case ok:
+			return &ast.Expression{Pos: pos, Variable: name}, nil
+		case c.builtin:
+			return builtin(), nil
+		}
+		return nil, errorf(pos, "no instance of %v for %v: add the constraint where [%v %v]", c.def.Name, t, c.def.Name, t)
+	}
+	instance, ok := r.instances[instanceKey{class: c.def.Name, head: t.name}]
+	if !ok {
+		if c.builtin {
+			return builtin(), nil
+		}
+		return nil, errorf(pos, "no instance of %v for %v", c.def.Name, t)
+	}
+
+	subst := map[string]*typ{}
+	match(r.parameter(instance.Type), t, subst)
+	contexts := []*ast.Expression{}
+	for _, constraint := range instance.Constraints {
+		context, err := r.dictionary(r.classes[constraint.Class], subst[constraint.Variable], s, pos)
+		if err != nil {
+			return nil, err
+		}
+		contexts = append(contexts, context)
+	}
+	methods := []*ast.Expression{}
+	for _, m := range c.def.Methods {
+		methods = append(methods, &ast.Expression{Pos: pos, Variable: methodFunction(c.def.Name, m.Name, t.name)})
+	}
+	return tuple(pos, tuple(pos, methods...), tuple(pos, contexts...)), nil
+}
@@ -0,0 +1,206 @@
+package classes
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/interp"
+	"github.com/emrzvv/fl-compiler/internal/prelude"
+	"github.com/emrzvv/fl-compiler/internal/vm"
+)
+
+const shapes = `type [Shape]: Circle Int | Square Int .
+class [Describe a] :
+	(describe [a]) -> String .
+instance [Describe Shape] :
+	(describe [Circle r]) -> (concat "circle " (show r)) |
+	(describe [Square s]) -> (concat "square " (show s)) .
+instance [Describe Int] :
+	(describe n) -> (show n) .
+instance [Describe [List a]] where [Describe a] :
+	(describe [Nil]) -> "" |
+	(describe [Cons x xs]) -> (concat (describe x) ";" (describe xs)) .
+`
+
+func resolve(t *testing.T, input string) (*ast.Program, error) {
+	t.Helper()
+	program, err := ast.ParseString("tests", input)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	program, err = prelude.Import(program)
+	if err != nil {
+		t.Fatalf("import error: %s", err)
+	}
+	return Resolve(program)
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{shapes + `(print (describe [Circle 2]))`, "circle 2\n"},
+		{shapes + `(print (describe 7))`, "7\n"},
+		{shapes + `(print (describe {[Square 1] [Circle 3]}))`, "square 1;circle 3;\n"},
+		{shapes + `(print (describe {{1} {2 3}}))`, "1;;2;3;;\n"},
+		{
+			shapes + `fun (twice [a]) -> String where [Describe a] :
+				(twice x) -> (concat (describe x) (describe x)) .
+			(print (twice {1}))`,
+			"1;1;\n",
+		},
+		{
+			shapes + `fun (outer [a]) -> String where [Describe a] :
+				(outer x) -> (inner {x}) .
+			fun (inner [List b]) -> String where [Describe b] :
+				(inner xs) -> (describe xs) .
+			(print (outer [Square 5]))`,
+			"square 5;\n",
+		},
+		// the pattern variables of constructors and tuples have types
+		{
+			shapes + `fun (first [Pair a Int]) -> String where [Describe a] :
+				(first [Pair x n]) -> (describe x) .
+			fun (second [a]) -> String where [Describe a] :
+				(second x) -> (describe (.1 (, 0 x))) .
+			(print (first [Pair [Circle 1] 0]))
+			(print (second [Square 2]))`,
+			"circle 1\nsquare 2\n",
+		},
+		// show, eq and compare fall back to the builtins
+		{
+			`type [Color]: Red | Green .
+			instance [Show Color] :
+				(show [Red]) -> "red" |
+				(show [Green]) -> "green" .
+			(print (show [Green]))
+			(print (show {[Red]}))
+			(print (show 1))`,
+			"green\n[Red]\n1\n",
+		},
+		{
+			`type [Mod]: Mod Int .
+			instance [Eq Mod] :
+				(eq [Mod a] [Mod b]) -> (eq (strcmp (intToString a) (intToString b)) 0) .
+			fun (same [a] [a]) -> Int where [Eq a] :
+				(same x y) -> (eq x y) .
+			(print (same [Mod 1] [Mod 1]))
+			(print (same 1 2))`,
+			"1\n0\n",
+		},
+		{
+			`type [Tree x]: Leaf | Node [Tree x] x [Tree x] .
+			instance [Functor Tree] :
+				(fmap f [Leaf]) -> [Leaf] |
+				(fmap f [Node l x r]) -> [Node (fmap f l) (f x) (fmap f r)] .
+			fun (inc Int) -> Int :
+				(inc n) -> (+ n 1) .
+			fun (twice [f Int]) -> [f Int] where [Functor f] :
+				(twice c) -> (fmap inc (fmap inc c)) .
+			(print (twice [Node [Leaf] 1 [Leaf]]))
+			(print (twice {1 2}))
+			(print (fmap inc [Just 0]))`,
+			"[Node [Leaf] 3 [Leaf]]\n[3, 4]\n[Just 1]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		program, err := resolve(t, tt.input)
+		if err != nil {
+			t.Fatalf("resolve error for %s: %s", tt.input, err)
+		}
+		err = ast.CheckSemantics(
+			program,
+			make(map[ast.TypeDefKey]interface{}),
+			make(map[ast.ConstructorDefKey]interface{}),
+			make(map[ast.FunctionDefKey]interface{}),
+			make(map[ast.VariableDefKey]interface{}),
+		)
+		if err != nil {
+			t.Fatalf("semantic error for %s: %s", tt.input, err)
+		}
+
+		c := compiler.NewCompiler()
+		err = c.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error for %s: %s", tt.input, err)
+		}
+		var out bytes.Buffer
+		err = vm.NewFVM(c.Bytecode(), vm.WithOutput(&out)).Run()
+		if err != nil {
+			t.Fatalf("vm error for %s: %s", tt.input, err)
+		}
+		if out.String() != tt.output {
+			t.Errorf("wrong vm output for %s.\nexpected %q\ngot %q", tt.input, tt.output, out.String())
+		}
+
+		out.Reset()
+		_, err = interp.NewInterpreter(interp.WithOutput(&out)).Run(program)
+		if err != nil {
+			t.Fatalf("interpreter error for %s: %s", tt.input, err)
+		}
+		if out.String() != tt.output {
+			t.Errorf("wrong interpreter output for %s.\nexpected %q\ngot %q", tt.input, tt.output, out.String())
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{shapes + `class [Describe b] : (other [b]) -> Int .`, "class Describe already declared"},
+		{shapes + `class [Other b] : (describe [b]) -> Int .`, "method describe already declared"},
+		{`fun (other Int) -> Int : (other n) -> n . class [Other b] : (other [b]) -> Int .`, "function other already declared"},
+		{`class [Other b] : (other Int) -> Int .`, "method other does not mention b in its parameters"},
+		{`instance [Other Int] : (other n) -> n .`, "unknown class Other"},
+		{shapes + `instance [Describe Shape] : (describe s) -> "" .`, "instance [Describe Shape] already declared"},
+		{shapes + `instance [Describe Color] : (describe s) -> "" .`, "unknown type Color"},
+		{shapes + `instance [Describe (, Int Int)] : (describe s) -> "" .`, "instances are declared for builtin and defined types, not for (, Int Int)"},
+		{shapes + `instance [Describe [Maybe Int]] : (describe s) -> "" .`, "the parameters of [Maybe Int] have to be distinct type variables"},
+		{shapes + `instance [Describe String] : (show s) -> "" .`, "show is not a method of class Describe"},
+		{shapes + `instance [Describe String] : (describe s t) -> "" .`, "method describe expects 1 arguments, rule has 2"},
+		{`class [Two a] : (one [a]) -> Int | (two [a]) -> Int . instance [Two Int] : (one n) -> n .`, "instance [Two Int] does not define two"},
+		{shapes + `instance [Describe [Maybe a]] where [Describe b] : (describe s) -> "" .`, "constraint [Describe b] refers to b, which is not a variable of [Maybe a]"},
+		{shapes + `fun (f [a]) -> Int where [Other a] : (f x) -> 0 .`, "unknown class Other"},
+		{shapes + `(print (describe "text"))`, "no instance of Describe for String"},
+		{
+			shapes + `(print (describe (head {1})))`,
+			"cannot find the instance of Describe for (describe (head {1})): the type of the arguments is unknown",
+		},
+		{shapes + `fun (f [a]) -> String : (f x) -> (describe x) .`, "no instance of Describe for a: add the constraint where [Describe a]"},
+		{shapes + `fun (f Int) -> String : (f x) -> (g x) . fun (g [a]) -> String where [Describe a] : (g y) -> "" . (print (g [Just 1]))`, "no instance of Describe for [Maybe Int]"},
+		{
+			`class [Size a] : (size [a]) -> Int .
+			instance [Size Int] : (size n) -> n .
+			instance [Size [List a]] : (size xs) -> (length xs) .
+			fun (total [a] [a]) -> Int where [Size a] : (total x y) -> (+ (size x) (size y)) .
+			(print (total 1 {3}))`,
+			"a cannot be both Int and [List Int] in (total 1 {3})",
+		},
+		{`(print (eq 1 "a"))`, "a cannot be both Int and String in (eq 1 \"a\")"},
+		{shapes + `(print (map describe {1}))`, "method describe cannot be used as a value"},
+		{shapes + `fun (f [a]) -> String where [Describe a] : (f x) -> "" . (print (map f {1}))`, "function f has constraints and cannot be used as a value"},
+	}
+
+	for _, tt := range tests {
+		_, err := resolve(t, tt.input)
+		if err == nil {
+			t.Errorf("expected an error for %s", tt.input)
+			continue
+		}
+		var semanticErr *ast.SemanticError
+		if !errors.As(err, &semanticErr) {
+			t.Errorf("expected a semantic error for %s, got %s", tt.input, err)
+			continue
+		}
+		if semanticErr.Message != tt.message {
+			t.Errorf("wrong error for %s.\nexpected %s\ngot %s", tt.input, tt.message, semanticErr.Message)
+		}
+	}
+}
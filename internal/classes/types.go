@@ -0,0 +1,224 @@
+package classes
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+)
+
+// typ is the type of an expression as far as the resolver can tell. A nil
+// *typ is a type that is not known.
+type typ struct {
+	// name is a builtin type, a defined type or tupleName
+	name string
+	// variable is a type variable of the definition being resolved;
+	// with args it is applied like a type, as in [f a]
+	variable string
+	args     []*typ
+}
+
+const tupleName = "(,)"
+
+// functionName is the type of functions, [Fun x .. y].
+const functionName = "Fun"
+
+var builtinTypes = []string{"Int", "String", "Char"}
+
+// builtinResults are the result types of the builtins.
+var builtinResults = map[string]*typ{
+	"+":           {name: "Int"},
+	"show":        {name: "String"},
+	"eq":          {name: "Int"},
+	"compare":     {name: "Int"},
+	"readInt":     {name: "Int"},
+	"readLine":    {name: "String"},
+	"concat":      {name: "String"},
+	"strlen":      {name: "Int"},
+	"charAt":      {name: "Char"},
+	"strcmp":      {name: "Int"},
+	"intToString": {name: "String"},
+	"stringToInt": {name: "Int"},
+}
+
+// String prints the type the way signatures write it.
+func (t *typ) String() string {
+	switch {
+	case t == nil:
+		return "an unknown type"
+	case t.name == tupleName:
+		parts := []string{"(,"}
+		for _, arg := range t.args {
+			parts = append(parts, arg.argument())
+		}
+		return strings.Join(parts, " ") + ")"
+	case len(t.args) == 0 && (t.variable != "" || slices.Contains(builtinTypes, t.name)):
+		return t.name + t.variable
+	}
+	parts := []string{t.name + t.variable}
+	for _, arg := range t.args {
+		parts = append(parts, arg.argument())
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// argument prints a type inside another one, where names go without
+// brackets.
+func (t *typ) argument() string {
+	switch {
+	case t == nil:
+		return "_"
+	case t.name != tupleName && len(t.args) == 0:
+		return t.name + t.variable
+	}
+	return t.String()
+}
+
+// conflict is a variable that match bound to types with different heads.
+type conflict struct {
+	variable      string
+	first, second *typ
+}
+
+// match binds the variables of pattern, a type from a signature being
+// called, to the parts of t they correspond to. Parts that do not fit are
+// ignored: types are not checked, only instances are looked for. A variable
+// that would be bound to two different heads is reported, since no instance
+// can be chosen for it.
+func match(pattern *typ, t *typ, subst map[string]*typ) *conflict {
+	if pattern == nil || t == nil {
+		return nil
+	}
+	if pattern.variable != "" {
+		k := len(pattern.args)
+		if k > len(t.args) || (k > 0 && t.name == tupleName) {
+			return nil
+		}
+		bound := &typ{name: t.name, variable: t.variable, args: t.args[:len(t.args)-k]}
+		if first, ok := subst[pattern.variable]; !ok {
+			subst[pattern.variable] = bound
+		} else if first.name+first.variable != bound.name+bound.variable {
+			return &conflict{variable: pattern.variable, first: first, second: bound}
+		}
+		for i, arg := range pattern.args {
+			if c := match(arg, t.args[len(t.args)-k+i], subst); c != nil {
+				return c
+			}
+		}
+		return nil
+	}
+	if t.variable != "" || pattern.name != t.name || len(pattern.args) != len(t.args) {
+		return nil
+	}
+	for i := range pattern.args {
+		if c := match(pattern.args[i], t.args[i], subst); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// substitute replaces the variables of t bound in subst. Variables that are
+// not bound belong to the signature being called and are not known.
+func substitute(t *typ, subst map[string]*typ) *typ {
+	if t == nil {
+		return nil
+	}
+	args := make([]*typ, len(t.args))
+	for i, arg := range t.args {
+		args[i] = substitute(arg, subst)
+	}
+	if t.variable == "" {
+		return &typ{name: t.name, args: args}
+	}
+	bound := subst[t.variable]
+	if bound == nil {
+		return nil
+	}
+	return &typ{name: bound.name, variable: bound.variable, args: append(slices.Clone(bound.args), args...)}
+}
+
+// variables adds the variables of t to subst, bound to themselves, so that
+// substitute keeps them.
+func variables(t *typ, subst map[string]*typ) {
+	if t == nil {
+		return
+	}
+	if t.variable != "" {
+		if _, ok := subst[t.variable]; !ok {
+			subst[t.variable] = &typ{variable: t.variable}
+		}
+	}
+	for _, arg := range t.args {
+		variables(arg, subst)
+	}
+}
+
+// named is the type called name. The parser does not tell type names from
+// type variables, so a name that is not a builtin or a defined type is a
+// variable.
+func (r *resolver) named(name string, args []*typ) *typ {
+	if slices.Contains(builtinTypes, name) {
+		return &typ{name: name}
+	}
+	if _, ok := r.types[name]; ok || name == functionName {
+		return &typ{name: name, args: args}
+	}
+	return &typ{variable: name, args: args}
+}
+
+func (r *resolver) common(t *ast.TypeCommon) *typ {
+	switch {
+	case t.TypeBuiltin != nil:
+		return &typ{name: t.TypeBuiltin.Type}
+	case t.Tuple != nil:
+		return r.tuple(t.Tuple)
+	}
+	args := []*typ{}
+	for _, p := range t.TypeParameters {
+		args = append(args, r.parameter(p))
+	}
+	return r.named(t.TypeName.Name, args)
+}
+
+func (r *resolver) parameter(p *ast.TypeParameter) *typ {
+	switch {
+	case p.TypeCommon != nil:
+		return r.common(p.TypeCommon)
+	case p.TypeBuiltin != nil:
+		return &typ{name: p.TypeBuiltin.Type}
+	}
+	return r.named(p.TypeGeneral.Name, nil)
+}
+
+func (r *resolver) tuple(t *ast.TupleType) *typ {
+	result := &typ{name: tupleName}
+	for _, element := range t.Elements {
+		result.args = append(result.args, r.parameter(element))
+	}
+	return result
+}
+
+// constructorParameter is the type of a parameter of a constructor of td,
+// with the variables of td as variables.
+func (r *resolver) constructorParameter(p *ast.ConstructorParameter, td *ast.TypeDef) *typ {
+	isGeneral := func(name string) bool {
+		return slices.ContainsFunc(td.TypeGeneral, func(g *ast.TypeGeneral) bool { return g.Name == name })
+	}
+	switch {
+	case p.Tuple != nil:
+		return r.tuple(p.Tuple)
+	case p.TypeGeneral != nil && isGeneral(p.TypeGeneral.Name):
+		return &typ{variable: p.TypeGeneral.Name}
+	case p.TypeGeneral != nil:
+		return r.named(p.TypeGeneral.Name, nil)
+	}
+	args := []*typ{}
+	for _, list := range p.List {
+		args = append(args, r.parameter(list))
+	}
+	if isGeneral(p.TypeName.Name) {
+		return &typ{variable: p.TypeName.Name, args: args}
+	}
+	return r.named(p.TypeName.Name, args)
+}
@@ -2,10 +2,17 @@ package ast
 
 import (
 	"fmt"
+	"io"
+	"math/big"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/alecthomas/participle/v2"
 	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
 )
 
 type Node interface {
@@ -16,31 +23,137 @@ type Program struct {
 	Pos lexer.Position
 
 	Definitions []*Definition `@@*`
+	// Comments are the comments after the last definition. The others are
+	// attached to the definitions they are written in.
+	Comments []*Comment
 }
 
 func (p *Program) String() string {
-	return "tmp"
+	return Format(p)
 }
 
 type Definition struct {
-	Pos lexer.Position
-
-	TypeDef *TypeDef `@@`
-	FunDef  *FunDef  `| @@`
-	FunCall *FunCall `| @@`
+	Pos    lexer.Position
+	EndPos lexer.Position
+
+	TypeDef  *TypeDef     `@@`
+	FunDef   *FunDef      `| @@`
+	FunCall  *FunCall     `| @@`
+	Test     *TestDef     `| @@`
+	Class    *ClassDef    `| @@`
+	Instance *InstanceDef `| @@`
+	// Comments are the comments in front of a call or a test; the other
+	// definitions keep them themselves.
+	Comments []*Comment
+	// Trailing are the comments after the definition on its last line.
+	Trailing []*Comment
 }
 
-func (d *Definition) String() string { return "tmp" }
+func (d *Definition) String() string {
+	switch {
+	case d.TypeDef != nil:
+		return d.TypeDef.String()
+	case d.FunDef != nil:
+		return d.FunDef.String()
+	case d.FunCall != nil:
+		return d.FunCall.String()
+	case d.Test != nil:
+		return d.Test.String()
+	case d.Class != nil:
+		return d.Class.String()
+	case d.Instance != nil:
+		return d.Instance.String()
+	}
+	return ""
+}
 
 type TypeDef struct {
-	Pos lexer.Position
+	Pos    lexer.Position
+	EndPos lexer.Position
 
 	TypeName         *TypeName          `"type" "[" @@`
 	TypeGeneral      []*TypeGeneral     `@@* "]" ":"`
 	TypeAlternatives []*TypeAlterantive `@@ ("|" @@)* "."`
+	Comments         []*Comment
+	// Trailing are the comments after the header, type [Name]:.
+	Trailing []*Comment
 }
 
-func (td *TypeDef) String() string { return "tmp" }
+// String prints the type on one line, or with an alternative per line when
+// comments are attached inside it.
+func (td *TypeDef) String() string {
+	header := []string{td.TypeName.String()}
+	for _, g := range td.TypeGeneral {
+		header = append(header, g.String())
+	}
+	multiline := len(td.Trailing) > 0
+	alternatives := []string{}
+	for i, alt := range td.TypeAlternatives {
+		alternatives = append(alternatives, alt.String())
+		if len(alt.Comments) > 0 || (len(alt.Trailing) > 0 && i+1 < len(td.TypeAlternatives)) {
+			multiline = true
+		}
+	}
+	last := td.TypeAlternatives[len(td.TypeAlternatives)-1]
+	if !multiline {
+		return fmt.Sprintf(
+			"%stype [%s]: %s .%s",
+			formatComments(td.Comments, ""),
+			strings.Join(header, " "),
+			strings.Join(alternatives, " | "),
+			formatTrailing(last.Trailing, ""),
+		)
+	}
+
+	var out strings.Builder
+	out.WriteString(formatComments(td.Comments, ""))
+	fmt.Fprintf(&out, "type [%s]:%s", strings.Join(header, " "), formatTrailing(td.Trailing, ""))
+	for i, alt := range td.TypeAlternatives {
+		out.WriteString("\n" + formatComments(alt.Comments, indent) + indent + alternatives[i])
+		if i+1 < len(td.TypeAlternatives) {
+			out.WriteString(" |" + formatTrailing(alt.Trailing, indent))
+		}
+	}
+	out.WriteString(" ." + formatTrailing(last.Trailing, indent))
+	return out.String()
+}
+
+// IsList reports whether the type is shaped like a list: one constructor
+// without parameters and one with an element and the rest of the list, as
+// in type [List x]: Cons x [List x] | Nil .
+func (td *TypeDef) IsList() bool {
+	if len(td.TypeAlternatives) != 2 {
+		return false
+	}
+	empty, cons := td.TypeAlternatives[0].Constructor, td.TypeAlternatives[1].Constructor
+	if len(empty.Parameters) != 0 {
+		empty, cons = cons, empty
+	}
+	if len(empty.Parameters) != 0 || len(cons.Parameters) != 2 {
+		return false
+	}
+	isSelf := func(p *ConstructorParameter) bool {
+		return p.TypeName != nil && p.TypeName.Name == td.TypeName.Name
+	}
+	return !isSelf(cons.Parameters[0]) && isSelf(cons.Parameters[1])
+}
+
+// Constructors builds the runtime constructors of the type, one per
+// alternative, tagged in the order they are declared.
+func (td *TypeDef) Constructors() []*object.Constructor {
+	constructors := make([]*object.Constructor, len(td.TypeAlternatives))
+	for i, alt := range td.TypeAlternatives {
+		constructors[i] = &object.Constructor{
+			Name:      alt.Constructor.Name,
+			Arity:     int64(len(alt.Constructor.Parameters)),
+			Supertype: td.TypeName.Name,
+			Tag:       int64(i),
+			List:      td.IsList(),
+			Fields:    alt.Constructor.FieldNames(),
+		}
+	}
+	return constructors
+}
 
 type TypeName struct {
 	Pos lexer.Position
@@ -48,7 +161,7 @@ type TypeName struct {
 	Name string `@Ident`
 }
 
-func (tn *TypeName) String() string { return "tmp" }
+func (tn *TypeName) String() string { return tn.Name }
 
 type TypeGeneral struct {
 	Pos lexer.Position
@@ -56,24 +169,60 @@ type TypeGeneral struct {
 	Name string `@Ident`
 }
 
-func (tg *TypeGeneral) String() string { return "tmp" }
+func (tg *TypeGeneral) String() string { return tg.Name }
 
 type TypeAlterantive struct {
-	Pos lexer.Position
+	Pos    lexer.Position
+	EndPos lexer.Position
 
 	Constructor *Constructor `@@`
+	Comments    []*Comment
+	Trailing    []*Comment
 }
 
-func (ta *TypeAlterantive) String() string { return "tmp" }
+func (ta *TypeAlterantive) String() string { return ta.Constructor.String() }
 
 type Constructor struct {
 	Pos lexer.Position
 
-	Name       string                  `@Ident`
+	Name string `@Ident`
+	// Fields are the named fields of a record constructor, declared as
+	// Person {name: String, age: Int}. The parser copies their types into
+	// Parameters, so a record is also an ordinary constructor.
+	Fields     []*Field                `( "{" @@ ("," @@)* "}" )?`
 	Parameters []*ConstructorParameter `@@*`
 }
 
-func (c *Constructor) String() string { return "tmp" }
+func (c *Constructor) String() string {
+	if len(c.Fields) > 0 {
+		fields := []string{}
+		for _, f := range c.Fields {
+			fields = append(fields, f.String())
+		}
+		return c.Name + " {" + strings.Join(fields, ", ") + "}"
+	}
+	parts := []string{c.Name}
+	for _, p := range c.Parameters {
+		parts = append(parts, p.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// ConstructorName refers to a constructor, optionally qualified with the
+// name of its type: Leaf or Tree.Leaf.
+type ConstructorName struct {
+	Pos lexer.Position
+
+	Type string `(@Ident ".")?`
+	Name string `@Ident`
+}
+
+func (cn *ConstructorName) String() string {
+	if cn.Type != "" {
+		return cn.Type + "." + cn.Name
+	}
+	return cn.Name
+}
 
 type ConstructorParameter struct {
 	Pos lexer.Position
@@ -81,9 +230,22 @@ type ConstructorParameter struct {
 	TypeName    *TypeName        `"[" @@`
 	List        []*TypeParameter `@@* "]"`
 	TypeGeneral *TypeGeneral     `| @@`
+	Tuple       *TupleType       `| @@`
 }
 
-func (cp *ConstructorParameter) String() string { return "tmp" }
+func (cp *ConstructorParameter) String() string {
+	if cp.TypeGeneral != nil {
+		return cp.TypeGeneral.String()
+	}
+	if cp.Tuple != nil {
+		return cp.Tuple.String()
+	}
+	parts := []string{cp.TypeName.String()}
+	for _, p := range cp.List {
+		parts = append(parts, p.String())
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
 
 type TypeParameter struct {
 	Pos lexer.Position
@@ -93,7 +255,17 @@ type TypeParameter struct {
 	TypeBuiltin *TypeBuiltin `| @@`
 }
 
-func (tp *TypeParameter) String() string { return "tmp" }
+func (tp *TypeParameter) String() string {
+	switch {
+	case tp.TypeCommon != nil:
+		return tp.TypeCommon.String()
+	case tp.TypeGeneral != nil:
+		return tp.TypeGeneral.String()
+	case tp.TypeBuiltin != nil:
+		return tp.TypeBuiltin.String()
+	}
+	return ""
+}
 
 type TypeCommon struct {
 	Pos lexer.Position
@@ -101,26 +273,84 @@ type TypeCommon struct {
 	TypeName       *TypeName        `"[" @@`
 	TypeParameters []*TypeParameter `@@* "]"`
 	TypeBuiltin    *TypeBuiltin     `| @@`
+	Tuple          *TupleType       `| @@`
 }
 
-func (tc *TypeCommon) String() string { return "tmp" }
+func (tc *TypeCommon) String() string {
+	if tc.TypeBuiltin != nil {
+		return tc.TypeBuiltin.String()
+	}
+	if tc.Tuple != nil {
+		return tc.Tuple.String()
+	}
+	parts := []string{tc.TypeName.String()}
+	for _, p := range tc.TypeParameters {
+		parts = append(parts, p.String())
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
 
 type TypeBuiltin struct {
 	Pos lexer.Position
 
-	Type string `@("Int")`
+	Type string `@("Int" | "String" | "Char")`
 }
 
-func (tb *TypeBuiltin) String() string { return "tmp" }
+func (tb *TypeBuiltin) String() string { return tb.Type }
 
 type FunDef struct {
-	Pos lexer.Position
+	Pos    lexer.Position
+	EndPos lexer.Position
 
 	Signature *FunSignature `@@ ":"`
 	Rules     []*FunRule    `@@ ("|" @@)* "."`
+	Comments  []*Comment
 }
 
-func (fd *FunDef) String() string { return "tmp" }
+func (fd *FunDef) String() string {
+	return formatComments(fd.Comments, "") + fd.Signature.String() + " :" +
+		formatTrailing(fd.Signature.Trailing, "") + formatRules(fd.Rules)
+}
+
+// formatRules prints rules one per line with aligned arrows.
+func formatRules(rules []*FunRule) string {
+	patterns := []string{}
+	width := 0
+	for _, rule := range rules {
+		pattern := rule.Pattern.String()
+		patterns = append(patterns, pattern)
+		width = max(width, len(pattern))
+	}
+
+	var out strings.Builder
+	for i, rule := range rules {
+		out.WriteString("\n" + formatComments(rule.Comments, indent))
+		fmt.Fprintf(&out, "%s%-*s -> %s", indent, width, patterns[i], rule.Expression)
+		if i+1 < len(rules) {
+			out.WriteString(" |" + formatTrailing(rule.Trailing, indent))
+		}
+	}
+	out.WriteString(" .")
+	if len(rules) > 0 {
+		out.WriteString(formatTrailing(rules[len(rules)-1].Trailing, indent))
+	}
+	return out.String()
+}
+
+// TestDef is a named expression checked by `fl test`. It is not evaluated
+// when the program runs; the test runner compiles it as a separate entry
+// point and the test passes if it evaluates without an error, so it is
+// usually a call of assert or assertEq.
+type TestDef struct {
+	Pos lexer.Position
+
+	Name       string      `"test" @String ":"`
+	Expression *Expression `@@ "."`
+}
+
+func (td *TestDef) String() string {
+	return fmt.Sprintf("test %s: %s .", strconv.Quote(td.Name), td.Expression)
+}
 
 type FunSignature struct {
 	Pos lexer.Position
@@ -128,49 +358,152 @@ type FunSignature struct {
 	Name       string        `"fun" "(" @Ident`
 	Parameters []*TypeCommon `@@* ")" "->"`
 	ReturnType *TypeCommon   `@@`
+	// Constraints are the classes the type variables of the function have
+	// to be instances of.
+	Constraints []*Constraint `( "where" @@+ )?`
+	// Trailing are the comments after the signature, before the rules.
+	Trailing []*Comment
 }
 
-func (fs *FunSignature) String() string { return "tmp" }
+func (fs *FunSignature) String() string {
+	parts := []string{fs.Name}
+	for _, p := range fs.Parameters {
+		parts = append(parts, p.String())
+	}
+	return fmt.Sprintf("fun (%s) -> %s%s", strings.Join(parts, " "), fs.ReturnType, formatConstraints(fs.Constraints))
+}
 
 type FunRule struct {
-	Pos lexer.Position
+	Pos    lexer.Position
+	EndPos lexer.Position
 
 	Pattern    *Pattern    `@@ "->"`
 	Expression *Expression `@@`
+	Comments   []*Comment
+	// Trailing are the comments that end a line of the rule.
+	Trailing []*Comment
 }
 
-func (fr *FunRule) String() string { return "tmp" }
+func (fr *FunRule) String() string {
+	return fmt.Sprintf("%s -> %s", fr.Pattern, fr.Expression)
+}
 
 type Pattern struct {
-	Pos lexer.Position
+	Pos    lexer.Position
+	EndPos lexer.Position
 
 	FunName   string             `"(" @Ident`
 	Arguments []*PatternArgument `@@* ")"`
 }
 
-func (p *Pattern) String() string { return "tmp" }
+func (p *Pattern) String() string {
+	parts := []string{p.FunName}
+	for _, arg := range p.Arguments {
+		parts = append(parts, arg.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
 
 type PatternArgument struct {
 	Pos lexer.Position
 
-	Name      TypeName           `"[" @@`
+	Name ConstructorName `"[" @@`
+	// Fields are the fields a record pattern [Person: name age] binds to
+	// variables of the same names. The compiler expands it into Arguments.
+	Record    bool               `( @":"`
+	Fields    []string           `@Ident* )?`
 	Arguments []*PatternArgument `@@* "]"`
 	Variable  string             `| @Ident`
 	Const     *Const             `| @@`
+	// List is the source form of a {x y | rest} pattern. The parser
+	// desugars it into Name and Arguments.
+	List  *ListPattern  `| @@`
+	Tuple *TuplePattern `| @@`
 }
 
-func (pa *PatternArgument) String() string { return "tmp" }
+func (pa *PatternArgument) String() string {
+	switch {
+	case pa.List != nil:
+		return pa.List.String()
+	case pa.Tuple != nil:
+		return pa.Tuple.String()
+	case pa.IsRecord():
+		return "[" + pa.Name.String() + ": " + strings.Join(pa.Fields, " ") + "]"
+	case pa.Variable != "":
+		return pa.Variable
+	case pa.Const != nil:
+		return pa.Const.String()
+	}
+	parts := []string{pa.Name.String()}
+	for _, arg := range pa.Arguments {
+		parts = append(parts, arg.String())
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
 
 type Expression struct {
 	Pos lexer.Position
 
-	FunCall         *FunCall         `@@`
+	Tuple           *TupleExpression `@@`
+	Field           *FieldAccess     `| @@`
+	FunCall         *FunCall         `| @@`
 	ExprConstructor *ExprConstructor `| @@`
 	Const           *Const           `| @@`
 	Variable        string           `| @Ident`
+	// List is the source form of a {1 2 | rest} list. The parser desugars
+	// it into ExprConstructor.
+	List *ListExpression `| @@`
+	// Comments are the block comments written in front of the expression.
+	Comments []*Comment
+}
+
+func (e *Expression) String() string {
+	var out strings.Builder
+	for _, c := range e.Comments {
+		out.WriteString(c.String() + " ")
+	}
+	out.WriteString(e.source())
+	return out.String()
+}
+
+// subexpressions returns the expressions e is written with, in the source
+// form of lists.
+func (e *Expression) subexpressions() []*Expression {
+	switch {
+	case e.List != nil:
+		if e.List.Tail != nil {
+			return append(slices.Clone(e.List.Elements), e.List.Tail)
+		}
+		return e.List.Elements
+	case e.Tuple != nil:
+		return e.Tuple.Elements
+	case e.Field != nil:
+		return []*Expression{e.Field.Value}
+	case e.FunCall != nil:
+		return e.FunCall.Arguments
+	case e.ExprConstructor != nil:
+		return e.ExprConstructor.Arguments
+	}
+	return nil
 }
 
-func (e *Expression) String() string { return "tmp" }
+func (e *Expression) source() string {
+	switch {
+	case e.List != nil:
+		return e.List.String()
+	case e.Tuple != nil:
+		return e.Tuple.String()
+	case e.Field != nil:
+		return e.Field.String()
+	case e.FunCall != nil:
+		return e.FunCall.String()
+	case e.ExprConstructor != nil:
+		return e.ExprConstructor.String()
+	case e.Const != nil:
+		return e.Const.String()
+	}
+	return e.Variable
+}
 
 type FunCall struct {
 	Pos lexer.Position
@@ -179,83 +512,107 @@ type FunCall struct {
 	Arguments []*Expression `@@* ")"`
 }
 
-func (fc *FunCall) String() string { return "tmp" }
+func (fc *FunCall) String() string {
+	parts := []string{fc.Name}
+	for _, arg := range fc.Arguments {
+		parts = append(parts, arg.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
 
 type Const struct {
 	Pos lexer.Position
 
-	Number int `@Int`
+	Number *big.Int `@Int`
+	Str    *string  `| @String`
+	Char   *string  `| @Char`
 }
 
-func (c *Const) String() string { return "tmp" }
+func (c *Const) String() string {
+	switch {
+	case c.Str != nil:
+		return strconv.Quote(*c.Str)
+	case c.Char != nil:
+		return strconv.QuoteRune([]rune(*c.Char)[0])
+	}
+	return c.Number.String()
+}
 
 type ExprConstructor struct {
 	Pos lexer.Position
 
-	Name      TypeName      `"[" @@`
-	Arguments []*Expression `@@* "]"`
+	Name      ConstructorName `"[" @@`
+	Arguments []*Expression   `@@* "]"`
+}
+
+func (ec *ExprConstructor) String() string {
+	parts := []string{ec.Name.String()}
+	for _, arg := range ec.Arguments {
+		parts = append(parts, arg.String())
+	}
+	return "[" + strings.Join(parts, " ") + "]"
 }
 
-func (ec *ExprConstructor) String() string { return "tmp" }
+var flLexer = &commentLexer{lexer.MustSimple([]lexer.SimpleRule{
+	{Name: "Keyword", Pattern: `\b(type|fun)\b`},
+	{Name: "Operator", Pattern: `->|\||:`},
+	{Name: "Ident", Pattern: `[a-zA-Z\+][a-zA-Z0-9_]*`},
+	// {Name: "TypeName", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
+	// {Name: "TypeGeneral", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
+	// {Name: "FunName", Pattern: `[a-zA-Z\+\-\*\/][a-zA-Z0-9_]*`},
+	// {Name: "VarName", Pattern: `[a-zA-Z][a-zA-Z0-9_]`},
+	{Name: "Int", Pattern: `[0-9]+`}, // TODO: remove leading zeroes
+	{Name: "String", Pattern: `"(\\.|[^"\\])*"`},
+	{Name: "Char", Pattern: `'(\\.|[^'\\])'`},
+	{Name: "Punct", Pattern: `[\[\]\(\)\.\{\},]`},
+	{Name: "whitespace", Pattern: `[ \t\n\r]+`},
+})}
+
+var flParser = participle.MustBuild[Program](
+	participle.Lexer(flLexer),
+	participle.Unquote("String", "Char"),
+)
 
-func GetAST(path string) *Program {
-	var myLexer = lexer.MustSimple([]lexer.SimpleRule{
-		{Name: "Keyword", Pattern: `\b(type|fun)\b`},
-		{Name: "Operator", Pattern: `->|\||:`},
-		{Name: "Ident", Pattern: `[a-zA-Z\+][a-zA-Z0-9_]*`},
-		// {Name: "TypeName", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "TypeGeneral", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "FunName", Pattern: `[a-zA-Z\+\-\*\/][a-zA-Z0-9_]*`},
-		// {Name: "VarName", Pattern: `[a-zA-Z][a-zA-Z0-9_]`},
-		{Name: "Int", Pattern: `[0-9]+`}, // TODO: remove leading zeroes
-		{Name: "Punct", Pattern: `[\[\]\(\)\.]`},
-		{Name: "whitespace", Pattern: `[ \t\n\r]+`},
-	})
+var signatureParser = participle.MustBuild[FunSignature](
+	participle.Lexer(flLexer),
+)
 
-	parser := participle.MustBuild[Program](
-		participle.Lexer(myLexer),
-	)
+// ParseSignature parses a function signature written as in a definition:
+// fun (lookup String) -> Int
+func ParseSignature(input string) (*FunSignature, error) {
+	return signatureParser.ParseString("signature", input)
+}
 
+func ParseFromFile(path string) (*Program, error) {
 	r, err := os.Open(path)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	program, err := parser.Parse(path, r)
+	defer r.Close()
 
+	return Parse(path, r)
+}
+
+func Parse(filename string, r io.Reader) (*Program, error) {
+	source, err := io.ReadAll(r)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-
-	return program
+	return ParseString(filename, string(source))
 }
 
-func ParseFromFile(path string) (*Program, error) {
-	var myLexer = lexer.MustSimple([]lexer.SimpleRule{
-		{Name: "Keyword", Pattern: `\b(type|fun)\b`},
-		{Name: "Operator", Pattern: `->|\||:`},
-		{Name: "Ident", Pattern: `[a-zA-Z\+][a-zA-Z0-9_]*`},
-		// {Name: "TypeName", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "TypeGeneral", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "FunName", Pattern: `[a-zA-Z\+\-\*\/][a-zA-Z0-9_]*`},
-		// {Name: "VarName", Pattern: `[a-zA-Z][a-zA-Z0-9_]`},
-		{Name: "Int", Pattern: `[0-9]+`}, // TODO: remove leading zeroes
-		{Name: "Punct", Pattern: `[\[\]\(\)\.]`},
-		{Name: "whitespace", Pattern: `[ \t\n\r]+`},
-	})
-
-	parser := participle.MustBuild[Program](
-		participle.Lexer(myLexer),
-	)
-
-	r, err := os.Open(path)
+func ParseString(filename string, input string) (*Program, error) {
+	program, err := flParser.ParseString(filename, input)
 	if err != nil {
-		return nil, err
+		return program, err
 	}
-	program, err := parser.Parse(path, r)
+	comments, err := scanComments(filename, input)
 	if err != nil {
 		return nil, err
 	}
-
+	attachComments(program, input, comments)
+	desugarLists(program)
+	desugarRecords(program)
 	return program, nil
 }
 
@@ -267,7 +624,7 @@ type TypeDefKey struct {
 type ConstructorDefKey struct {
 	Name      string
 	Arity     int
-	Supertype *TypeDefKey
+	Supertype string
 }
 
 type FunctionDefKey struct {
@@ -280,6 +637,75 @@ type VariableDefKey struct {
 	Branch  int
 }
 
+var Builtins = []string{
+	"+",
+	"print",
+	"show",
+	"eq",
+	"compare",
+	"printNoNewline",
+	"printErr",
+	"readInt",
+	"readLine",
+	"concat",
+	"strlen",
+	"charAt",
+	"strcmp",
+	"intToString",
+	"stringToInt",
+	"assert",
+	"assertEq",
+}
+
+// builtinArities are the numbers of arguments the builtins take. + and
+// concat take any number and are not listed.
+var builtinArities = map[string]int{
+	"print":          1,
+	"show":           1,
+	"eq":             2,
+	"compare":        2,
+	"printNoNewline": 1,
+	"printErr":       1,
+	"readInt":        0,
+	"readLine":       0,
+	"strlen":         1,
+	"charAt":         2,
+	"strcmp":         2,
+	"intToString":    1,
+	"stringToInt":    1,
+	"assert":         1,
+	"assertEq":       2,
+}
+
+// BuiltinArity returns the number of arguments the builtin name takes, and
+// false if it takes any number or is not a builtin.
+func BuiltinArity(name string) (int, bool) {
+	arity, ok := builtinArities[name]
+	return arity, ok
+}
+
+func IsBuiltin(name string) bool {
+	for _, b := range Builtins {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
+
+type SemanticError struct {
+	Pos     lexer.Position
+	Message string
+}
+
+func (e *SemanticError) Error() string {
+	return fmt.Sprintf("pos %v\n%s", e.Pos, e.Message)
+}
+
+func semanticErrorf(pos lexer.Position, format string, args ...interface{}) *SemanticError {
+	return &SemanticError{Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
 func CheckSemantics(
 	node Node,
 	types map[TypeDefKey]interface{},
@@ -291,38 +717,301 @@ func CheckSemantics(
 ) error {
 	switch node := node.(type) {
 	case *Program:
+		tests := make(map[string]interface{})
 		for _, d := range node.Definitions {
 			if d.TypeDef != nil {
 				def := getTypeDefKey(d.TypeDef)
 				_, ok := types[*def]
 				if ok {
-					return fmt.Errorf(
-						"pos %v\ntype %v already declared",
+					return semanticErrorf(
 						d.TypeDef.Pos,
-						d.TypeDef,
+						"type %v already declared",
+						d.TypeDef.TypeName,
 					)
 				}
 				types[*def] = struct{}{}
 				for _, ta := range d.TypeDef.TypeAlternatives {
 					cdef := getConstructorDefKey(def, ta.Constructor)
-					_, ok := constructors[*cdef]
-					if ok {
-						return fmt.Errorf(
-							"pos %v\nconstructor %v already declared",
-							ta.Constructor.Pos,
-							ta.Constructor,
-						)
+					for key := range constructors {
+						if key.Name == cdef.Name && key.Supertype == cdef.Supertype {
+							return semanticErrorf(
+								ta.Constructor.Pos,
+								"constructor %v already declared in type %v",
+								ta.Constructor.Name,
+								cdef.Supertype,
+							)
+						}
 					}
 
-					constructors[*cdef] = struct{}{}
+					err := checkFields(ta.Constructor)
+					if err != nil {
+						return err
+					}
+					constructors[*cdef] = ta.Constructor
 				}
 			}
+			if d.FunDef != nil {
+				key := FunctionDefKey{Name: d.FunDef.Signature.Name}
+				if _, ok := functions[key]; ok || IsBuiltin(key.Name) {
+					return semanticErrorf(
+						d.FunDef.Signature.Pos,
+						"function %v already declared",
+						key.Name,
+					)
+				}
+				functions[key] = d.FunDef.Signature
+			}
+		}
+		for _, d := range node.Definitions {
+			if d.FunDef != nil {
+				err := CheckSemantics(d.FunDef, types, constructors, functions, variables)
+				if err != nil {
+					return err
+				}
+			}
+			if d.FunCall != nil {
+				err := checkExpression(&Expression{Pos: d.FunCall.Pos, FunCall: d.FunCall}, "", 0, constructors, functions, variables)
+				if err != nil {
+					return err
+				}
+			}
+			if d.Test != nil {
+				if _, ok := tests[d.Test.Name]; ok {
+					return semanticErrorf(d.Test.Pos, "test %q already declared", d.Test.Name)
+				}
+				tests[d.Test.Name] = struct{}{}
+				err := checkExpression(d.Test.Expression, "", 0, constructors, functions, variables)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case *FunDef:
+		name := node.Signature.Name
+		for i, rule := range node.Rules {
+			if rule.Pattern.FunName != name {
+				return semanticErrorf(
+					rule.Pattern.Pos,
+					"rule of function %v is declared as %v",
+					name,
+					rule.Pattern.FunName,
+				)
+			}
+			if len(rule.Pattern.Arguments) != len(node.Signature.Parameters) {
+				return semanticErrorf(
+					rule.Pattern.Pos,
+					"function %v expects %d arguments, rule has %d",
+					name,
+					len(node.Signature.Parameters),
+					len(rule.Pattern.Arguments),
+				)
+			}
+			for _, arg := range rule.Pattern.Arguments {
+				err := checkPattern(arg, name, i, constructors, variables)
+				if err != nil {
+					return err
+				}
+			}
+			err := checkExpression(rule.Expression, name, i, constructors, functions, variables)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
+func checkPattern(
+	p *PatternArgument,
+	funName string,
+	branch int,
+	constructors map[ConstructorDefKey]interface{},
+	variables map[VariableDefKey]interface{},
+) error {
+	switch {
+	case p.Variable != "":
+		key := VariableDefKey{FunName: funName, VarName: p.Variable, Branch: branch}
+		if _, ok := variables[key]; ok {
+			return semanticErrorf(p.Pos, "variable %v already bound", p.Variable)
+		}
+		variables[key] = struct{}{}
+	case p.Tuple != nil:
+		for _, element := range p.Tuple.Elements {
+			err := checkPattern(element, funName, branch, constructors, variables)
+			if err != nil {
+				return err
+			}
+		}
+	case p.IsRecord():
+		constructor, err := checkRecord(constructors, &p.Name)
+		if err != nil {
+			return err
+		}
+		if len(p.Arguments) != 0 {
+			return semanticErrorf(p.Pos, "record pattern %v binds fields only", p.Name.String())
+		}
+		for _, field := range p.Fields {
+			if !slices.Contains(constructor.FieldNames(), field) {
+				return semanticErrorf(p.Pos, "constructor %v has no field %v", p.Name.String(), field)
+			}
+			key := VariableDefKey{FunName: funName, VarName: field, Branch: branch}
+			if _, ok := variables[key]; ok {
+				return semanticErrorf(p.Pos, "variable %v already bound", field)
+			}
+			variables[key] = struct{}{}
+		}
+	case p.Name.Name != "":
+		err := checkConstructor(constructors, &p.Name, len(p.Arguments))
+		if err != nil {
+			return err
+		}
+		for _, arg := range p.Arguments {
+			err := checkPattern(arg, funName, branch, constructors, variables)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkExpression(
+	e *Expression,
+	funName string,
+	branch int,
+	constructors map[ConstructorDefKey]interface{},
+	functions map[FunctionDefKey]interface{},
+	variables map[VariableDefKey]interface{},
+) error {
+	var args []*Expression
+	switch {
+	case e.FunCall != nil:
+		call := e.FunCall
+		signature, ok := functions[FunctionDefKey{Name: call.Name}]
+		if _, bound := variables[VariableDefKey{FunName: funName, VarName: call.Name, Branch: branch}]; bound {
+			// a function passed as an argument, its arity is checked when it is called
+			signature, ok = nil, true
+		}
+		if !ok && !IsBuiltin(call.Name) {
+			return semanticErrorf(call.Pos, "unknown function %v", call.Name)
+		}
+		if signature, ok := signature.(*FunSignature); ok && len(signature.Parameters) != len(call.Arguments) {
+			return semanticErrorf(
+				call.Pos,
+				"function %v expects %d arguments, got %d",
+				call.Name,
+				len(signature.Parameters),
+				len(call.Arguments),
+			)
+		}
+		if arity, fixed := BuiltinArity(call.Name); !ok && fixed && arity != len(call.Arguments) {
+			return semanticErrorf(call.Pos, "function %v expects %d arguments, got %d", call.Name, arity, len(call.Arguments))
+		}
+		args = call.Arguments
+	case e.ExprConstructor != nil:
+		ec := e.ExprConstructor
+		err := checkConstructor(constructors, &ec.Name, len(ec.Arguments))
+		if err != nil {
+			return err
+		}
+		args = ec.Arguments
+	case e.Tuple != nil:
+		args = e.Tuple.Elements
+	case e.Field != nil:
+		if !e.Field.IsIndex() && !fieldDeclared(constructors, e.Field.Field) {
+			return semanticErrorf(e.Pos, "unknown field %v", e.Field.Field)
+		}
+		args = []*Expression{e.Field.Value}
+	case e.Variable != "":
+		key := VariableDefKey{FunName: funName, VarName: e.Variable, Branch: branch}
+		_, isVariable := variables[key]
+		_, isFunction := functions[FunctionDefKey{Name: e.Variable}]
+		if !isVariable && !isFunction {
+			return semanticErrorf(e.Pos, "unknown variable %v", e.Variable)
 		}
 	}
+	for _, arg := range args {
+		err := checkExpression(arg, funName, branch, constructors, functions, variables)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConstructor resolves a constructor reference. An unqualified name
+// declared in several types is ambiguous and has to be qualified with the
+// type name.
+func checkConstructor(constructors map[ConstructorDefKey]interface{}, name *ConstructorName, arity int) error {
+	matches := []string{}
+	var match ConstructorDefKey
+	for key := range constructors {
+		if key.Name == name.Name && (name.Type == "" || key.Supertype == name.Type) {
+			matches = append(matches, key.Supertype+"."+key.Name)
+			match = key
+		}
+	}
+	switch {
+	case len(matches) > 1:
+		sort.Strings(matches)
+		return semanticErrorf(name.Pos, "ambiguous constructor %v, use one of %s", name, strings.Join(matches, ", "))
+	case len(matches) == 0 || match.Arity != arity:
+		return semanticErrorf(name.Pos, "unknown constructor %v with %d arguments", name, arity)
+	}
+	return nil
+}
+
+// checkRecord resolves the constructor of a record pattern. The pattern
+// names only some of the fields, so the constructor is found by its name.
+func checkRecord(constructors map[ConstructorDefKey]interface{}, name *ConstructorName) (*Constructor, error) {
+	matches := []string{}
+	var match *Constructor
+	for key, value := range constructors {
+		if key.Name == name.Name && (name.Type == "" || key.Supertype == name.Type) {
+			matches = append(matches, key.Supertype+"."+key.Name)
+			match, _ = value.(*Constructor)
+		}
+	}
+	switch {
+	case len(matches) > 1:
+		sort.Strings(matches)
+		return nil, semanticErrorf(name.Pos, "ambiguous constructor %v, use one of %s", name, strings.Join(matches, ", "))
+	case len(matches) == 0:
+		return nil, semanticErrorf(name.Pos, "unknown constructor %v", name)
+	case match == nil || len(match.Fields) == 0:
+		return nil, semanticErrorf(name.Pos, "constructor %v is not a record", name)
+	}
+	return match, nil
+}
+
+// checkFields rejects records that also have positional parameters or
+// declare a field twice.
+func checkFields(c *Constructor) error {
+	if len(c.Fields) == 0 {
+		return nil
+	}
+	if len(c.Parameters) != len(c.Fields) {
+		return semanticErrorf(c.Pos, "record %v cannot have positional parameters", c.Name)
+	}
+	names := map[string]bool{}
+	for _, field := range c.Fields {
+		if names[field.Name] {
+			return semanticErrorf(field.Pos, "field %v already declared in %v", field.Name, c.Name)
+		}
+		names[field.Name] = true
+	}
 	return nil
 }
 
+func fieldDeclared(constructors map[ConstructorDefKey]interface{}, name string) bool {
+	for _, value := range constructors {
+		if c, ok := value.(*Constructor); ok && slices.Contains(c.FieldNames(), name) {
+			return true
+		}
+	}
+	return false
+}
+
 func getTypeDefKey(t *TypeDef) *TypeDefKey {
 	return &TypeDefKey{
 		Name:  t.TypeName.Name,
@@ -334,6 +1023,6 @@ func getConstructorDefKey(supertype *TypeDefKey, c *Constructor) *ConstructorDef
 	return &ConstructorDefKey{
 		Name:      c.Name,
 		Arity:     len(c.Parameters),
-		Supertype: supertype,
+		Supertype: supertype.Name,
 	}
 }
@@ -1,31 +1,12 @@
 package ast
 
 import (
+	"strings"
 	"testing"
-
-	"github.com/alecthomas/participle/v2"
-	"github.com/alecthomas/participle/v2/lexer"
 )
 
 func parse(input string) *Program {
-
-	var myLexer = lexer.MustSimple([]lexer.SimpleRule{
-		{Name: "Keyword", Pattern: `\b(type|fun)\b`},
-		{Name: "Operator", Pattern: `->|\||:`},
-		{Name: "Ident", Pattern: `[a-zA-Z\+][a-zA-Z0-9_]*`},
-		// {Name: "TypeName", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "TypeGeneral", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "FunName", Pattern: `[a-zA-Z\+\-\*\/][a-zA-Z0-9_]*`},
-		// {Name: "VarName", Pattern: `[a-zA-Z][a-zA-Z0-9_]`},
-		{Name: "Int", Pattern: `[0-9]+`}, // TODO: remove leading zeroes
-		{Name: "Punct", Pattern: `[\[\]\(\)\.]`},
-		{Name: "whitespace", Pattern: `[ \t\n\r]+`},
-	}) // TODO: to config
-
-	parser := participle.MustBuild[Program](
-		participle.Lexer(myLexer),
-	)
-	program, _ := parser.ParseString("tests", input)
+	program, _ := ParseString("tests", input)
 	return program
 }
 
@@ -55,6 +36,187 @@ func TestCheckSemantics(t *testing.T) {
 			`,
 			expectError: true,
 		},
+		{
+			name: "function with known references",
+			input: `
+			type [List x]: Cons x [List x] | Nil .
+			fun (sum [List Int]) -> Int :
+			(sum [Cons x xs]) -> (+ x (sum xs)) |
+			(sum [Nil]) -> 0 .
+			(print (sum [Cons 1 [Nil]]))
+			`,
+			expectError: false,
+		},
+		{
+			name: "function declared twice",
+			input: `
+			fun (test) -> Int : (test) -> 0 .
+			fun (test) -> Int : (test) -> 1 .
+			`,
+			expectError: true,
+		},
+		{
+			name:        "unknown function",
+			input:       `(print (sum 1))`,
+			expectError: true,
+		},
+		{
+			name:        "builtin with too many arguments",
+			input:       `(print (strlen "a" "bc"))`,
+			expectError: true,
+		},
+		{
+			name:        "print with two arguments",
+			input:       `(print 1 2)`,
+			expectError: true,
+		},
+		{
+			name: "unknown constructor in pattern",
+			input: `
+			type [List x]: Nil .
+			fun (sum [List Int]) -> Int : (sum [Cons x xs]) -> 0 .
+			`,
+			expectError: true,
+		},
+		{
+			name:        "unknown variable",
+			input:       `fun (id Int) -> Int : (id x) -> y .`,
+			expectError: true,
+		},
+		{
+			name: "same constructor name in two types",
+			input: `
+			type [A]: Leaf .
+			type [B]: Leaf | Node .
+			fun (f [B]) -> Int : (f [B.Leaf]) -> 0 | (f [Node]) -> 1 .
+			(f [B.Leaf])
+			`,
+			expectError: false,
+		},
+		{
+			name: "ambiguous constructor",
+			input: `
+			type [A]: Leaf .
+			type [B]: Leaf | Node .
+			(print [Leaf])
+			`,
+			expectError: true,
+		},
+		{
+			name: "ambiguous constructor in pattern",
+			input: `
+			type [A]: Leaf .
+			type [B]: Leaf | Node .
+			fun (f [B]) -> Int : (f [Leaf]) -> 0 .
+			`,
+			expectError: true,
+		},
+		{
+			name: "constructor qualified with wrong type",
+			input: `
+			type [A]: Leaf .
+			type [B]: Node .
+			(print [B.Leaf])
+			`,
+			expectError: true,
+		},
+		{
+			name: "same constructor name with different arity in one type",
+			input: `
+			type [A]: Leaf | Leaf Int .
+			`,
+			expectError: true,
+		},
+		{
+			name:        "wrong arguments amount",
+			input:       `fun (id Int) -> Int : (id x) -> (id x x) .`,
+			expectError: true,
+		},
+		{
+			name: "tests",
+			input: `
+			fun (id Int) -> Int : (id x) -> x .
+			test "id": (assertEq 1 (id 1)) .
+			test "positive": (assert (id 1)) .
+			`,
+			expectError: false,
+		},
+		{
+			name: "test declared twice",
+			input: `
+			test "same": (assert 1) .
+			test "same": (assert 1) .
+			`,
+			expectError: true,
+		},
+		{
+			name:        "unknown function in test",
+			input:       `test "unknown": (assert (f 1)) .`,
+			expectError: true,
+		},
+		{
+			name: "function as a value",
+			input: `
+			fun (twice [Fun Int Int] Int) -> Int : (twice f x) -> (f (f x)) .
+			fun (inc Int) -> Int : (inc x) -> (+ x 1) .
+			(print (twice inc 1))
+			`,
+			expectError: false,
+		},
+		{
+			name:        "unknown function as a value",
+			input:       `fun (apply [Fun Int Int]) -> Int : (apply f) -> (f 1) . (print (apply inc))`,
+			expectError: true,
+		},
+		{
+			name: "tuples and records",
+			input: `
+			type [P]: P {a: Int, b: String} .
+			fun (swap (, x y)) -> (, y x) : (swap (, l r)) -> (, r l) .
+			fun (get [P]) -> String : (get [P: b]) -> b .
+			(print (swap (, (.a [P 1 "x"]) (get [P 2 "y"]))))
+			`,
+			expectError: false,
+		},
+		{
+			name:        "field declared twice",
+			input:       `type [P]: P {a: Int, a: String} .`,
+			expectError: true,
+		},
+		{
+			name:        "record with positional parameters",
+			input:       `type [P]: P {a: Int} Int .`,
+			expectError: true,
+		},
+		{
+			name: "record pattern of a plain constructor",
+			input: `
+			type [P]: P Int .
+			fun (get [P]) -> Int : (get [P: a]) -> a .
+			`,
+			expectError: true,
+		},
+		{
+			name: "record pattern with an unknown field",
+			input: `
+			type [P]: P {a: Int} .
+			fun (get [P]) -> Int : (get [P: b]) -> b .
+			`,
+			expectError: true,
+		},
+		{
+			name: "unknown field",
+			input: `
+			type [P]: P {a: Int} .
+			(print (.b [P 1]))
+			`,
+			expectError: true,
+		},
+		{
+			name:        "unbound variable in a tuple",
+			input:       `(print (, 1 x))`,
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -78,3 +240,113 @@ func TestCheckSemantics(t *testing.T) {
 	}
 
 }
+
+func TestComments(t *testing.T) {
+	input := `-- list type
+type [List x]: Cons x [List x] | Nil .
+{- sums
+   {- nested -} -}
+fun (sum [List Int]) -> Int :
+    (sum [Cons x xs]) -> (+ x (sum xs)) |
+    -- base case
+    (sum [Nil]) -> 0 .
+(sum [Nil]) -- no newline`
+
+	program, err := ParseString("tests", input)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	typeDef := program.Definitions[0].TypeDef
+	if len(typeDef.Comments) != 1 || typeDef.Comments[0].Text != "-- list type" {
+		t.Errorf("wrong type comments %+v", typeDef.Comments)
+	}
+	funDef := program.Definitions[1].FunDef
+	if len(funDef.Comments) != 1 || funDef.Comments[0].Text != "{- sums\n   {- nested -} -}" {
+		t.Errorf("wrong function comments %+v", funDef.Comments)
+	}
+	if funDef.Comments[0].Pos.Line != 3 || funDef.Comments[0].Pos.Column != 1 {
+		t.Errorf("wrong comment position %+v", funDef.Comments[0].Pos)
+	}
+	if len(funDef.Rules[0].Comments) != 0 ||
+		len(funDef.Rules[1].Comments) != 1 ||
+		funDef.Rules[1].Comments[0].Text != "-- base case" {
+		t.Errorf("wrong rule comments %+v %+v", funDef.Rules[0].Comments, funDef.Rules[1].Comments)
+	}
+	if len(program.Comments) != 0 {
+		t.Errorf("wrong program comments %+v", program.Comments)
+	}
+	trailing := program.Definitions[2].Trailing
+	if len(trailing) != 1 || trailing[0].Text != "-- no newline" {
+		t.Errorf("wrong trailing comments %+v", trailing)
+	}
+	if program.Definitions[2].FunCall.Pos.Line != 9 {
+		t.Errorf("wrong call position %+v", program.Definitions[2].FunCall.Pos)
+	}
+
+	_, err = ParseString("tests", "{- {- -}\n(sum [Nil])")
+	if err == nil || !strings.Contains(err.Error(), "unterminated block comment") {
+		t.Errorf("expected unterminated comment error, got %v", err)
+	}
+}
+
+func TestCommentsStayInDefinitions(t *testing.T) {
+	input := `type [Shape]: -- shapes
+    Circle Int | -- round
+    Square Int .
+fun (f Int) -> Int : -- increments
+    (f x) -> (+ 1 {- inner -} x) .
+-- call
+(print (f 1))
+-- the end`
+
+	program, err := ParseString("tests", input)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	text := func(comments []*Comment) string {
+		texts := []string{}
+		for _, c := range comments {
+			texts = append(texts, c.Text)
+		}
+		return strings.Join(texts, " ")
+	}
+	typeDef := program.Definitions[0].TypeDef
+	funDef := program.Definitions[1].FunDef
+	tests := []struct {
+		comments []*Comment
+		expected string
+	}{
+		{typeDef.Trailing, "-- shapes"},
+		{typeDef.TypeAlternatives[0].Trailing, "-- round"},
+		{funDef.Signature.Trailing, "-- increments"},
+		{funDef.Rules[0].Expression.FunCall.Arguments[1].Comments, "{- inner -}"},
+		{program.Definitions[2].Comments, "-- call"},
+		{program.Comments, "-- the end"},
+	}
+	for i, tt := range tests {
+		if text(tt.comments) != tt.expected {
+			t.Errorf("wrong comments %d: expected %q, got %q", i, tt.expected, text(tt.comments))
+		}
+	}
+}
+
+func TestTypeDefConstructors(t *testing.T) {
+	program, err := ParseString("tests", `type [List x]: Cons {head: x, tail: [List x]} | Nil .`)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	constructors := program.Definitions[0].TypeDef.Constructors()
+	if len(constructors) != 2 {
+		t.Fatalf("expected 2 constructors, got %d", len(constructors))
+	}
+	cons, empty := constructors[0], constructors[1]
+	if cons.Name != "Cons" || cons.Arity != 2 || cons.Supertype != "List" || cons.Tag != 0 || !cons.List {
+		t.Errorf("wrong constructor %+v", cons)
+	}
+	if strings.Join(cons.Fields, " ") != "head tail" {
+		t.Errorf("wrong fields %v", cons.Fields)
+	}
+	if empty.Name != "Nil" || empty.Arity != 0 || empty.Tag != 1 {
+		t.Errorf("wrong constructor %+v", empty)
+	}
+}
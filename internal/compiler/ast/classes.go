@@ -0,0 +1,140 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// ClassDef declares a type class, the methods every instance of the class
+// implements for its type:
+//
+//	class [Show a] : (show [a]) -> String .
+type ClassDef struct {
+	Pos    lexer.Position
+	EndPos lexer.Position
+
+	Name     string             `"class" "[" @Ident`
+	Variable string             `@Ident "]" ":"`
+	Methods  []*MethodSignature `@@ ("|" @@)* "."`
+	Comments []*Comment
+	// Trailing are the comments after the header, before the methods.
+	Trailing []*Comment
+}
+
+func (cd *ClassDef) String() string {
+	var out strings.Builder
+	out.WriteString(formatComments(cd.Comments, ""))
+	fmt.Fprintf(&out, "class [%s %s] :%s", cd.Name, cd.Variable, formatTrailing(cd.Trailing, ""))
+	for i, m := range cd.Methods {
+		out.WriteString("\n" + formatComments(m.Comments, indent) + indent + m.String())
+		if i+1 < len(cd.Methods) {
+			out.WriteString(" |" + formatTrailing(m.Trailing, indent))
+		}
+	}
+	out.WriteString(" .")
+	if len(cd.Methods) > 0 {
+		out.WriteString(formatTrailing(cd.Methods[len(cd.Methods)-1].Trailing, indent))
+	}
+	return out.String()
+}
+
+// Method returns the method called name, or nil.
+func (cd *ClassDef) Method(name string) *MethodSignature {
+	for _, m := range cd.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// MethodSignature is a function signature inside a class, without the fun
+// keyword.
+type MethodSignature struct {
+	Pos    lexer.Position
+	EndPos lexer.Position
+
+	Name       string        `"(" @Ident`
+	Parameters []*TypeCommon `@@* ")" "->"`
+	ReturnType *TypeCommon   `@@`
+	Comments   []*Comment
+	Trailing   []*Comment
+}
+
+func (ms *MethodSignature) String() string {
+	parts := []string{ms.Name}
+	for _, p := range ms.Parameters {
+		parts = append(parts, p.String())
+	}
+	return fmt.Sprintf("(%s) -> %s", strings.Join(parts, " "), ms.ReturnType)
+}
+
+// InstanceDef implements the methods of a class for a type. The rules are
+// written like the rules of a function, one method after another:
+//
+//	instance [Show [List a]] where [Show a] :
+//	    (show {})        -> "" |
+//	    (show {x | xs})  -> (concat (show x) " " (show xs)) .
+type InstanceDef struct {
+	Pos    lexer.Position
+	EndPos lexer.Position
+
+	Class       string         `"instance" "[" @Ident`
+	Type        *TypeParameter `@@ "]"`
+	Constraints []*Constraint  `( "where" @@+ )? ":"`
+	Rules       []*FunRule     `@@ ("|" @@)* "."`
+	Comments    []*Comment
+	// Trailing are the comments after the header, before the rules.
+	Trailing []*Comment
+}
+
+func (id *InstanceDef) String() string {
+	var out strings.Builder
+	out.WriteString(formatComments(id.Comments, ""))
+	fmt.Fprintf(&out, "instance [%s %s]%s :%s", id.Class, id.Type, formatConstraints(id.Constraints), formatTrailing(id.Trailing, ""))
+	out.WriteString(formatRules(id.Rules))
+	return out.String()
+}
+
+// Head is the name of the type the instance is declared for: the builtin
+// type or the name of the defined type, without its parameters. It is
+// empty for tuples, which have no instances.
+func (id *InstanceDef) Head() string {
+	switch {
+	case id.Type.TypeBuiltin != nil:
+		return id.Type.TypeBuiltin.Type
+	case id.Type.TypeGeneral != nil:
+		return id.Type.TypeGeneral.Name
+	case id.Type.TypeCommon.TypeBuiltin != nil:
+		return id.Type.TypeCommon.TypeBuiltin.Type
+	case id.Type.TypeCommon.TypeName != nil:
+		return id.Type.TypeCommon.TypeName.Name
+	}
+	return ""
+}
+
+// Constraint requires a type variable to have an instance of a class:
+// [Show a].
+type Constraint struct {
+	Pos lexer.Position
+
+	Class    string `"[" @Ident`
+	Variable string `@Ident "]"`
+}
+
+func (c *Constraint) String() string {
+	return "[" + c.Class + " " + c.Variable + "]"
+}
+
+func formatConstraints(constraints []*Constraint) string {
+	if len(constraints) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for _, c := range constraints {
+		parts = append(parts, c.String())
+	}
+	return " where " + strings.Join(parts, " ")
+}
@@ -0,0 +1,330 @@
+package ast
+
+import (
+	"io"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// Comment is a `-- line` or a `{- block -}` comment. Text holds the
+// comment exactly as written, delimiters included.
+type Comment struct {
+	Pos  lexer.Position
+	Text string
+}
+
+func (c *Comment) String() string { return c.Text }
+
+// commentLexer skips comments before handing the source to the token
+// lexer. Comments are replaced with blanks rather than cut out, so token
+// positions still point into the original source.
+type commentLexer struct {
+	*lexer.StatefulDefinition
+}
+
+func (l *commentLexer) Lex(filename string, r io.Reader) (lexer.Lexer, error) {
+	source, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return l.LexString(filename, string(source))
+}
+
+func (l *commentLexer) LexString(filename string, source string) (lexer.Lexer, error) {
+	comments, err := scanComments(filename, source)
+	if err != nil {
+		return nil, err
+	}
+	return l.StatefulDefinition.LexString(filename, blankComments(source, comments))
+}
+
+func scanComments(filename string, source string) ([]*Comment, error) {
+	comments := []*Comment{}
+	pos := lexer.Position{Filename: filename, Line: 1, Column: 1}
+	last := 0
+	i := 0
+	for i < len(source) {
+		var end int
+		switch {
+		case strings.HasPrefix(source[i:], "--"):
+			end = strings.IndexByte(source[i:], '\n')
+			if end < 0 {
+				end = len(source)
+			} else {
+				end += i
+			}
+		case strings.HasPrefix(source[i:], "{-"):
+			end = blockCommentEnd(source, i)
+			if end < 0 {
+				pos.Advance(source[last:i])
+				return nil, &lexer.Error{Msg: "unterminated block comment", Pos: pos}
+			}
+		case source[i] == '"' || source[i] == '\'':
+			i = literalEnd(source, i)
+			continue
+		default:
+			i++
+			continue
+		}
+		pos.Advance(source[last:i])
+		last = i
+		comments = append(comments, &Comment{Pos: pos, Text: source[i:end]})
+		i = end
+	}
+	return comments, nil
+}
+
+// blockCommentEnd returns the offset right after the `-}` closing the
+// block comment that starts at offset start, or -1 if it is never closed.
+func blockCommentEnd(source string, start int) int {
+	depth := 0
+	i := start
+	for i < len(source) {
+		switch {
+		case strings.HasPrefix(source[i:], "{-"):
+			depth++
+			i += 2
+		case strings.HasPrefix(source[i:], "-}"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// literalEnd skips the string or char literal starting at offset start, so
+// that comment delimiters inside literals are left alone.
+func literalEnd(source string, start int) int {
+	quote := source[start]
+	i := start + 1
+	for i < len(source) && source[i] != quote && source[i] != '\n' {
+		if source[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	return min(i+1, len(source))
+}
+
+func blankComments(source string, comments []*Comment) string {
+	blanked := []byte(source)
+	for _, c := range comments {
+		for i := c.Pos.Offset; i < c.Pos.Offset+len(c.Text); i++ {
+			if blanked[i] != '\n' {
+				blanked[i] = ' '
+			}
+		}
+	}
+	return string(blanked)
+}
+
+// attachComments hands every comment to the node it documents, so that
+// comments stay inside the definition they are written in:
+//
+//   - comments in front of a definition go to the definition;
+//   - comments on their own line in front of a rule, an alternative of a
+//     type or a method of a class go to it;
+//   - comments that end a line, or that sit between the tokens of a rule,
+//     an alternative or a method, follow it on its line;
+//   - comments at the end of the header of a definition, before its first
+//     rule, alternative or method, follow the header;
+//   - block comments inside an expression go in front of the expression
+//     that follows them.
+//
+// Only the comments at the end of the file are kept in Program.Comments.
+func attachComments(p *Program, source string, comments []*Comment) {
+	blanked := blankComments(source, comments)
+	i := 0
+	for _, d := range p.Definitions {
+		leading := []*Comment{}
+		for i < len(comments) && comments[i].Pos.Offset < d.Pos.Offset {
+			leading = append(leading, comments[i])
+			i++
+		}
+		switch {
+		case d.TypeDef != nil:
+			d.TypeDef.Comments = leading
+		case d.FunDef != nil:
+			d.FunDef.Comments = leading
+		case d.Class != nil:
+			d.Class.Comments = leading
+		case d.Instance != nil:
+			d.Instance.Comments = leading
+		default:
+			d.Comments = leading
+		}
+
+		end := lastTokenEnd(blanked, d.EndPos.Offset)
+		for i < len(comments) && comments[i].Pos.Offset < end {
+			attachInner(d, blanked, comments[i])
+			i++
+		}
+		for i < len(comments) && !strings.Contains(blanked[end:comments[i].Pos.Offset], "\n") {
+			d.Trailing = append(d.Trailing, comments[i])
+			i++
+		}
+	}
+	p.Comments = append(p.Comments, comments[i:]...)
+}
+
+func definitionRules(d *Definition) []*FunRule {
+	switch {
+	case d.FunDef != nil:
+		return d.FunDef.Rules
+	case d.Instance != nil:
+		return d.Instance.Rules
+	}
+	return nil
+}
+
+// attachInner attaches a comment written inside the definition d.
+func attachInner(d *Definition, source string, c *Comment) {
+	switch {
+	case d.TypeDef != nil:
+		alts := d.TypeDef.TypeAlternatives
+		starts, ends := make([]lexer.Position, len(alts)), make([]lexer.Position, len(alts))
+		for i, alt := range alts {
+			starts[i], ends[i] = alt.Pos, alt.EndPos
+		}
+		i, leading := place(source, c, starts, ends)
+		switch {
+		case i < 0:
+			d.TypeDef.Trailing = append(d.TypeDef.Trailing, c)
+		case leading:
+			alts[i].Comments = append(alts[i].Comments, c)
+		default:
+			alts[i].Trailing = append(alts[i].Trailing, c)
+		}
+	case d.Class != nil:
+		methods := d.Class.Methods
+		starts, ends := make([]lexer.Position, len(methods)), make([]lexer.Position, len(methods))
+		for i, m := range methods {
+			starts[i], ends[i] = m.Pos, m.EndPos
+		}
+		i, leading := place(source, c, starts, ends)
+		switch {
+		case i < 0:
+			d.Class.Trailing = append(d.Class.Trailing, c)
+		case leading:
+			methods[i].Comments = append(methods[i].Comments, c)
+		default:
+			methods[i].Trailing = append(methods[i].Trailing, c)
+		}
+	case d.FunDef != nil:
+		if !attachToRules(d.FunDef.Rules, source, c) {
+			d.FunDef.Signature.Trailing = append(d.FunDef.Signature.Trailing, c)
+		}
+	case d.Instance != nil:
+		if !attachToRules(d.Instance.Rules, source, c) {
+			d.Instance.Trailing = append(d.Instance.Trailing, c)
+		}
+	case d.FunCall != nil:
+		expression := &Expression{Pos: d.FunCall.Pos, FunCall: d.FunCall}
+		if !attachToExpression(expression, source, c) {
+			d.Trailing = append(d.Trailing, c)
+		}
+	case d.Test != nil:
+		if !attachToExpression(d.Test.Expression, source, c) {
+			d.Trailing = append(d.Trailing, c)
+		}
+	}
+}
+
+// attachToRules attaches c to one of rules, or reports that it belongs to
+// the header in front of them.
+func attachToRules(rules []*FunRule, source string, c *Comment) bool {
+	starts, ends := make([]lexer.Position, len(rules)), make([]lexer.Position, len(rules))
+	for i, rule := range rules {
+		starts[i], ends[i] = rule.Pos, rule.EndPos
+	}
+	i, leading := place(source, c, starts, ends)
+	switch {
+	case i < 0:
+		return false
+	case leading:
+		rules[i].Comments = append(rules[i].Comments, c)
+	case c.Pos.Offset < rules[i].Pattern.EndPos.Offset || !attachToExpression(rules[i].Expression, source, c):
+		rules[i].Trailing = append(rules[i].Trailing, c)
+	}
+	return true
+}
+
+// attachToExpression puts a block comment written between the tokens of e
+// in front of the subexpression that follows it. Comments at the end of a
+// line are left to the caller, since an expression is printed on one line.
+func attachToExpression(e *Expression, source string, c *Comment) bool {
+	_, after := lineAround(source, c)
+	if after == "" {
+		return false
+	}
+	var next *Expression
+	var find func(e *Expression)
+	find = func(e *Expression) {
+		if e.Pos.Offset > c.Pos.Offset && (next == nil || e.Pos.Offset < next.Pos.Offset) {
+			next = e
+		}
+		for _, sub := range e.subexpressions() {
+			find(sub)
+		}
+	}
+	find(e)
+	if next == nil {
+		return false
+	}
+	next.Comments = append(next.Comments, c)
+	return true
+}
+
+// place finds where c goes among the items of a definition, which start at
+// starts and end before ends: in front of item i when leading is true,
+// after it otherwise, or after the header of the definition when i is -1.
+func place(source string, c *Comment, starts, ends []lexer.Position) (int, bool) {
+	before, _ := lineAround(source, c)
+	ownLine := before == ""
+	if len(starts) == 0 {
+		return -1, false
+	}
+	if c.Pos.Offset < starts[0].Offset {
+		if ownLine {
+			return 0, true
+		}
+		return -1, false
+	}
+	i := 0
+	for i+1 < len(starts) && starts[i+1].Offset < c.Pos.Offset {
+		i++
+	}
+	if ownLine && i+1 < len(starts) && c.Pos.Offset >= lastTokenEnd(source, ends[i].Offset) {
+		return i + 1, true
+	}
+	return i, false
+}
+
+// lineAround returns what precedes and what follows c on its line, without
+// blanks; source has its comments blanked.
+func lineAround(source string, c *Comment) (string, string) {
+	lineStart := strings.LastIndexByte(source[:c.Pos.Offset], '\n') + 1
+	end := c.Pos.Offset + len(c.Text)
+	lineEnd := strings.IndexByte(source[end:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += end
+	}
+	return strings.TrimSpace(source[lineStart:c.Pos.Offset]), strings.TrimSpace(source[end:lineEnd])
+}
+
+// lastTokenEnd moves an EndPos offset, which points at the next token,
+// back to the end of the node's own last token.
+func lastTokenEnd(source string, offset int) int {
+	for offset > 0 && strings.ContainsRune(" \t\n\r", rune(source[offset-1])) {
+		offset--
+	}
+	return offset
+}
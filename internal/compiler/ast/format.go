@@ -0,0 +1,62 @@
+package ast
+
+import "strings"
+
+const indent = "    "
+
+// Format prints the program in canonical source form. Type definitions
+// and top-level calls are grouped together, function definitions are
+// separated by blank lines and their rules have aligned arrows. Comments
+// are printed with the node they are attached to, so they stay inside their
+// definition; the comments at the end of the file come last.
+func Format(p *Program) string {
+	var out strings.Builder
+	var previous *Definition
+	for _, d := range p.Definitions {
+		if previous != nil {
+			out.WriteString("\n")
+			if !sameGroup(previous, d) {
+				out.WriteString("\n")
+			}
+		}
+		out.WriteString(formatComments(d.Comments, ""))
+		out.WriteString(d.String() + formatTrailing(d.Trailing, ""))
+		previous = d
+	}
+	if previous != nil {
+		out.WriteString("\n")
+		if len(p.Comments) > 0 {
+			out.WriteString("\n")
+		}
+	}
+	out.WriteString(formatComments(p.Comments, ""))
+	return out.String()
+}
+
+func formatComments(comments []*Comment, prefix string) string {
+	var out strings.Builder
+	for _, c := range comments {
+		out.WriteString(prefix + c.String() + "\n")
+	}
+	return out.String()
+}
+
+// formatTrailing prints comments at the end of a line. A comment after a
+// line comment goes on the next line, starting with prefix.
+func formatTrailing(comments []*Comment, prefix string) string {
+	var out strings.Builder
+	for i, c := range comments {
+		if i > 0 && strings.HasPrefix(comments[i-1].Text, "--") {
+			out.WriteString("\n" + prefix + c.String())
+			continue
+		}
+		out.WriteString(" " + c.String())
+	}
+	return out.String()
+}
+
+func sameGroup(a, b *Definition) bool {
+	return (a.TypeDef != nil && b.TypeDef != nil) ||
+		(a.FunCall != nil && b.FunCall != nil) ||
+		(a.Test != nil && b.Test != nil)
+}
@@ -0,0 +1,308 @@
+package ast
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`type [List x]:Cons x [List x]|Nil.
+			type [Letter]: A | B | C | D .
+			fun (fab [List Letter]) -> [List Letter] :
+			(fab [Cons [A] xs]) -> [Cons [B] (fab xs)] |
+			(fab [Cons x xs]) -> [Cons x (fab xs)] | (fab [Nil]) -> [Nil] .
+			(print (fab [Cons [A] [Nil]]))`,
+			`type [List x]: Cons x [List x] | Nil .
+type [Letter]: A | B | C | D .
+
+fun (fab [List Letter]) -> [List Letter] :
+    (fab [Cons [A] xs]) -> [Cons [B] (fab xs)] |
+    (fab [Cons x xs])   -> [Cons x (fab xs)] |
+    (fab [Nil])         -> [Nil] .
+
+(print (fab [Cons [A] [Nil]]))
+`,
+		},
+		{
+			`fun (test Int Int) -> Int: (test x 0) -> 0 | (test x y) -> (+ x y 1).
+			fun (id [Pair [List Int] x]) -> [Pair [List Int] x]: (id p) -> p.
+			(test 2 3) (test 1 0)`,
+			`fun (test Int Int) -> Int :
+    (test x 0) -> 0 |
+    (test x y) -> (+ x y 1) .
+
+fun (id [Pair [List Int] x]) -> [Pair [List Int] x] :
+    (id p) -> p .
+
+(test 2 3)
+(test 1 0)
+`,
+		},
+		{
+			`fun (greet String Char) -> String : (greet "a\"b" '\n') -> (concat "{- x -}" 'c') .`,
+			`fun (greet String Char) -> String :
+    (greet "a\"b" '\n') -> (concat "{- x -}" 'c') .
+`,
+		},
+		{
+			`fun (firstTwo [List x]) -> [List x] : (firstTwo {x y|rest}) -> {x y} | (firstTwo {x}) -> { x } | (firstTwo { }) -> {} .
+			(print {1 {2} {- c -} | (firstTwo {3 4 5})})`,
+			`fun (firstTwo [List x]) -> [List x] :
+    (firstTwo {x y | rest}) -> {x y} |
+    (firstTwo {x})          -> {x} |
+    (firstTwo {})           -> {} .
+
+(print {1 {2} | {- c -} (firstTwo {3 4 5})})
+`,
+		},
+		{
+			`fun (id Int) -> Int : (id x) -> x .
+			test "id" : (assertEq 1 (id 1)).test "two":(assert 2) .
+			(id 3)`,
+			`fun (id Int) -> Int :
+    (id x) -> x .
+
+test "id": (assertEq 1 (id 1)) .
+test "two": (assert 2) .
+
+(id 3)
+`,
+		},
+		{
+			`type [Person]: Person {name:String,age: Int} .
+			fun (swap (,x y)) -> (, y x) : (swap (, a b)) -> (,b a) | (swap ( , )) -> (,) .
+			fun (greet [Person]) -> String : (greet [Person:name]) -> (. name [Person name (.0 (, 1))]) .`,
+			`type [Person]: Person {name: String, age: Int} .
+
+fun (swap (, x y)) -> (, y x) :
+    (swap (, a b)) -> (, b a) |
+    (swap (,))     -> (,) .
+
+fun (greet [Person]) -> String :
+    (greet [Person: name]) -> (.name [Person name (.0 (, 1))]) .
+`,
+		},
+		{
+			`class [Show a]:(show [a])->String.
+			class [Functor f] : (fmap [Fun a b] [f a]) -> [f b] | (replace [b] [f a]) -> [f b] .
+			instance [Show [List a]] where [Show a] [Eq a] : (show [Nil]) -> "" | (show [Cons x xs]) -> (show x) .
+			fun (both [a] [a]) -> String where [Show a] : (both x y) -> (concat (show x) (show y)) .`,
+			`class [Show a] :
+    (show [a]) -> String .
+
+class [Functor f] :
+    (fmap [Fun a b] [f a]) -> [f b] |
+    (replace [b] [f a]) -> [f b] .
+
+instance [Show [List a]] where [Show a] [Eq a] :
+    (show [Nil])       -> "" |
+    (show [Cons x xs]) -> (show x) .
+
+fun (both [a] [a]) -> String where [Show a] :
+    (both x y) -> (concat (show x) (show y)) .
+`,
+		},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		program, err := ParseString("tests", tt.input)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		actual := Format(program)
+		if actual != tt.expected {
+			t.Errorf("wrong formatting.\nexpected:\n%s\ngot:\n%s", tt.expected, actual)
+		}
+	}
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	paths, err := filepath.Glob("../../../samples/*")
+	if err != nil {
+		t.Fatalf("glob error: %s", err)
+	}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read error: %s", err)
+		}
+		program, err := ParseString(path, string(source))
+		if err != nil {
+			continue
+		}
+		once := Format(program)
+		reparsed, err := ParseString(path, once)
+		if err != nil {
+			t.Fatalf("%s: formatted program does not parse: %s\n%s", path, err, once)
+		}
+		twice := Format(reparsed)
+		if once != twice {
+			t.Errorf("%s: formatting is not idempotent.\nfirst:\n%s\nsecond:\n%s", path, once, twice)
+		}
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	input := `-- lists
+{- a {- nested -} block -}
+type [List x]: Cons x [List x] | Nil . -- trailing
+fun (len [List x]) -> Int :
+  -- empty
+  (len [Nil]) -> 0 |
+  {- non-empty -} (len [Cons x xs]) -> (+ 1 {- inner -} (len xs)) .
+-- call
+(len [Nil])
+-- the end`
+	expected := `-- lists
+{- a {- nested -} block -}
+type [List x]: Cons x [List x] | Nil . -- trailing
+
+fun (len [List x]) -> Int :
+    -- empty
+    (len [Nil])       -> 0 |
+    {- non-empty -}
+    (len [Cons x xs]) -> (+ 1 {- inner -} (len xs)) .
+
+-- call
+(len [Nil])
+
+-- the end
+`
+
+	program, err := ParseString("tests", input)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	actual := Format(program)
+	if actual != expected {
+		t.Fatalf("wrong formatting.\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+	reparsed, err := ParseString("tests", actual)
+	if err != nil {
+		t.Fatalf("formatted program does not parse: %s", err)
+	}
+	if Format(reparsed) != actual {
+		t.Errorf("formatting is not idempotent:\n%s", Format(reparsed))
+	}
+}
+
+func TestFormatEndOfLineComments(t *testing.T) {
+	input := `type [Bit]: Zero | One . -- two values
+fun (flip [Bit]) -> [Bit] : -- negation
+  (flip [Zero]) -> [One] | -- first
+  (flip [One]) -> {- last -} [Zero] . {- done -} -- flip
+(flip [One]) -- call
+`
+	expected := `type [Bit]: Zero | One . -- two values
+
+fun (flip [Bit]) -> [Bit] : -- negation
+    (flip [Zero]) -> [One] | -- first
+    (flip [One])  -> {- last -} [Zero] . {- done -} -- flip
+
+(flip [One]) -- call
+`
+
+	program, err := ParseString("tests", input)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	actual := Format(program)
+	if actual != expected {
+		t.Fatalf("wrong formatting.\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+	reparsed, err := ParseString("tests", actual)
+	if err != nil {
+		t.Fatalf("formatted program does not parse: %s", err)
+	}
+	if Format(reparsed) != actual {
+		t.Errorf("formatting is not idempotent:\n%s", Format(reparsed))
+	}
+}
+
+// TestFormatKeepsCommentsInside checks that comments stay in the
+// definition they are written in.
+func TestFormatKeepsCommentsInside(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"type [Shape]: Circle Int | -- round\n  Square Int .\ntype [Bit]: Zero | One .",
+			`type [Shape]:
+    Circle Int | -- round
+    Square Int .
+type [Bit]: Zero | One .
+`,
+		},
+		{
+			"type [Shape]: -- shapes\n  -- round\n  Circle Int |\n  Square {- four sides -} Int .",
+			`type [Shape]: -- shapes
+    -- round
+    Circle Int |
+    Square Int . {- four sides -}
+`,
+		},
+		{
+			"fun (f Int) -> Int : (f x) -> (+ 1 {- inner -} x) .\n(print (f 1))",
+			`fun (f Int) -> Int :
+    (f x) -> (+ 1 {- inner -} x) .
+
+(print (f 1))
+`,
+		},
+		{
+			"fun (f Int) -> Int : -- increments\n  (f x) -> (+ 1\n  -- one more\n  x) .\n(print (f 1))",
+			`fun (f Int) -> Int : -- increments
+    (f x) -> (+ 1 x) . -- one more
+
+(print (f 1))
+`,
+		},
+		{
+			"class [Size a] : -- things with a size\n  -- how big\n  (size [a]) -> Int .\n" +
+				"instance [Size Int] : -- numbers\n  (size n) -> n .",
+			`class [Size a] : -- things with a size
+    -- how big
+    (size [a]) -> Int .
+
+instance [Size Int] : -- numbers
+    (size n) -> n .
+`,
+		},
+		{
+			"-- first\n(print 1)\n(print\n  -- second\n  {- two -} 2)\ntest \"t\": (assertEq {- three -} 3 3) .",
+			`-- first
+(print 1)
+(print {- two -} 2) -- second
+
+test "t": (assertEq {- three -} 3 3) .
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		program, err := ParseString("tests", tt.input)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		actual := Format(program)
+		if actual != tt.expected {
+			t.Errorf("wrong formatting of %s.\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, actual)
+			continue
+		}
+		reparsed, err := ParseString("tests", actual)
+		if err != nil {
+			t.Fatalf("formatted program does not parse: %s", err)
+		}
+		if Format(reparsed) != actual {
+			t.Errorf("formatting is not idempotent:\n%s", Format(reparsed))
+		}
+	}
+}
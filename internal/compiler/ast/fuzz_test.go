@@ -0,0 +1,48 @@
+package ast
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// addSamples seeds a fuzz target with the programs from samples/.
+func addSamples(f *testing.F) {
+	paths, err := filepath.Glob("../../../samples/*")
+	if err != nil {
+		f.Fatalf("glob error: %s", err)
+	}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatalf("read error: %s", err)
+		}
+		f.Add(string(source))
+	}
+}
+
+// FuzzParse checks that no source makes the parser, the semantic checks or
+// the formatter panic, and that formatted programs parse again.
+func FuzzParse(f *testing.F) {
+	addSamples(f)
+	f.Add("{- unterminated")
+	f.Add(`(print "\"")`)
+	f.Fuzz(func(t *testing.T, source string) {
+		program, err := ParseString("fuzz", source)
+		if err != nil {
+			return
+		}
+		CheckSemantics(
+			program,
+			make(map[TypeDefKey]interface{}),
+			make(map[ConstructorDefKey]interface{}),
+			make(map[FunctionDefKey]interface{}),
+			make(map[VariableDefKey]interface{}),
+		)
+		formatted := Format(program)
+		_, err = ParseString("fuzz", formatted)
+		if err != nil {
+			t.Errorf("formatted program does not parse: %s\n%s", err, formatted)
+		}
+	})
+}
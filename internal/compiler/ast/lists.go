@@ -0,0 +1,150 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// ListCons and ListNil are the constructors list literals are built from:
+// those of the prelude List or of a List the program declares itself.
+const (
+	ListCons = "Cons"
+	ListNil  = "Nil"
+)
+
+// ListExpression is a list literal: {1 2 3} is [Cons 1 [Cons 2 [Cons 3
+// [Nil]]]] and {x | xs} is [Cons x xs].
+type ListExpression struct {
+	Pos lexer.Position
+
+	Elements []*Expression `"{" (@@+`
+	Tail     *Expression   `("|" @@)?)? "}"`
+}
+
+func (le *ListExpression) String() string {
+	parts := []string{}
+	for _, element := range le.Elements {
+		parts = append(parts, element.String())
+	}
+	if le.Tail != nil {
+		parts = append(parts, "|", le.Tail.String())
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// ListPattern matches lists like a list literal: {x y} matches lists of
+// exactly two elements, {x | rest} any list that is not empty and {} the
+// empty list.
+type ListPattern struct {
+	Pos lexer.Position
+
+	Elements []*PatternArgument `"{" (@@+`
+	Tail     *PatternArgument   `("|" @@)?)? "}"`
+}
+
+func (lp *ListPattern) String() string {
+	parts := []string{}
+	for _, element := range lp.Elements {
+		parts = append(parts, element.String())
+	}
+	if lp.Tail != nil {
+		parts = append(parts, "|", lp.Tail.String())
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// desugarLists replaces list literals and list patterns in the program with
+// the Cons and Nil constructors they stand for, keeping the literals for
+// printing.
+func desugarLists(p *Program) {
+	for _, d := range p.Definitions {
+		switch {
+		case d.FunDef != nil || d.Instance != nil:
+			for _, rule := range definitionRules(d) {
+				for _, arg := range rule.Pattern.Arguments {
+					desugarPattern(arg)
+				}
+				desugarExpression(rule.Expression)
+			}
+		case d.FunCall != nil:
+			for _, arg := range d.FunCall.Arguments {
+				desugarExpression(arg)
+			}
+		case d.Test != nil:
+			desugarExpression(d.Test.Expression)
+		}
+	}
+}
+
+func desugarExpression(e *Expression) {
+	var args []*Expression
+	switch {
+	case e.List != nil:
+		for _, element := range e.List.Elements {
+			desugarExpression(element)
+		}
+		list := e.List.Tail
+		if list == nil {
+			list = &Expression{Pos: e.List.Pos, ExprConstructor: &ExprConstructor{
+				Pos:  e.List.Pos,
+				Name: ConstructorName{Pos: e.List.Pos, Name: ListNil},
+			}}
+		} else {
+			desugarExpression(list)
+		}
+		for i := len(e.List.Elements) - 1; i >= 0; i-- {
+			element := e.List.Elements[i]
+			list = &Expression{Pos: element.Pos, ExprConstructor: &ExprConstructor{
+				Pos:       element.Pos,
+				Name:      ConstructorName{Pos: element.Pos, Name: ListCons},
+				Arguments: []*Expression{element, list},
+			}}
+		}
+		e.ExprConstructor = list.ExprConstructor
+		return
+	case e.FunCall != nil:
+		args = e.FunCall.Arguments
+	case e.ExprConstructor != nil:
+		args = e.ExprConstructor.Arguments
+	case e.Tuple != nil:
+		args = e.Tuple.Elements
+	case e.Field != nil:
+		args = []*Expression{e.Field.Value}
+	}
+	for _, arg := range args {
+		desugarExpression(arg)
+	}
+}
+
+func desugarPattern(p *PatternArgument) {
+	if p.List == nil {
+		for _, arg := range p.Arguments {
+			desugarPattern(arg)
+		}
+		if p.Tuple != nil {
+			for _, element := range p.Tuple.Elements {
+				desugarPattern(element)
+			}
+		}
+		return
+	}
+	for _, element := range p.List.Elements {
+		desugarPattern(element)
+	}
+	list := p.List.Tail
+	if list == nil {
+		list = &PatternArgument{Pos: p.List.Pos, Name: ConstructorName{Pos: p.List.Pos, Name: ListNil}}
+	} else {
+		desugarPattern(list)
+	}
+	for i := len(p.List.Elements) - 1; i >= 0; i-- {
+		element := p.List.Elements[i]
+		list = &PatternArgument{
+			Pos:       element.Pos,
+			Name:      ConstructorName{Pos: element.Pos, Name: ListCons},
+			Arguments: []*PatternArgument{element, list},
+		}
+	}
+	p.Name, p.Arguments = list.Name, list.Arguments
+}
@@ -0,0 +1,117 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// TupleType is the type of a tuple, (, Int String) for pairs of an Int and
+// a String.
+type TupleType struct {
+	Pos lexer.Position
+
+	Elements []*TypeParameter `"(" "," @@* ")"`
+}
+
+func (tt *TupleType) String() string {
+	parts := []string{"(,"}
+	for _, e := range tt.Elements {
+		parts = append(parts, e.String())
+	}
+	return strings.Join(parts, " ") + ")"
+}
+
+// TupleExpression builds a tuple: (, 1 "one").
+type TupleExpression struct {
+	Pos lexer.Position
+
+	Elements []*Expression `"(" "," @@* ")"`
+}
+
+func (te *TupleExpression) String() string {
+	parts := []string{"(,"}
+	for _, e := range te.Elements {
+		parts = append(parts, e.String())
+	}
+	return strings.Join(parts, " ") + ")"
+}
+
+// TuplePattern matches tuples of as many elements as it has.
+type TuplePattern struct {
+	Pos lexer.Position
+
+	Elements []*PatternArgument `"(" "," @@* ")"`
+}
+
+func (tp *TuplePattern) String() string {
+	parts := []string{"(,"}
+	for _, e := range tp.Elements {
+		parts = append(parts, e.String())
+	}
+	return strings.Join(parts, " ") + ")"
+}
+
+// FieldAccess reads a field of a record, (.name person), or an element of a
+// tuple by its index from zero, (.1 pair).
+type FieldAccess struct {
+	Pos lexer.Position
+
+	Field string      `"(" "." ( @Ident | @Int )`
+	Value *Expression `@@ ")"`
+}
+
+func (fa *FieldAccess) String() string {
+	return "(." + fa.Field + " " + fa.Value.String() + ")"
+}
+
+// IsIndex reports whether the access is a tuple index rather than a field
+// name.
+func (fa *FieldAccess) IsIndex() bool {
+	return fa.Field[0] >= '0' && fa.Field[0] <= '9'
+}
+
+// Field is a named field of a record constructor.
+type Field struct {
+	Pos lexer.Position
+
+	Name string                `@Ident ":"`
+	Type *ConstructorParameter `@@`
+}
+
+func (f *Field) String() string {
+	return f.Name + ": " + f.Type.String()
+}
+
+// IsRecord reports whether the pattern binds fields of a record by name.
+func (pa *PatternArgument) IsRecord() bool {
+	return pa.Record
+}
+
+// FieldNames returns the names of the fields of a record constructor and
+// nil for other constructors.
+func (c *Constructor) FieldNames() []string {
+	if len(c.Fields) == 0 {
+		return nil
+	}
+	names := make([]string, len(c.Fields))
+	for i, f := range c.Fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// desugarRecords copies the types of record fields into the parameters of
+// their constructors.
+func desugarRecords(p *Program) {
+	for _, d := range p.Definitions {
+		if d.TypeDef == nil {
+			continue
+		}
+		for _, alt := range d.TypeDef.TypeAlternatives {
+			for _, f := range alt.Constructor.Fields {
+				alt.Constructor.Parameters = append(alt.Constructor.Parameters, f.Type)
+			}
+		}
+	}
+}
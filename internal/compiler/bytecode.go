@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"encoding/gob"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/emrzvv/fl-compiler/internal/compiler/code"
@@ -14,7 +15,22 @@ import (
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
-	VarAmount    int
+	// VarAmount is the largest number of locals of a compiled function.
+	VarAmount int
+	Tests     []Test
+	// Natives are the names of the native functions called by OpCallNative,
+	// which the FVM looks up in its registry.
+	Natives []string
+}
+
+// Test is a compiled `test "name": expr .` definition. Its instructions
+// leave the value of the expression on the stack, like the main ones do
+// for top-level calls.
+type Test struct {
+	Name         string
+	Line         int
+	Column       int
+	Instructions code.Instructions
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
@@ -22,6 +38,8 @@ func (c *Compiler) Bytecode() *Bytecode {
 		Instructions: c.instructions,
 		Constants:    c.constants,
 		VarAmount:    c.varAmount,
+		Tests:        c.tests,
+		Natives:      c.natives,
 	}
 }
 
@@ -32,11 +50,16 @@ func (b *Bytecode) WriteToFile(path string) error {
 	}
 	defer file.Close()
 
-	err = binary.Write(file, binary.BigEndian, uint32(len(b.Instructions)))
+	return b.Write(file)
+}
+
+// Write encodes the bytecode in the format read by ReadBytecode.
+func (b *Bytecode) Write(w io.Writer) error {
+	err := binary.Write(w, binary.BigEndian, uint32(len(b.Instructions)))
 	if err != nil {
 		return err
 	}
-	_, err = file.Write(b.Instructions)
+	_, err = w.Write(b.Instructions)
 	if err != nil {
 		return err
 	}
@@ -44,20 +67,63 @@ func (b *Bytecode) WriteToFile(path string) error {
 	gob.Register(&object.Instance{})
 	gob.Register(&object.Integer{})
 	gob.Register(&object.CompiledFunction{})
+	gob.Register(&object.String{})
+	gob.Register(&object.Char{})
+	gob.Register(&object.BigInteger{})
 
 	constantsData, err := b.serializeConstants()
 	if err != nil {
 		return err
 	}
-	err = binary.Write(file, binary.BigEndian, uint32(len(constantsData)))
+	err = binary.Write(w, binary.BigEndian, uint32(len(constantsData)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(constantsData)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.BigEndian, uint32(b.VarAmount))
+	if err != nil {
+		return err
+	}
+	err = writeGobSection(w, b.Tests)
+	if err != nil {
+		return err
+	}
+	return writeGobSection(w, b.Natives)
+}
+
+// writeGobSection writes value gob-encoded with a length prefix, to be read
+// by readGobSection.
+func writeGobSection(w io.Writer, value any) error {
+	var section bytes.Buffer
+	err := gob.NewEncoder(&section).Encode(value)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.BigEndian, uint32(section.Len()))
 	if err != nil {
 		return err
 	}
-	_, err = file.Write(constantsData)
-	binary.Write(file, binary.BigEndian, uint32(b.VarAmount))
+	_, err = w.Write(section.Bytes())
 	return err
 }
 
+// readGobSection decodes a section written by writeGobSection into value.
+// Sections added to the format later are missing from older files, so it
+// leaves value as it is at the end of the input.
+func readGobSection(r io.Reader, value any) error {
+	data, err := readSection(r)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
+
 // func (b *Bytecode) serializeConstants() ([]byte, error) {
 // 	var buffer bytes.Buffer
 
@@ -106,6 +172,27 @@ func (b *Bytecode) serializeConstants() ([]byte, error) {
 			if err := encoder.Encode(constant); err != nil {
 				return nil, err
 			}
+		case *object.String:
+			if err := encoder.Encode(object.STRING_OBJ); err != nil {
+				return nil, err
+			}
+			if err := encoder.Encode(constant); err != nil {
+				return nil, err
+			}
+		case *object.Char:
+			if err := encoder.Encode(object.CHAR_OBJ); err != nil {
+				return nil, err
+			}
+			if err := encoder.Encode(constant); err != nil {
+				return nil, err
+			}
+		case *object.BigInteger:
+			if err := encoder.Encode(object.BIG_INTEGER_OBJ); err != nil {
+				return nil, err
+			}
+			if err := encoder.Encode(constant); err != nil {
+				return nil, err
+			}
 		default:
 			return nil, fmt.Errorf("unsupported constant type: %T", constant)
 		}
@@ -121,50 +208,75 @@ func ReadFromFile(filename string) (*Bytecode, error) {
 	}
 	defer file.Close()
 
-	var instructionCount uint32
-	err = binary.Read(file, binary.BigEndian, &instructionCount)
-	if err != nil {
-		return nil, err
-	}
-
-	instructions := make([]byte, instructionCount)
-	_, err = file.Read(instructions)
-	if err != nil {
-		return nil, err
-	}
+	return ReadBytecode(file)
+}
 
-	var constantsSize uint32
-	err = binary.Read(file, binary.BigEndian, &constantsSize)
+// ReadBytecode decodes bytecode written by Bytecode.Write. Malformed input
+// results in an error; the bytecode is not checked to be safe to run, which
+// is what vm.Verify is for.
+func ReadBytecode(r io.Reader) (*Bytecode, error) {
+	instructions, err := readSection(r)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error when reading instructions: %w", err)
 	}
-
-	constantsData := make([]byte, constantsSize)
-	_, err = file.Read(constantsData)
+	constantsData, err := readSection(r)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error when reading constants: %w", err)
 	}
 	gob.Register(&object.Integer{})
 	gob.Register(&object.CompiledFunction{})
 	gob.Register(&object.Constructor{})
 	gob.Register(&object.Instance{})
+	gob.Register(&object.String{})
+	gob.Register(&object.Char{})
+	gob.Register(&object.BigInteger{})
 
 	constants, err := deserializeConstants(constantsData)
 	if err != nil {
 		return nil, err
 	}
 	var varAmount uint32
-	err = binary.Read(file, binary.BigEndian, &varAmount)
+	err = binary.Read(r, binary.BigEndian, &varAmount)
 	if err != nil {
 		return nil, err
 	}
+	var tests []Test
+	err = readGobSection(r, &tests)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading tests: %w", err)
+	}
+	var natives []string
+	err = readGobSection(r, &natives)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading native functions: %w", err)
+	}
 	return &Bytecode{
 		Instructions: code.Instructions(instructions),
 		Constants:    constants,
 		VarAmount:    int(varAmount),
+		Tests:        tests,
+		Natives:      natives,
 	}, nil
 }
 
+// readSection reads a length-prefixed block. The block is read in pieces,
+// so a corrupted length cannot make it allocate more than the input holds.
+func readSection(r io.Reader) ([]byte, error) {
+	var size uint32
+	err := binary.Read(r, binary.BigEndian, &size)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(size)))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != int(size) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
 // func deserializeConstants(data []byte) ([]object.Object, error) {
 // 	buffer := bytes.NewBuffer(data)
 
@@ -217,6 +329,24 @@ func deserializeConstants(data []byte) ([]object.Object, error) {
 				return nil, err
 			}
 			constants = append(constants, &instance)
+		case object.STRING_OBJ:
+			var str object.String
+			if err := decoder.Decode(&str); err != nil {
+				return nil, err
+			}
+			constants = append(constants, &str)
+		case object.CHAR_OBJ:
+			var char object.Char
+			if err := decoder.Decode(&char); err != nil {
+				return nil, err
+			}
+			constants = append(constants, &char)
+		case object.BIG_INTEGER_OBJ:
+			var integer object.BigInteger
+			if err := decoder.Decode(&integer); err != nil {
+				return nil, err
+			}
+			constants = append(constants, &integer)
 		default:
 			return nil, fmt.Errorf("unknown object type %s", objType)
 		}
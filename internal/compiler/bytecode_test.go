@@ -3,6 +3,7 @@ package compiler
 import (
 	"encoding/gob"
 	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/emrzvv/fl-compiler/internal/compiler/code"
@@ -20,6 +21,10 @@ func TestSerialization(t *testing.T) {
 				&object.Integer{Value: 2},
 			},
 		},
+		&object.String{Value: "total: 42"},
+		&object.String{Value: ""},
+		&object.Char{Value: 'é'},
+		object.NewInteger(new(big.Int).Lsh(big.NewInt(1), 100)),
 	}
 	gob.Register(&object.Constructor{})
 	gob.Register(&object.Instance{})
@@ -42,6 +47,16 @@ func TestSerialization(t *testing.T) {
 		return
 	}
 
+	if len(decoded) != len(constants) {
+		t.Fatalf("wrong number of decoded constants. expected %d, got %d", len(constants), len(decoded))
+	}
+	for i, c := range []int{3, 4, 5, 6} {
+		expected := constants[c].(object.Comparable)
+		if !expected.EqualsTo(decoded[c]) {
+			t.Errorf("constant %d decoded wrongly. expected %s, got %s", i, constants[c], decoded[c])
+		}
+	}
+
 	fmt.Println("Decoded objects:")
 	for _, obj := range decoded {
 		fmt.Printf("Type: %T, Value: %+v\n", obj, obj)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
 )
 
 type Instructions []byte
@@ -23,8 +24,34 @@ const (
 	OpMatchFailed
 	OpVariable
 	OpPrint
+	OpConcat
+	OpStrLen
+	OpCharAt
+	OpStrCmp
+	OpIntToString
+	OpStringToInt
+	OpWide
+	OpAssert
+	OpAssertEq
+	OpCallNative
+	OpPrintNoNewline
+	OpPrintErr
+	OpReadInt
+	OpReadLine
+	OpShow
+	OpEq
+	OpCompare
+	OpTuple
+	OpProject
+	OpField
+	OpMatchTuple
 )
 
+// MaxWideOperand is the largest operand an instruction can hold. Operands
+// that do not fit into their regular width are written after an OpWide
+// prefix, which doubles the width of every operand of the next instruction.
+const MaxWideOperand = math.MaxUint32
+
 type Definition struct {
 	Name          string
 	OperandWidths []int
@@ -43,6 +70,27 @@ var definitions = map[OpCode]*Definition{
 	OpMatchFailed:      {"OpMatchFailed", []int{}},
 	OpVariable:         {"OpVariable", []int{2}}, // {variable_index}
 	OpPrint:            {"OpPrint", []int{}},
+	OpConcat:           {"OpConcat", []int{2}}, // {args_amount}
+	OpStrLen:           {"OpStrLen", []int{}},
+	OpCharAt:           {"OpCharAt", []int{}},
+	OpStrCmp:           {"OpStrCmp", []int{}},
+	OpIntToString:      {"OpIntToString", []int{}},
+	OpStringToInt:      {"OpStringToInt", []int{}},
+	OpWide:             {"OpWide", []int{}}, // prefix: next instruction has 4-byte operands
+	OpAssert:           {"OpAssert", []int{}},
+	OpAssertEq:         {"OpAssertEq", []int{}},
+	OpCallNative:       {"OpCallNative", []int{2, 2}}, // {native_index, args_amount}
+	OpPrintNoNewline:   {"OpPrintNoNewline", []int{}},
+	OpPrintErr:         {"OpPrintErr", []int{}},
+	OpReadInt:          {"OpReadInt", []int{}},
+	OpReadLine:         {"OpReadLine", []int{}},
+	OpShow:             {"OpShow", []int{}},
+	OpEq:               {"OpEq", []int{}},
+	OpCompare:          {"OpCompare", []int{}},
+	OpTuple:            {"OpTuple", []int{2}},         // {size}
+	OpProject:          {"OpProject", []int{2}},       // {element_index}
+	OpField:            {"OpField", []int{2}},         // {field_name_index}
+	OpMatchTuple:       {"OpMatchTuple", []int{2, 2}}, // {size, jmp_to_if_not_matched}
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -54,12 +102,47 @@ func Lookup(op byte) (*Definition, error) {
 	return def, nil
 }
 
+// Wide returns the definition of the instruction following an OpWide prefix.
+func (def *Definition) Wide() *Definition {
+	widths := make([]int, len(def.OperandWidths))
+	for i, w := range def.OperandWidths {
+		widths[i] = 2 * w
+	}
+	return &Definition{Name: def.Name, OperandWidths: widths}
+}
+
+// NeedsWide reports whether some operand does not fit into its regular width.
+func NeedsWide(op OpCode, operands ...int) bool {
+	def, ok := definitions[op]
+	if !ok {
+		return false
+	}
+	for i, o := range operands {
+		if uint64(o) >= 1<<(8*def.OperandWidths[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 func Make(op OpCode, operands ...int) []byte {
 	def, ok := definitions[op]
 	if !ok {
 		return []byte{}
 	}
+	return makeInstruction(op, def, operands)
+}
+
+// MakeWide encodes the instruction with an OpWide prefix and 4-byte operands.
+func MakeWide(op OpCode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+	return append([]byte{byte(OpWide)}, makeInstruction(op, def.Wide(), operands)...)
+}
 
+func makeInstruction(op OpCode, def *Definition, operands []int) []byte {
 	instructionLen := 1
 	for _, w := range def.OperandWidths {
 		instructionLen += w
@@ -74,6 +157,8 @@ func Make(op OpCode, operands ...int) []byte {
 		switch width {
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		}
 		offset += width
 	}
@@ -85,13 +170,31 @@ func (ins Instructions) String() string {
 	var out bytes.Buffer
 	i := 0
 	for i < len(ins) {
+		start := i
+		prefix := ""
+		if OpCode(ins[i]) == OpWide && i+1 < len(ins) {
+			prefix = "OpWide "
+			i++
+		}
 		def, err := Lookup(ins[i])
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
 			continue
 		}
+		if prefix != "" {
+			def = def.Wide()
+		}
+		length := 0
+		for _, w := range def.OperandWidths {
+			length += w
+		}
+		if i+1+length > len(ins) {
+			fmt.Fprintf(&out, "ERROR: %s is truncated\n", def.Name)
+			break
+		}
 		operands, read := ReadOperands(def, ins[i+1:])
-		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		fmt.Fprintf(&out, "%04d %s%s\n", start, prefix, ins.fmtInstruction(def, operands))
 		i += 1 + read
 	}
 	return out.String()
@@ -118,15 +221,23 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	operands := make([]int, len(def.OperandWidths))
 	offset := 0
 	for i, width := range def.OperandWidths {
-		switch width {
-		case 2:
-			operands[i] = int(ReadUint16(ins[offset:]))
-		}
+		operands[i] = ReadOperand(ins[offset:], width)
 		offset += width
 	}
 	return operands, offset
 }
 
+// ReadOperand reads a single operand of the given width.
+func ReadOperand(ins Instructions, width int) int {
+	switch width {
+	case 2:
+		return int(ReadUint16(ins))
+	case 4:
+		return int(binary.BigEndian.Uint32(ins))
+	}
+	return 0
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
@@ -65,6 +65,7 @@ func TestReadOperands(t *testing.T) {
 		bytesRead int
 	}{
 		{OpConstant, []int{65535}, 2},
+		{OpMatchConstant, []int{3, 65535}, 4},
 	}
 	for _, tt := range tests {
 		instruction := Make(tt.op, tt.operands...)
@@ -83,3 +84,48 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeWide(t *testing.T) {
+	instruction := MakeWide(OpMatchConstant, 65536, 2)
+	expected := []byte{byte(OpWide), byte(OpMatchConstant), 0, 1, 0, 0, 0, 0, 0, 2}
+	if string(instruction) != string(expected) {
+		t.Fatalf("wrong wide instruction. expected %v, got %v", expected, instruction)
+	}
+
+	def, err := Lookup(instruction[1])
+	if err != nil {
+		t.Fatalf("definition not found: %q\n", err)
+	}
+	operands, n := ReadOperands(def.Wide(), instruction[2:])
+	if n != 8 || operands[0] != 65536 || operands[1] != 2 {
+		t.Errorf("wrong wide operands %v (%d bytes read)", operands, n)
+	}
+
+	concatted := Instructions{}
+	concatted = append(concatted, MakeWide(OpConstant, 70000)...)
+	concatted = append(concatted, Make(OpAdd, 2)...)
+	expectedString := `0000 OpWide OpConstant 70000
+0006 OpAdd 2
+`
+	if concatted.String() != expectedString {
+		t.Errorf("instructions wrongly formatted.\nexpected %q\ngot %q", expectedString, concatted.String())
+	}
+}
+
+func TestNeedsWide(t *testing.T) {
+	tests := []struct {
+		op       OpCode
+		operands []int
+		expected bool
+	}{
+		{OpConstant, []int{65535}, false},
+		{OpConstant, []int{65536}, true},
+		{OpMatchConstructor, []int{1, 65536}, true},
+		{OpReturnValue, []int{}, false},
+	}
+	for _, tt := range tests {
+		if NeedsWide(tt.op, tt.operands...) != tt.expected {
+			t.Errorf("NeedsWide(%d, %v) should be %t", tt.op, tt.operands, tt.expected)
+		}
+	}
+}
@@ -2,10 +2,15 @@ package compiler
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
 
 	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
 	"github.com/emrzvv/fl-compiler/internal/compiler/code"
+	"github.com/emrzvv/fl-compiler/internal/native"
 	"github.com/emrzvv/fl-compiler/internal/types/object"
 	"github.com/emrzvv/fl-compiler/internal/types/pattern"
 	"github.com/emrzvv/fl-compiler/internal/utils"
@@ -14,24 +19,41 @@ import (
 type Compiler struct {
 	instructions        code.Instructions
 	constants           []object.Object
-	constructorsMapping map[string]int
+	constructorsMapping map[string][]int
 	functionsMapping    map[string]int
-	integersMapping     map[int64]int
+	functionValues      map[string]bool
+	constantsMapping    map[string]int
 	patmatJumps         []int
 	matches             [][]int
 	varMapping          map[utils.Binding]int
 	varAmount           int
+	locals              int
 	currentFun          string
 	currentRule         int
+	wideJumps           bool
+	tests               []Test
+	registry            *native.Registry
+	natives             []string
 }
 
-func NewCompiler() *Compiler {
-	return &Compiler{
+type Option func(*Compiler)
+
+// WithNatives makes the native functions of registry callable from the
+// compiled program.
+func WithNatives(registry *native.Registry) Option {
+	return func(c *Compiler) {
+		c.registry = registry
+	}
+}
+
+func NewCompiler(options ...Option) *Compiler {
+	c := &Compiler{
 		instructions:        code.Instructions{},
 		constants:           []object.Object{},
-		constructorsMapping: make(map[string]int),
+		constructorsMapping: make(map[string][]int),
 		functionsMapping:    make(map[string]int),
-		integersMapping:     make(map[int64]int),
+		functionValues:      make(map[string]bool),
+		constantsMapping:    make(map[string]int),
 		patmatJumps:         []int{},
 		matches:             [][]int{},
 		varMapping:          make(map[utils.Binding]int),
@@ -39,6 +61,10 @@ func NewCompiler() *Compiler {
 		currentFun:          "",
 		currentRule:         0,
 	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
@@ -63,70 +89,82 @@ func (c *Compiler) Compile(node ast.Node) error {
 					return err
 				}
 			}
+			if d.Test != nil {
+				err := c.compileTest(d.Test)
+				if err != nil {
+					return err
+				}
+			}
 		}
-	case *ast.TypeDef:
-		for _, alt := range node.TypeAlternatives {
-			constructorName := alt.Constructor.Name
-			constructorArity := len(alt.Constructor.Parameters)
-			supertype := node.TypeName.Name
-
-			constructorObj := &object.Constructor{
-				Name:      constructorName,
-				Arity:     int64(constructorArity),
-				Supertype: supertype,
+		if uint64(len(c.constants)) > code.MaxWideOperand+1 {
+			return fmt.Errorf("too many constants: %d", len(c.constants))
+		}
+		if uint64(c.varAmount) > code.MaxWideOperand+1 {
+			return fmt.Errorf("too many variables: %d", c.varAmount)
+		}
+		undefined := []string{}
+		for name, index := range c.functionsMapping {
+			if len(c.constants[index].(*object.CompiledFunction).Instructions) == 0 {
+				undefined = append(undefined, name)
 			}
-
-			index := c.addConstant(constructorObj)
-			c.constructorsMapping[constructorName] = index
+		}
+		if len(undefined) > 0 {
+			slices.Sort(undefined)
+			if c.functionValues[undefined[0]] {
+				return fmt.Errorf("no such variable %s", undefined[0])
+			}
+			return fmt.Errorf("unknown function %s", undefined[0])
+		}
+	case *ast.TypeDef:
+		for _, constructor := range node.Constructors() {
+			index := c.addConstant(constructor)
+			c.constructorsMapping[constructor.Name] = append(c.constructorsMapping[constructor.Name], index)
 		}
 	case *ast.ExprConstructor:
+		if uint64(len(node.Arguments)) > code.MaxWideOperand {
+			return fmt.Errorf("too many arguments for constructor %s: %d", node.Name.Name, len(node.Arguments))
+		}
 		for _, arg := range node.Arguments {
 			err := c.Compile(arg)
 			if err != nil {
 				return err
 			}
 		}
-		name := node.Name.Name
-		index := c.constructorsMapping[name]
+		index, err := c.resolveConstructor(&node.Name)
+		if err != nil {
+			return err
+		}
 		c.emit(code.OpConstruct, index, len(node.Arguments))
 	case *ast.FunDef:
-		c.patmatJumps = make([]int, 0)
-		c.matches = make([][]int, 0)
-		c.currentFun = node.Signature.Name
-		// fmt.Println(node.Signature.Name)
-		// fmt.Printf("%+v", node.Rules)
+		if _, ok := c.registry.Lookup(node.Signature.Name); ok {
+			return fmt.Errorf("function %s is already declared as native", node.Signature.Name)
+		}
 		begin := len(c.instructions)
-		// fmt.Println(len(node.Rules))
-		reservedIndex := c.addConstant(&object.CompiledFunction{
-			Instructions: code.Instructions{},
-		})
-
-		c.functionsMapping[node.Signature.Name] = reservedIndex
-		for i, rule := range node.Rules {
-			// fmt.Printf("compiling rule %d", i)
-			c.currentRule = i
-			err := c.Compile(rule)
-			if err != nil {
-				return err
+		constantsAmount, varAmount := len(c.constants), c.varAmount
+		c.wideJumps = false
+		err := c.compileFunDef(node)
+		if err == errNarrowJumps {
+			// The function is too long for 2-byte jump targets: drop what was
+			// emitted and compile it again with wide match instructions.
+			c.instructions = c.instructions[:begin]
+			c.constants = c.constants[:constantsAmount]
+			for key, index := range c.constantsMapping {
+				if index >= constantsAmount {
+					delete(c.constantsMapping, key)
+				}
 			}
+			for name, index := range c.functionsMapping {
+				if index >= constantsAmount {
+					delete(c.functionsMapping, name)
+				}
+			}
+			c.varAmount = varAmount
+			c.wideJumps = true
+			err = c.compileFunDef(node)
 		}
-		end := c.emit(code.OpMatchFailed)
-		c.patmatJumps = append(c.patmatJumps, end)
-		c.patmatJumps = c.patmatJumps[1:]
-		for i, _ := range c.patmatJumps {
-			c.patmatJumps[i] -= begin
-			// fmt.Printf("%d to %d ", i, c.patmatJumps[i])
-		}
-		// fmt.Printf("\n%+v", c.matches)
-		// fmt.Println()
-		c.setPatmatJumpingPoints()
-		emittedInstructions := make([]byte, end-begin+1)
-		copy(emittedInstructions, c.instructions[begin:end+1])
-		compiledFunction := &object.CompiledFunction{
-			Instructions: emittedInstructions,
+		if err != nil {
+			return err
 		}
-		c.constants[reservedIndex] = compiledFunction
-		c.instructions = c.instructions[:begin]
 	case *ast.FunRule:
 		patternDef := node.Pattern
 		expr := node.Expression
@@ -139,7 +177,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
-			c.emitPatternMatching(&pattern, &matchPositions)
+			err = c.emitPatternMatching(&pattern, &matchPositions)
+			if err != nil {
+				return err
+			}
 			// patternIndex := c.addPattern(pattern)
 			// matchPos := c.emit(code.OpMatch, patternIndex, 0)
 			// matchesPositions = append(matchesPositions, matchPos)
@@ -148,50 +189,102 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.patmatJumps = append(c.patmatJumps, matchPositions[0])
 		}
 		c.matches = append(c.matches, matchPositions)
-		c.Compile(expr)
+		err := c.Compile(expr)
+		if err != nil {
+			return err
+		}
 		c.emit(code.OpReturnValue)
 
 	case *ast.FunCall:
+		if uint64(len(node.Arguments)) > code.MaxWideOperand {
+			return fmt.Errorf("too many arguments for function %s: %d", node.Name, len(node.Arguments))
+		}
+		if arity, fixed := ast.BuiltinArity(node.Name); fixed && arity != len(node.Arguments) {
+			return fmt.Errorf("function %s expects %d arguments, got %d", node.Name, arity, len(node.Arguments))
+		}
+		for _, arg := range node.Arguments {
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+		}
 		switch node.Name {
 		case "+": // TODO: find another way to execute built-in functions
-			for _, expr := range node.Arguments {
-				if expr.Const != nil {
-					err := c.Compile(expr.Const)
-					if err != nil {
-						return err
-					}
-				}
-				if expr.FunCall != nil {
-					err := c.Compile(expr.FunCall)
-					if err != nil {
-						return err
-					}
-				}
-			}
 			c.emit(code.OpAdd, len(node.Arguments))
 		case "print":
-			for _, arg := range node.Arguments {
-				err := c.Compile(arg)
-				if err != nil {
-					return err
-				}
-			}
 			c.emit(code.OpPrint)
+		case "eq":
+			c.emit(code.OpEq)
+		case "compare":
+			c.emit(code.OpCompare)
+		case "show":
+			c.emit(code.OpShow)
+		case "printNoNewline":
+			c.emit(code.OpPrintNoNewline)
+		case "printErr":
+			c.emit(code.OpPrintErr)
+		case "readInt":
+			c.emit(code.OpReadInt)
+		case "readLine":
+			c.emit(code.OpReadLine)
+		case "concat":
+			c.emit(code.OpConcat, len(node.Arguments))
+		case "strlen":
+			c.emit(code.OpStrLen)
+		case "charAt":
+			c.emit(code.OpCharAt)
+		case "strcmp":
+			c.emit(code.OpStrCmp)
+		case "intToString":
+			c.emit(code.OpIntToString)
+		case "stringToInt":
+			c.emit(code.OpStringToInt)
+		case "assert":
+			c.emit(code.OpAssert)
+		case "assertEq":
+			c.emit(code.OpAssertEq)
 		default:
-			for _, arg := range node.Arguments {
-				err := c.Compile(arg)
+			if _, ok := c.registry.Lookup(node.Name); ok {
+				c.emit(code.OpCallNative, c.nativeIndex(node.Name), len(node.Arguments))
+				break
+			}
+			key := utils.Binding{FunName: c.currentFun, VarName: node.Name, Branch: c.currentRule}
+			if index, ok := c.varMapping[key]; ok {
+				// A function passed as an argument is called through its variable.
+				c.emit(code.OpVariable, index)
+			} else {
+				c.emit(code.OpConstant, c.functionIndex(node.Name))
+			}
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+	case *ast.Expression:
+		if node.Tuple != nil {
+			if uint64(len(node.Tuple.Elements)) > code.MaxWideOperand {
+				return fmt.Errorf("too many elements of a tuple: %d", len(node.Tuple.Elements))
+			}
+			for _, element := range node.Tuple.Elements {
+				err := c.Compile(element)
 				if err != nil {
 					return err
 				}
 			}
-			name := node.Name
-			fIdx := c.functionsMapping[name]
-			// fmt.Printf("%+v", c.functionsMapping)
-			// fmt.Printf("function %s idx %d", name, fIdx)
-			c.emit(code.OpConstant, fIdx)
-			c.emit(code.OpCall, len(node.Arguments))
+			c.emit(code.OpTuple, len(node.Tuple.Elements))
+		}
+		if node.Field != nil {
+			err := c.Compile(node.Field.Value)
+			if err != nil {
+				return err
+			}
+			if node.Field.IsIndex() {
+				index, err := strconv.Atoi(node.Field.Field)
+				if err != nil || uint64(index) > code.MaxWideOperand {
+					return fmt.Errorf("wrong tuple index %s", node.Field.Field)
+				}
+				c.emit(code.OpProject, index)
+			} else {
+				c.emit(code.OpField, c.addConstant(&object.String{Value: node.Field.Field}))
+			}
 		}
-	case *ast.Expression:
 		if node.Const != nil {
 			err := c.Compile(node.Const)
 			if err != nil {
@@ -218,25 +311,132 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 			index, ok := c.varMapping[key]
 			if !ok {
-				return fmt.Errorf("no such variable")
+				// Any other name is a function used as a value.
+				c.functionValues[node.Variable] = true
+				c.emit(code.OpConstant, c.functionIndex(node.Variable))
+				break
 			}
 			// fmt.Printf("PUSH VAR %s IDX %d\n", node.Variable, index)
 			c.emit(code.OpVariable, index)
 		}
 	case *ast.Const:
-		index, ok := c.integersMapping[int64(node.Number)]
-		if !ok {
-			obj := &object.Integer{Value: int64(node.Number)}
-			index = c.addConstant(obj)
-		}
+		index := c.addConst(node)
 		c.emit(code.OpConstant, index)
 	}
 	return nil
 }
 
+// compileTest compiles the expression of a test into its own instruction
+// stream, which the test runner executes instead of the main one.
+func (c *Compiler) compileTest(node *ast.TestDef) error {
+	main := c.instructions
+	c.instructions = code.Instructions{}
+	defer func() { c.instructions = main }()
+
+	err := c.Compile(node.Expression)
+	if err != nil {
+		return err
+	}
+	c.tests = append(c.tests, Test{
+		Name:         node.Name,
+		Line:         node.Pos.Line,
+		Column:       node.Pos.Column,
+		Instructions: c.instructions,
+	})
+	return nil
+}
+
+var errNarrowJumps = errors.New("jump target does not fit into 2 bytes")
+
+func (c *Compiler) compileFunDef(node *ast.FunDef) error {
+	c.patmatJumps = make([]int, 0)
+	c.matches = make([][]int, 0)
+	c.currentFun = node.Signature.Name
+	c.locals = 0
+	begin := len(c.instructions)
+	reservedIndex := c.functionIndex(node.Signature.Name)
+	for i, rule := range node.Rules {
+		c.currentRule = i
+		err := c.Compile(rule)
+		if err != nil {
+			return err
+		}
+	}
+	end := c.emit(code.OpMatchFailed)
+	if uint64(end-begin) > code.MaxWideOperand {
+		return fmt.Errorf("function %s is too long: %d bytes", node.Signature.Name, end-begin)
+	}
+	if !c.wideJumps && end-begin > math.MaxUint16 {
+		return errNarrowJumps
+	}
+	c.patmatJumps = append(c.patmatJumps, end)
+	c.patmatJumps = c.patmatJumps[1:]
+	for i := range c.patmatJumps {
+		c.patmatJumps[i] -= begin
+	}
+	err := c.setPatmatJumpingPoints()
+	if err != nil {
+		return err
+	}
+	emittedInstructions := make([]byte, end-begin+1)
+	copy(emittedInstructions, c.instructions[begin:end+1])
+	compiledFunction := &object.CompiledFunction{
+		Instructions: emittedInstructions,
+		Locals:       c.locals,
+		Name:         node.Signature.Name,
+		Arity:        len(node.Signature.Parameters),
+	}
+	c.constants[reservedIndex] = compiledFunction
+	c.varAmount = max(c.varAmount, c.locals)
+	c.instructions = c.instructions[:begin]
+	c.currentFun, c.currentRule = "", 0
+	return nil
+}
+
+// functionIndex returns the constant slot of a function, reserving it on
+// first use, so calls can be compiled before the definition they refer to.
+func (c *Compiler) functionIndex(name string) int {
+	if index, ok := c.functionsMapping[name]; ok {
+		return index
+	}
+	index := c.addConstant(&object.CompiledFunction{
+		Instructions: code.Instructions{},
+	})
+	c.functionsMapping[name] = index
+	return index
+}
+
+// nativeIndex returns the slot of a native function in Bytecode.Natives.
+func (c *Compiler) nativeIndex(name string) int {
+	index := slices.Index(c.natives, name)
+	if index < 0 {
+		index = len(c.natives)
+		c.natives = append(c.natives, name)
+	}
+	return index
+}
+
+func (c *Compiler) constObject(node *ast.Const) object.Object {
+	switch {
+	case node.Str != nil:
+		return &object.String{Value: *node.Str}
+	case node.Char != nil:
+		return &object.Char{Value: []rune(*node.Char)[0]}
+	}
+	return object.NewInteger(node.Number)
+}
+
+func (c *Compiler) addConst(node *ast.Const) int {
+	return c.addConstant(c.constObject(node))
+}
+
 func (c *Compiler) setPatmatJumpingPoints() error {
 	for i, jumpTo := range c.patmatJumps {
 		for _, matchIdx := range c.matches[i] {
+			wide := code.OpCode(c.instructions[matchIdx]) == code.OpWide
+			if wide {
+				matchIdx++
+			}
 			definition, err := code.Lookup(c.instructions[matchIdx])
 			if err != nil {
 				return err
@@ -244,10 +444,18 @@ func (c *Compiler) setPatmatJumpingPoints() error {
 			if definition.Name == "OpBindVariable" {
 				continue
 			}
+			if wide {
+				definition = definition.Wide()
+			}
 			offset := 1
 			for _, w := range definition.OperandWidths {
 				offset += w
 			}
+			if wide {
+				offset -= 4 // assume that last patmat arg is always jmp address
+				binary.BigEndian.PutUint32(c.instructions[matchIdx+offset:], uint32(jumpTo))
+				continue
+			}
 			offset -= 2 // assume that last patmat arg is always jmp address
 			binary.BigEndian.PutUint16(c.instructions[matchIdx+offset:], uint16(jumpTo))
 		}
@@ -258,27 +466,37 @@ func (c *Compiler) setPatmatJumpingPoints() error {
 func (c *Compiler) collectPattern(p *ast.PatternArgument) (pattern.Pattern, error) {
 	if p.Variable != "" {
 		key := utils.Binding{FunName: c.currentFun, VarName: p.Variable, Branch: c.currentRule}
-		c.varMapping[key] = c.varAmount
-		c.varAmount++
+		c.varMapping[key] = c.locals
+		c.locals++
 
 		return &pattern.VariablePattern{
 			Name:      p.Variable,
 			FunName:   c.currentFun,
 			RuleIndex: c.currentRule,
-			Index:     c.varAmount - 1,
+			Index:     c.locals - 1,
 		}, nil
 	}
 	if p.Const != nil {
-		index, ok := c.integersMapping[int64(p.Const.Number)]
-		obj := &object.Integer{Value: int64(p.Const.Number)}
-		if !ok {
-			index = c.addConstant(obj)
-		}
+		index := c.addConst(p.Const)
 		return &pattern.ConstPattern{
-			Const: obj,
+			Const: c.constants[index],
 			Index: index,
 		}, nil
 	}
+	if p.Tuple != nil {
+		args := []pattern.Pattern{}
+		for _, element := range p.Tuple.Elements {
+			elementPattern, err := c.collectPattern(element)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, elementPattern)
+		}
+		return &pattern.TuplePattern{Args: args}, nil
+	}
+	if p.IsRecord() {
+		return c.collectRecordPattern(p)
+	}
 	if p.Name.Name != "" {
 		args := []pattern.Pattern{}
 		for _, arg := range p.Arguments {
@@ -288,9 +506,9 @@ func (c *Compiler) collectPattern(p *ast.PatternArgument) (pattern.Pattern, erro
 			}
 			args = append(args, argPattern)
 		}
-		constrIndex, ok := c.constructorsMapping[p.Name.Name]
-		if !ok {
-			return nil, fmt.Errorf("could not find constructor %s on index %d", p.Name.Name, constrIndex)
+		constrIndex, err := c.resolveConstructor(&p.Name)
+		if err != nil {
+			return nil, err
 		}
 		return &pattern.ConstructorPattern{
 			Constructor: c.constants[constrIndex].(*object.Constructor),
@@ -301,6 +519,61 @@ func (c *Compiler) collectPattern(p *ast.PatternArgument) (pattern.Pattern, erro
 	return nil, fmt.Errorf("could not construct pattern: %+v", p)
 }
 
+// collectRecordPattern expands [Person: name] into a constructor pattern
+// that binds the named fields to variables and ignores the others.
+func (c *Compiler) collectRecordPattern(p *ast.PatternArgument) (pattern.Pattern, error) {
+	constrIndex, err := c.resolveConstructor(&p.Name)
+	if err != nil {
+		return nil, err
+	}
+	constructor := c.constants[constrIndex].(*object.Constructor)
+	if len(constructor.Fields) == 0 {
+		return nil, fmt.Errorf("constructor %s is not a record", p.Name.String())
+	}
+	args := []pattern.Pattern{}
+	for _, field := range constructor.Fields {
+		if !slices.Contains(p.Fields, field) {
+			args = append(args, &pattern.WildcardPattern{Index: c.locals})
+			c.locals++
+			continue
+		}
+		variable, err := c.collectPattern(&ast.PatternArgument{Pos: p.Pos, Variable: field})
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, variable)
+	}
+	for _, field := range p.Fields {
+		if _, ok := constructor.Field(field); !ok {
+			return nil, fmt.Errorf("constructor %s has no field %s", p.Name.String(), field)
+		}
+	}
+	return &pattern.ConstructorPattern{
+		Constructor: constructor,
+		Args:        args,
+		Index:       constrIndex,
+	}, nil
+}
+
+// resolveConstructor finds the constant of a constructor, using the type
+// name to tell apart same-named constructors of different types.
+func (c *Compiler) resolveConstructor(name *ast.ConstructorName) (int, error) {
+	found := []int{}
+	for _, index := range c.constructorsMapping[name.Name] {
+		constructor := c.constants[index].(*object.Constructor)
+		if name.Type == "" || constructor.Supertype == name.Type {
+			found = append(found, index)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return 0, fmt.Errorf("could not find constructor %s", name)
+	case 1:
+		return found[0], nil
+	}
+	return 0, fmt.Errorf("ambiguous constructor %s, qualify it with the type name", name)
+}
+
 func (c *Compiler) emitPatternMatching(p *pattern.Pattern, matchPositions *[]int) error {
 	switch pattern := (*p).(type) {
 	case *pattern.ConstructorPattern:
@@ -321,19 +594,70 @@ func (c *Compiler) emitPatternMatching(p *pattern.Pattern, matchPositions *[]int
 	case *pattern.VariablePattern:
 		pos := c.emit(code.OpBindVariable, pattern.Index)
 		*matchPositions = append(*matchPositions, pos)
+	case *pattern.WildcardPattern:
+		pos := c.emit(code.OpBindVariable, pattern.Index)
+		*matchPositions = append(*matchPositions, pos)
+	case *pattern.TuplePattern:
+		if uint64(len(pattern.Args)) > code.MaxWideOperand {
+			return fmt.Errorf("too many elements of a tuple pattern: %d", len(pattern.Args))
+		}
+		pos := c.emit(code.OpMatchTuple, len(pattern.Args), 0)
+		*matchPositions = append(*matchPositions, pos)
+		if len(pattern.Args) != 0 {
+			c.emit(code.OpExpandArgs)
+			for _, arg := range pattern.Args {
+				err := c.emitPatternMatching(&arg, matchPositions)
+				if err != nil {
+					return err
+				}
+			}
+		}
 	default:
 		return fmt.Errorf("unknown pattern: %v", p)
 	}
 	return nil
 }
 
+// addConstant interns obj: values that are equal share one slot in the pool.
+// Slots are handed out in order of first use, so the same source always
+// produces the same pool.
 func (c *Compiler) addConstant(obj object.Object) int {
+	key, ok := constantKey(obj)
+	if ok {
+		if index, ok := c.constantsMapping[key]; ok {
+			return index
+		}
+	}
 	c.constants = append(c.constants, obj)
-	return len(c.constants) - 1
+	index := len(c.constants) - 1
+	if ok {
+		c.constantsMapping[key] = index
+	}
+	return index
 }
 
+// constantKey identifies interned constants. Compiled functions are never
+// interned: every definition gets its own slot.
+func constantKey(obj object.Object) (string, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer, *object.BigInteger, *object.String, *object.Char:
+		return fmt.Sprintf("%s %s", obj.Type(), obj.String()), true
+	case *object.Constructor:
+		return fmt.Sprintf("%s %s.%s/%d#%d", obj.Type(), obj.Supertype, obj.Name, obj.Arity, obj.Tag), true
+	}
+	return "", false
+}
+
+// emit picks the wide encoding when an operand does not fit into 2 bytes.
+// Match instructions of a function compiled with wideJumps are always wide,
+// because their jump targets are only known after the whole function is
+// emitted.
 func (c *Compiler) emit(op code.OpCode, operands ...int) int {
 	instr := code.Make(op, operands...)
+	isMatch := op == code.OpMatchConstructor || op == code.OpMatchConstant || op == code.OpMatchTuple
+	if code.NeedsWide(op, operands...) || (c.wideJumps && isMatch) {
+		instr = code.MakeWide(op, operands...)
+	}
 	pos := c.addInstruction(instr)
 	return pos
 }
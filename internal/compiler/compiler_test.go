@@ -1,11 +1,11 @@
 package compiler
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
-	"github.com/alecthomas/participle/v2"
-	"github.com/alecthomas/participle/v2/lexer"
 	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
 	"github.com/emrzvv/fl-compiler/internal/compiler/code"
 	"github.com/emrzvv/fl-compiler/internal/types/object"
@@ -34,6 +34,112 @@ func TestIntegerArithmetic(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestStringConstants(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `(concat "a" 'b' (intToString 1))`,
+			expectedConstants: []interface{}{"a", 'b', 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIntToString),
+				code.Make(code.OpConcat, 3),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstantInterning(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `(+ 1 1 (+ 2 1))`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd, 2),
+				code.Make(code.OpAdd, 3),
+			},
+		},
+		{
+			input:             `(concat "a" 'a' "a" 'a')`,
+			expectedConstants: []interface{}{"a", 'a'},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConcat, 4),
+			},
+		},
+		{
+			input: `fun (isZero Int) -> Int :
+			(isZero 0) -> 1 |
+			(isZero x) -> 0 .
+			(isZero 1)`,
+			expectedConstants: []interface{}{
+				&object.CompiledFunction{
+					Instructions: concatInstructions([]code.Instructions{
+						code.Make(code.OpMatchConstant, 1, 9),
+						code.Make(code.OpConstant, 2),
+						code.Make(code.OpReturnValue),
+						code.Make(code.OpBindVariable, 0),
+						code.Make(code.OpConstant, 1),
+						code.Make(code.OpReturnValue),
+						code.Make(code.OpMatchFailed),
+					}),
+				},
+				0,
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDeterministicBytecode(t *testing.T) {
+	input := `type [List x]: Cons x [List x] | Nil .
+	fun (len [List x]) -> Int :
+	(len [Cons x xs]) -> (+ 1 (len xs)) |
+	(len [Nil]) -> 0 .
+	(print (concat "len: " (intToString (len [Cons 'a' [Cons 'b' [Nil]]]))))
+	(print 100000000000000000000)`
+
+	var previous []byte
+	for i := 0; i < 5; i++ {
+		program, err := ast.ParseString("tests", input)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		compiler := NewCompiler()
+		err = compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := compiler.Bytecode()
+		constants, err := bytecode.serializeConstants()
+		if err != nil {
+			t.Fatalf("serialization error: %s", err)
+		}
+		current := append(append([]byte{}, bytecode.Instructions...), constants...)
+		if previous != nil && !bytes.Equal(previous, current) {
+			t.Fatalf("compilation %d produced different bytecode", i)
+		}
+		previous = current
+	}
+}
+
 func TestTypeDefinitions(t *testing.T) {
 	predefinedConstants := map[string][]interface{}{
 		"list_nil": {
@@ -53,6 +159,7 @@ func TestTypeDefinitions(t *testing.T) {
 				Name:      "Nil",
 				Arity:     0,
 				Supertype: "List",
+				Tag:       1,
 			},
 		},
 	}
@@ -71,6 +178,42 @@ func TestTypeDefinitions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestQualifiedConstructors(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `type [A]: Leaf .
+			type [B]: Node | Leaf .
+			(print [B.Leaf])
+			(print [A.Leaf])
+			(print [Node])`,
+			expectedConstants: []interface{}{
+				object.Constructor{Name: "Leaf", Arity: 0, Supertype: "A", Tag: 0},
+				object.Constructor{Name: "Node", Arity: 0, Supertype: "B", Tag: 0},
+				object.Constructor{Name: "Leaf", Arity: 0, Supertype: "B", Tag: 1},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstruct, 2, 0),
+				code.Make(code.OpPrint),
+				code.Make(code.OpConstruct, 0, 0),
+				code.Make(code.OpPrint),
+				code.Make(code.OpConstruct, 1, 0),
+				code.Make(code.OpPrint),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	program, err := ast.ParseString("tests", "type [A]: Leaf .\ntype [B]: Leaf .\n(print [Leaf])")
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	err = NewCompiler().Compile(program)
+	if err == nil || !strings.Contains(err.Error(), "ambiguous constructor Leaf") {
+		t.Errorf("expected ambiguity error, got %v", err)
+	}
+}
+
 func TestPatterns(t *testing.T) {
 	predef := map[string][]interface{}{
 		"list_nil": {
@@ -90,6 +233,7 @@ func TestPatterns(t *testing.T) {
 				Name:      "Nil",
 				Arity:     0,
 				Supertype: "List",
+				Tag:       1,
 			},
 		},
 		"int_int_simple": {
@@ -159,6 +303,7 @@ func TestFunCall(t *testing.T) {
 				Name:      "Nil",
 				Arity:     0,
 				Supertype: "List",
+				Tag:       1,
 			},
 		},
 		"int_int_simple": {
@@ -211,25 +356,8 @@ func TestFunCall(t *testing.T) {
 
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
-	var myLexer = lexer.MustSimple([]lexer.SimpleRule{
-		{Name: "Keyword", Pattern: `\b(type|fun)\b`},
-		{Name: "Operator", Pattern: `->|\||:`},
-		{Name: "Ident", Pattern: `[a-zA-Z\+][a-zA-Z0-9_]*`},
-		// {Name: "TypeName", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "TypeGeneral", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "FunName", Pattern: `[a-zA-Z\+\-\*\/][a-zA-Z0-9_]*`},
-		// {Name: "VarName", Pattern: `[a-zA-Z][a-zA-Z0-9_]`},
-		{Name: "Int", Pattern: `[0-9]+`}, // TODO: remove leading zeroes
-		{Name: "Punct", Pattern: `[\[\]\(\)\.]`},
-		{Name: "whitespace", Pattern: `[ \t\n\r]+`},
-	}) // TODO: to config
-
-	parser := participle.MustBuild[ast.Program]( // TODO: custom ast for tests
-		participle.Lexer(myLexer),
-	)
-
 	for _, tt := range tests {
-		program, err := parser.ParseString("tests", tt.input)
+		program, err := ast.ParseString("tests", tt.input)
 		if err != nil {
 			t.Fatalf("parse error: %s", err)
 		}
@@ -295,6 +423,26 @@ func testConstants(
 			if err != nil {
 				return fmt.Errorf("constant %d - testIntegerObject failed: %s", i, err)
 			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				return fmt.Errorf("constant %d - expected string %q, got %+v", i, constant, actual[i])
+			}
+		case rune:
+			char, ok := actual[i].(*object.Char)
+			if !ok || char.Value != constant {
+				return fmt.Errorf("constant %d - expected char %q, got %+v", i, constant, actual[i])
+			}
+		case *object.Constructor:
+			err := testConstructorObject(*constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testConstructorObject failed: %s", i, err)
+			}
+		case *object.CompiledFunction:
+			err := testCompiledFunctionObject(*constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testCompiledFunctionObject failed: %s", i, err)
+			}
 		case object.Constructor:
 			err := testConstructorObject(object.Constructor(constant), actual[i])
 			if err != nil {
@@ -332,7 +480,8 @@ func testConstructorObject(expected object.Constructor, actual object.Object) er
 
 	if result.Name != expected.Name ||
 		result.Arity != expected.Arity ||
-		result.Supertype != expected.Supertype {
+		result.Supertype != expected.Supertype ||
+		result.Tag != expected.Tag {
 		return fmt.Errorf("constructor has wrong fields. expected %+v\ngot %+v", expected, result)
 	}
 
@@ -357,3 +506,28 @@ func testCompiledFunctionObject(expected object.CompiledFunction, actual object.
 
 	return nil
 }
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{"(f 1)", "unknown function f"},
+		{"fun (f Int) -> Int : (f x) -> (g x) .", "unknown function g"},
+		{"fun (f Int) -> Int : (f x) -> y .", "no such variable"},
+		{"fun (f Int) -> Int : (f [Leaf]) -> 1 .", "could not find constructor Leaf"},
+		{`(print (strlen "a" "bc"))`, "function strlen expects 1 arguments, got 2"},
+		{"(print 1 2)", "function print expects 1 arguments, got 2"},
+	}
+
+	for _, tt := range tests {
+		program, err := ast.ParseString("tests", tt.input)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		err = NewCompiler().Compile(program)
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("expected error containing %q for %s, got %v", tt.contains, tt.input, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package compiler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+)
+
+// samples returns the sources of the programs from samples/.
+func samples(f *testing.F) []string {
+	paths, err := filepath.Glob("../../samples/*")
+	if err != nil {
+		f.Fatalf("glob error: %s", err)
+	}
+	sources := []string{}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatalf("read error: %s", err)
+		}
+		sources = append(sources, string(source))
+	}
+	return sources
+}
+
+// FuzzCompile checks that the compiler returns an error rather than panics
+// on any program that parses, whether it passes the semantic checks or
+// not, and that what it produces can be written and read back.
+func FuzzCompile(f *testing.F) {
+	for _, source := range samples(f) {
+		f.Add(source)
+	}
+	f.Add("(f 1)")
+	f.Add("fun (f Int) -> Int : (f x) -> y .")
+	f.Fuzz(func(t *testing.T, source string) {
+		program, err := ast.ParseString("fuzz", source)
+		if err != nil {
+			return
+		}
+		c := NewCompiler()
+		err = c.Compile(program)
+		if err != nil {
+			return
+		}
+		var buffer bytes.Buffer
+		err = c.Bytecode().Write(&buffer)
+		if err != nil {
+			t.Fatalf("write error: %s", err)
+		}
+		_, err = ReadBytecode(&buffer)
+		if err != nil {
+			t.Fatalf("read error: %s", err)
+		}
+	})
+}
+
+// FuzzReadBytecode checks that ReadBytecode returns an error rather than
+// panics on arbitrary bytes.
+func FuzzReadBytecode(f *testing.F) {
+	for _, source := range samples(f) {
+		program, err := ast.ParseString("sample", source)
+		if err != nil {
+			continue
+		}
+		c := NewCompiler()
+		if c.Compile(program) != nil {
+			continue
+		}
+		var buffer bytes.Buffer
+		err = c.Bytecode().Write(&buffer)
+		if err != nil {
+			f.Fatalf("write error: %s", err)
+		}
+		f.Add(buffer.Bytes())
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ReadBytecode(bytes.NewReader(data))
+	})
+}
@@ -0,0 +1,72 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+)
+
+// SymbolTable maps the names of functions and constructors of a program to
+// their slots in the constant pool.
+type SymbolTable struct {
+	Functions map[string]int
+	// Constructors has a slot per type that declares a constructor of that
+	// name.
+	Constructors map[string][]int
+	// Types has the names of the types that declare constructors.
+	Types map[string]bool
+}
+
+// Symbols collects the functions and constructors found in the constant
+// pool, so it also works for bytecode read from a file.
+func (b *Bytecode) Symbols() *SymbolTable {
+	symbols := &SymbolTable{
+		Functions:    make(map[string]int),
+		Constructors: make(map[string][]int),
+		Types:        make(map[string]bool),
+	}
+	for i, constant := range b.Constants {
+		switch constant := constant.(type) {
+		case *object.CompiledFunction:
+			if constant.Name != "" {
+				symbols.Functions[constant.Name] = i
+			}
+		case *object.Constructor:
+			symbols.Constructors[constant.Name] = append(symbols.Constructors[constant.Name], i)
+			symbols.Types[constant.Supertype] = true
+		}
+	}
+	return symbols
+}
+
+// Function returns the slot of the function called name.
+func (s *SymbolTable) Function(name string) (int, error) {
+	index, ok := s.Functions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown function %s", name)
+	}
+	return index, nil
+}
+
+// Constructor returns the slot of the constructor called name, which may be
+// qualified with the type name as in source code: Type.Name.
+func (s *SymbolTable) Constructor(name string, constants []object.Object) (int, error) {
+	typeName, constructorName, qualified := strings.Cut(name, ".")
+	if !qualified {
+		typeName, constructorName = "", name
+	}
+	found := []int{}
+	for _, index := range s.Constructors[constructorName] {
+		if typeName == "" || constants[index].(*object.Constructor).Supertype == typeName {
+			found = append(found, index)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return 0, fmt.Errorf("could not find constructor %s", name)
+	case 1:
+		return found[0], nil
+	}
+	return 0, fmt.Errorf("ambiguous constructor %s, qualify it with the type name", name)
+}
@@ -0,0 +1,130 @@
+// Package difftest runs programs through every execution path of the
+// project and checks that they agree: the tree-walking interpreter, the
+// compiler with the FVM, and the FVM on bytecode that went through
+// WriteToFile and ReadFromFile. Generate produces random well-typed
+// programs to feed it and Shrink reduces a failing program to a small
+// reproducer.
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/interp"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+	"github.com/emrzvv/fl-compiler/internal/vm"
+)
+
+// Outcome is what running a program produced.
+type Outcome struct {
+	Result string
+	Output string
+	Err    error
+}
+
+func (o *Outcome) String() string {
+	if o.Err != nil {
+		return fmt.Sprintf("error: %s\noutput:\n%s", o.Err, o.Output)
+	}
+	return fmt.Sprintf("result: %s\noutput:\n%s", o.Result, o.Output)
+}
+
+func (o *Outcome) agrees(other *Outcome) bool {
+	if (o.Err == nil) != (other.Err == nil) || o.Output != other.Output {
+		return false
+	}
+	return o.Err != nil || o.Result == other.Result
+}
+
+// Mismatch is returned by Check when two execution paths disagree.
+type Mismatch struct {
+	Path     string
+	Expected *Outcome
+	Actual   *Outcome
+}
+
+func (m *Mismatch) Error() string {
+	return fmt.Sprintf("%s disagrees with the interpreter\ninterpreter %s\n%s %s",
+		m.Path, m.Expected, m.Path, m.Actual)
+}
+
+// Check runs source through all execution paths. It returns a *Mismatch if
+// they disagree and a plain error if source is not a valid program.
+func Check(source string) error {
+	program, err := ast.ParseString("difftest", source)
+	if err != nil {
+		return err
+	}
+	err = ast.CheckSemantics(
+		program,
+		make(map[ast.TypeDefKey]interface{}),
+		make(map[ast.ConstructorDefKey]interface{}),
+		make(map[ast.FunctionDefKey]interface{}),
+		make(map[ast.VariableDefKey]interface{}),
+	)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	result, err := interp.NewInterpreter(interp.WithOutput(&out)).Run(program)
+	expected := outcome(result, &out, err)
+
+	comp := compiler.NewCompiler()
+	err = comp.Compile(program)
+	if err != nil {
+		return &Mismatch{Path: "compiler", Expected: expected, Actual: &Outcome{Err: err}}
+	}
+	actual := runVM(comp.Bytecode())
+	if !expected.agrees(actual) {
+		return &Mismatch{Path: "vm", Expected: expected, Actual: actual}
+	}
+
+	bytecode, err := roundTrip(comp.Bytecode())
+	if err != nil {
+		return &Mismatch{Path: "serialization", Expected: expected, Actual: &Outcome{Err: err}}
+	}
+	actual = runVM(bytecode)
+	if !expected.agrees(actual) {
+		return &Mismatch{Path: "vm after serialization", Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+func outcome(result object.Object, out *bytes.Buffer, err error) *Outcome {
+	o := &Outcome{Output: out.String(), Err: err}
+	if result != nil {
+		o.Result = result.String()
+	}
+	return o
+}
+
+func runVM(bytecode *compiler.Bytecode) (o *Outcome) {
+	var out bytes.Buffer
+	defer func() {
+		if r := recover(); r != nil {
+			o = &Outcome{Output: out.String(), Err: fmt.Errorf("panic: %v", r)}
+		}
+	}()
+	machine := vm.NewFVM(bytecode, vm.WithOutput(&out))
+	err := machine.Run()
+	return outcome(machine.StackTop(), &out, err)
+}
+
+func roundTrip(bytecode *compiler.Bytecode) (*compiler.Bytecode, error) {
+	file, err := os.CreateTemp("", "difftest-*.bin")
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	err = bytecode.WriteToFile(file.Name())
+	if err != nil {
+		return nil, err
+	}
+	return compiler.ReadFromFile(file.Name())
+}
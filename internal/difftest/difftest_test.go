@@ -0,0 +1,125 @@
+package difftest
+
+import (
+	"errors"
+	"flag"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	seed = flag.Int64("difftest.seed", 0, "seed of the random programs, 0 picks one from the clock")
+	runs = flag.Int("difftest.runs", 300, "number of random programs to check")
+)
+
+// mismatches reports whether Check finds a disagreement for source on a
+// program the interpreter runs without errors.
+func mismatches(source string) bool {
+	var mismatch *Mismatch
+	return errors.As(Check(source), &mismatch) && mismatch.Expected.Err == nil
+}
+
+func TestRandomPrograms(t *testing.T) {
+	start := *seed
+	if start == 0 {
+		start = time.Now().UnixNano()
+	}
+	amount := *runs
+	if testing.Short() {
+		amount = 30
+	}
+
+	for i := 0; i < amount; i++ {
+		source := Generate(rand.New(rand.NewSource(start + int64(i))))
+		err := Check(source)
+		var mismatch *Mismatch
+		if !errors.As(err, &mismatch) {
+			if err != nil {
+				t.Fatalf("generated an invalid program (seed %d): %s\n%s", start+int64(i), err, source)
+			}
+			continue
+		}
+		if mismatch.Expected.Err == nil {
+			source = Shrink(source, mismatches)
+			err = Check(source)
+		}
+		t.Fatalf("seed %d, reproduce with -difftest.seed=%d -difftest.runs=1\n%s\n%s",
+			start+int64(i), start+int64(i), source, err)
+	}
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	for i := int64(0); i < 10; i++ {
+		first := Generate(rand.New(rand.NewSource(i)))
+		second := Generate(rand.New(rand.NewSource(i)))
+		if first != second {
+			t.Fatalf("seed %d generated different programs:\n%s\n%s", i, first, second)
+		}
+	}
+}
+
+func TestShrink(t *testing.T) {
+	source := `type [L]: N | C Int [L] .
+fun (s [L]) -> Int :
+    (s [C x xs]) -> (+ (s xs) x) |
+    (s [N]) -> 0 .
+fun (g Int) -> String :
+    (g x) -> (concat "long" (intToString x)) .
+(print (g (s [C 1 [C 2 [N]]])))
+(s [C 7 [N]])
+`
+	// the artificial failure needs a call of g with a nonzero argument next
+	// to its signature and pattern
+	fails := func(source string) bool {
+		var mismatch *Mismatch
+		err := Check(source)
+		return strings.Count(source, "(g ") > 2 && !strings.Contains(source, "(g 0)") &&
+			(err == nil || errors.As(err, &mismatch))
+	}
+	expected := `fun (g Int) -> String :
+    (g x) -> "" .
+
+(g 1)
+`
+	actual := Shrink(source, fails)
+	if actual != expected {
+		t.Errorf("wrong shrinking result.\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+// TestRegressions keeps programs on which the execution paths used to
+// disagree.
+func TestRegressions(t *testing.T) {
+	tests := []string{
+		// variables of a rule were overwritten by the recursive call
+		`type [L]: N | C Int [L] .
+		fun (s [L]) -> Int :
+			(s [C x xs]) -> (+ (s xs) x) |
+			(s [N]) -> 0 .
+		(s [C 1 [C 2 [N]]])`,
+		`fun (sum Int Int) -> Int :
+			(sum 0 acc) -> acc |
+			(sum n acc) -> (+ acc (sum (stringToInt (intToString 0)) n)) .
+		(sum 5 10)`,
+		// calls of functions defined later in the file
+		`fun (f Int) -> Int : (f x) -> (g x) .
+		fun (g Int) -> Int : (g x) -> (+ x 1) .
+		(f 3)`,
+		// mutual recursion
+		`type [N]: Z | S [N] .
+		fun (even [N]) -> Int : (even [Z]) -> 1 | (even [S n]) -> (odd n) .
+		fun (odd [N]) -> Int : (odd [Z]) -> 0 | (odd [S n]) -> (even n) .
+		(even [S [S [S [Z]]]])`,
+		// too deep recursion is an error in both
+		`fun (f Int) -> Int : (f x) -> (+ 1 (f x)) .
+		(f 1)`,
+	}
+
+	for _, source := range tests {
+		if err := Check(source); err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+}
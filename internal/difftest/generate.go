@@ -0,0 +1,409 @@
+package difftest
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// genType is a type of the generated program: Int, String or one of the
+// generated algebraic types.
+type genType struct {
+	name         string
+	alternatives []*genConstructor
+}
+
+type genConstructor struct {
+	name   string
+	params []*genType
+	// qualified is set when another type has a constructor with the same
+	// name, so references have to be written as Type.Name.
+	qualified bool
+}
+
+type genFunction struct {
+	name   string
+	params []*genType
+	result *genType
+}
+
+type variable struct {
+	name string
+	typ  *genType
+}
+
+var (
+	intType    = &genType{name: "Int"}
+	stringType = &genType{name: "String"}
+)
+
+var constructorNames = []string{"A", "B", "Leaf", "Node", "Pair", "Nil"}
+
+var stringPool = []string{"", "a", "hello", "héllo", "x y", "-- not a comment", `q"uote`}
+
+// generator builds random programs that pass CheckSemantics, are well-typed
+// and terminate: functions only call functions defined before them, and
+// recursive calls only happen on a strict part of the first argument.
+type generator struct {
+	r         *rand.Rand
+	types     []*genType
+	functions []*genFunction
+	out       strings.Builder
+
+	// state of the rule being generated
+	current   *genFunction
+	selfVar   *variable
+	selfCalls int
+	names     int
+}
+
+// Generate returns the source of a random program.
+func Generate(r *rand.Rand) string {
+	g := &generator{r: r}
+	for i := 0; i < 1+r.Intn(3); i++ {
+		g.genTypeDef(i)
+	}
+	for i := 0; i < 1+r.Intn(4); i++ {
+		g.genFunDef(i)
+	}
+	for i := 0; i < 1+r.Intn(4); i++ {
+		call, ok := g.genCall(g.functions[r.Intn(len(g.functions))].result, nil, 3)
+		if !ok || r.Intn(4) == 0 {
+			call = g.genExpr(g.pickType(), nil, 3)
+		}
+		if !strings.HasPrefix(call, "(") || r.Intn(2) == 0 {
+			call = "(print " + call + ")"
+		}
+		g.out.WriteString(call + "\n")
+	}
+	return g.out.String()
+}
+
+func (g *generator) genTypeDef(index int) {
+	t := &genType{name: fmt.Sprintf("T%d", index)}
+	names := g.r.Perm(len(constructorNames))
+	for i := 0; i < 1+g.r.Intn(3); i++ {
+		c := &genConstructor{name: constructorNames[names[i]]}
+		for j := 0; j < g.r.Intn(3); j++ {
+			switch {
+			case i > 0 && g.r.Intn(2) == 0:
+				// only alternatives after the first one may be recursive,
+				// so that every type has finite values
+				c.params = append(c.params, t)
+			case len(g.types) > 0 && g.r.Intn(3) == 0:
+				c.params = append(c.params, g.types[g.r.Intn(len(g.types))])
+			case g.r.Intn(2) == 0:
+				c.params = append(c.params, stringType)
+			default:
+				c.params = append(c.params, intType)
+			}
+		}
+		for _, other := range g.types {
+			for _, alt := range other.alternatives {
+				if alt.name == c.name {
+					alt.qualified = true
+					c.qualified = true
+				}
+			}
+		}
+		t.alternatives = append(t.alternatives, c)
+	}
+	g.types = append(g.types, t)
+
+	alternatives := []string{}
+	for _, c := range t.alternatives {
+		parts := []string{c.name}
+		for _, p := range c.params {
+			parts = append(parts, typeString(p))
+		}
+		alternatives = append(alternatives, strings.Join(parts, " "))
+	}
+	fmt.Fprintf(&g.out, "type [%s]: %s .\n", t.name, strings.Join(alternatives, " | "))
+}
+
+func (g *generator) genFunDef(index int) {
+	f := &genFunction{name: fmt.Sprintf("f%d", index), result: g.pickType()}
+	for i := 0; i < 1+g.r.Intn(3); i++ {
+		f.params = append(f.params, g.pickType())
+	}
+	// functions over recursive types are the interesting ones: they recurse
+	recursive := []*genType{}
+	for _, t := range g.types {
+		if isRecursive(t) {
+			recursive = append(recursive, t)
+		}
+	}
+	if len(recursive) > 0 && g.r.Intn(2) == 0 {
+		f.params[0] = recursive[g.r.Intn(len(recursive))]
+	}
+	params := []string{}
+	for _, p := range f.params {
+		params = append(params, typeString(p))
+	}
+	fmt.Fprintf(&g.out, "fun (%s %s) -> %s :\n", f.name, strings.Join(params, " "), typeString(f.result))
+
+	g.current = f
+	rules := []string{}
+	ruleAmount := 1 + g.r.Intn(3)
+	for i := 0; i < ruleAmount; i++ {
+		g.names = 0
+		g.selfVar = nil
+		g.selfCalls = 0
+		env := []variable{}
+		patterns := []string{}
+		for j, p := range f.params {
+			var pattern string
+			switch {
+			case i == ruleAmount-1:
+				// the last rule only binds variables, so matching never fails
+				pattern = g.bind(p, &env)
+			case j == 0 && len(p.alternatives) > 0:
+				// other rules would be unreachable after one that only binds
+				// variables
+				pattern = g.genConstructorPattern(p, &env, 2)
+			default:
+				pattern = g.genPattern(p, &env, 2, false)
+			}
+			if j == 0 {
+				g.selfVar = strictPart(p, env)
+			}
+			patterns = append(patterns, pattern)
+		}
+		body := g.genExpr(f.result, env, 3)
+		rules = append(rules, fmt.Sprintf("    (%s %s) -> %s", f.name, strings.Join(patterns, " "), body))
+	}
+	g.out.WriteString(strings.Join(rules, " |\n") + " .\n")
+	g.current = nil
+	g.functions = append(g.functions, f)
+}
+
+// strictPart returns a variable of type t bound inside a constructor
+// pattern, if there is one among vars.
+func strictPart(t *genType, vars []variable) *variable {
+	for i := range vars {
+		if vars[i].typ == t && strings.HasPrefix(vars[i].name, "v") {
+			return &vars[i]
+		}
+	}
+	return nil
+}
+
+func (g *generator) bind(t *genType, env *[]variable) string {
+	// variables bound directly by a parameter are named p*, variables bound
+	// inside constructor patterns v*, so strictPart can tell them apart
+	name := fmt.Sprintf("p%d", g.names)
+	g.names++
+	*env = append(*env, variable{name: name, typ: t})
+	return name
+}
+
+// genPattern returns a pattern for type t. Variables bound inside a
+// constructor pattern (nested is set) hold a strict part of the argument.
+func (g *generator) genPattern(t *genType, env *[]variable, depth int, nested bool) string {
+	switch {
+	case t == intType && g.r.Intn(3) == 0:
+		return strconv.Itoa(g.r.Intn(4))
+	case t == stringType && g.r.Intn(3) == 0:
+		return strconv.Quote(stringPool[g.r.Intn(len(stringPool))])
+	case len(t.alternatives) > 0 && depth > 0 && g.r.Intn(3) > 0:
+		return g.genConstructorPattern(t, env, depth)
+	}
+	if nested {
+		name := fmt.Sprintf("v%d", g.names)
+		g.names++
+		*env = append(*env, variable{name: name, typ: t})
+		return name
+	}
+	return g.bind(t, env)
+}
+
+func (g *generator) genConstructorPattern(t *genType, env *[]variable, depth int) string {
+	c := t.alternatives[g.r.Intn(len(t.alternatives))]
+	parts := []string{constructorRef(t, c)}
+	for _, p := range c.params {
+		parts = append(parts, g.genPattern(p, env, depth-1, true))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func (g *generator) genExpr(t *genType, env []variable, depth int) string {
+	// options are repeated to make variables and calls more likely than
+	// literals
+	options := []func() (string, bool){
+		func() (string, bool) { return g.genLiteral(t, depth), true },
+		func() (string, bool) { return g.genVariable(t, env) },
+		func() (string, bool) { return g.genVariable(t, env) },
+		func() (string, bool) { return g.genSelfCall(t, env, depth) },
+		func() (string, bool) { return g.genFold(t, env, depth) },
+		func() (string, bool) { return g.genFold(t, env, depth) },
+		func() (string, bool) { return g.genCall(t, env, depth) },
+		func() (string, bool) { return g.genCall(t, env, depth) },
+		func() (string, bool) { return g.genBuiltin(t, env, depth) },
+	}
+	if depth <= 0 {
+		options = options[:3]
+	}
+	for {
+		expr, ok := options[g.r.Intn(len(options))]()
+		if ok {
+			return expr
+		}
+	}
+}
+
+func (g *generator) genLiteral(t *genType, depth int) string {
+	switch t {
+	case intType:
+		if g.r.Intn(10) == 0 {
+			return "9223372036854775807"
+		}
+		return strconv.Itoa(g.r.Intn(10))
+	case stringType:
+		return strconv.Quote(stringPool[g.r.Intn(len(stringPool))])
+	}
+	alternatives := t.alternatives
+	if depth <= 0 {
+		alternatives = alternatives[:1]
+	}
+	c := alternatives[g.r.Intn(len(alternatives))]
+	parts := []string{constructorRef(t, c)}
+	for _, p := range c.params {
+		parts = append(parts, g.genLiteral(p, depth-1))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func (g *generator) genVariable(t *genType, env []variable) (string, bool) {
+	candidates := []string{}
+	for _, v := range env {
+		if v.typ == t {
+			candidates = append(candidates, v.name)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	return candidates[g.r.Intn(len(candidates))], true
+}
+
+func (g *generator) genCall(t *genType, env []variable, depth int) (string, bool) {
+	candidates := []*genFunction{}
+	for _, f := range g.functions {
+		if f.result == t {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	f := candidates[g.r.Intn(len(candidates))]
+	parts := []string{f.name}
+	for _, p := range f.params {
+		parts = append(parts, g.genExpr(p, env, depth-1))
+	}
+	return "(" + strings.Join(parts, " ") + ")", true
+}
+
+func (g *generator) genSelfCall(t *genType, env []variable, depth int) (string, bool) {
+	f := g.current
+	if f == nil || f.result != t || g.selfVar == nil || g.selfCalls > 0 {
+		return "", false
+	}
+	g.selfCalls++
+	parts := []string{f.name, g.selfVar.name}
+	for _, p := range f.params[1:] {
+		parts = append(parts, g.genExpr(p, env, depth-1))
+	}
+	return "(" + strings.Join(parts, " ") + ")", true
+}
+
+// genFold combines a recursive call with another expression evaluated after
+// it, so the caller's bindings have to survive the call.
+func (g *generator) genFold(t *genType, env []variable, depth int) (string, bool) {
+	var op string
+	switch t {
+	case intType:
+		op = "+"
+	case stringType:
+		op = "concat"
+	default:
+		return "", false
+	}
+	call, ok := g.genSelfCall(t, env, depth)
+	if !ok {
+		return "", false
+	}
+	rest, ok := g.genVariable(t, env)
+	if !ok {
+		rest = g.genExpr(t, env, depth-1)
+	}
+	return "(" + op + " " + call + " " + rest + ")", true
+}
+
+func (g *generator) genBuiltin(t *genType, env []variable, depth int) (string, bool) {
+	switch t {
+	case intType:
+		switch g.r.Intn(3) {
+		case 0:
+			return "(strlen " + g.genExpr(stringType, env, depth-1) + ")", true
+		case 1:
+			return "(strcmp " + g.genExpr(stringType, env, depth-1) + " " + g.genExpr(stringType, env, depth-1) + ")", true
+		}
+		args := []string{"+"}
+		for i := 0; i < 1+g.r.Intn(3); i++ {
+			args = append(args, g.genExpr(intType, env, depth-1))
+		}
+		return "(" + strings.Join(args, " ") + ")", true
+	case stringType:
+		if g.r.Intn(2) == 0 {
+			return "(intToString " + g.genExpr(intType, env, depth-1) + ")", true
+		}
+		args := []string{"concat"}
+		for i := 0; i < 1+g.r.Intn(3); i++ {
+			if g.r.Intn(4) == 0 {
+				args = append(args, "'c'")
+				continue
+			}
+			args = append(args, g.genExpr(stringType, env, depth-1))
+		}
+		return "(" + strings.Join(args, " ") + ")", true
+	}
+	return "", false
+}
+
+func (g *generator) pickType() *genType {
+	switch n := g.r.Intn(len(g.types) + 2); n {
+	case 0:
+		return intType
+	case 1:
+		return stringType
+	default:
+		return g.types[n-2]
+	}
+}
+
+func isRecursive(t *genType) bool {
+	for _, c := range t.alternatives {
+		for _, p := range c.params {
+			if p == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeString(t *genType) string {
+	if len(t.alternatives) == 0 {
+		return t.name
+	}
+	return "[" + t.name + "]"
+}
+
+func constructorRef(t *genType, c *genConstructor) string {
+	if c.qualified {
+		return t.name + "." + c.name
+	}
+	return c.name
+}
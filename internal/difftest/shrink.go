@@ -0,0 +1,149 @@
+package difftest
+
+import (
+	"math/big"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+)
+
+// Shrink reduces source while fails keeps returning true for it. It tries
+// simple edits one at a time: removing definitions and rules, replacing an
+// expression with one of its arguments, dropping arguments of + and concat
+// and zeroing constants. An edit is kept when the edited program still
+// fails, and shrinking stops when no edit is kept.
+func Shrink(source string, fails func(string) bool) string {
+	for k := 0; ; k++ {
+		program, err := ast.ParseString("shrink", source)
+		if err != nil {
+			return source
+		}
+		e := &editor{k: k}
+		if !e.program(program) {
+			return source
+		}
+		candidate := ast.Format(program)
+		if candidate != source && fails(candidate) {
+			source = candidate
+			k = -1
+		}
+	}
+}
+
+// editor applies the k-th of the edits possible for a program. Each method
+// returns true once the edit has been applied.
+type editor struct {
+	k int
+}
+
+// next reports whether the current edit is the one to apply.
+func (e *editor) next() bool {
+	e.k--
+	return e.k < 0
+}
+
+func (e *editor) program(p *ast.Program) bool {
+	for i := range p.Definitions {
+		if e.next() {
+			p.Definitions = append(p.Definitions[:i], p.Definitions[i+1:]...)
+			return true
+		}
+	}
+	for _, d := range p.Definitions {
+		switch {
+		case d.FunDef != nil:
+			if e.funDef(d.FunDef) {
+				return true
+			}
+		case d.FunCall != nil:
+			// top-level definitions have to stay calls
+			for _, arg := range d.FunCall.Arguments {
+				if arg.FunCall != nil && e.next() {
+					d.FunCall = arg.FunCall
+					return true
+				}
+			}
+			if e.funCall(d.FunCall) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *editor) funDef(f *ast.FunDef) bool {
+	if len(f.Rules) > 1 {
+		for i := range f.Rules {
+			if e.next() {
+				f.Rules = append(f.Rules[:i], f.Rules[i+1:]...)
+				return true
+			}
+		}
+	}
+	for _, r := range f.Rules {
+		if e.expression(r.Expression) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *editor) expression(expr *ast.Expression) bool {
+	var args []*ast.Expression
+	switch {
+	case expr.FunCall != nil:
+		args = expr.FunCall.Arguments
+	case expr.ExprConstructor != nil:
+		args = expr.ExprConstructor.Arguments
+	case expr.Const != nil:
+		return e.constant(expr.Const)
+	}
+	for _, arg := range args {
+		if e.next() {
+			*expr = *arg
+			return true
+		}
+	}
+	if expr.FunCall != nil {
+		return e.funCall(expr.FunCall)
+	}
+	for _, arg := range args {
+		if e.expression(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *editor) funCall(call *ast.FunCall) bool {
+	if (call.Name == "+" || call.Name == "concat") && len(call.Arguments) > 1 {
+		for i := range call.Arguments {
+			if e.next() {
+				call.Arguments = append(call.Arguments[:i], call.Arguments[i+1:]...)
+				return true
+			}
+		}
+	}
+	for _, arg := range call.Arguments {
+		if e.expression(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *editor) constant(c *ast.Const) bool {
+	switch {
+	case c.Number != nil && c.Number.Sign() != 0:
+		if e.next() {
+			c.Number = new(big.Int)
+			return true
+		}
+	case c.Str != nil && *c.Str != "":
+		if e.next() {
+			empty := ""
+			c.Str = &empty
+			return true
+		}
+	}
+	return false
+}
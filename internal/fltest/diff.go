@@ -0,0 +1,77 @@
+package fltest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+)
+
+// Explain describes why a test failed. For a failed assertEq it lists the
+// places where the expected and the actual values differ.
+func Explain(err error) string {
+	var assertion *object.AssertionError
+	if !errors.As(err, &assertion) {
+		return err.Error() + "\n"
+	}
+	if assertion.Expected == nil {
+		return fmt.Sprintf("assertion failed: got %s\n", object.Render(assertion.Actual))
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "assertion failed\nexpected: %s\n     got: %s\n",
+		object.Render(assertion.Expected), object.Render(assertion.Actual))
+	for _, d := range Diff(assertion.Expected, assertion.Actual) {
+		out.WriteString(d + "\n")
+	}
+	return out.String()
+}
+
+// Diff walks two values together and returns a line for each subtree where
+// they differ, such as "at Cons.1: expected [B], got [A]". Arguments of a
+// constructor are numbered from 0.
+func Diff(expected, actual object.Object) []string {
+	return diff("", expected, actual, nil)
+}
+
+func diff(path string, expected, actual object.Object, found []string) []string {
+	left, leftOk := expected.(*object.Instance)
+	right, rightOk := actual.(*object.Instance)
+	if leftOk && rightOk && left.Constructor.EqualsTo(right.Constructor) &&
+		len(left.Args) == len(right.Args) {
+		for i := range left.Args {
+			found = diff(join(path, fmt.Sprintf("%s.%d", left.Constructor.Name, i)),
+				left.Args[i], right.Args[i], found)
+		}
+		return found
+	}
+	if object.Equal(expected, actual) {
+		return found
+	}
+	at := path
+	if at == "" {
+		at = "top"
+	}
+	return append(found, fmt.Sprintf("at %s: expected %s, got %s", at, object.Render(expected), object.Render(actual)))
+}
+
+func join(path, step string) string {
+	if path == "" {
+		return step
+	}
+	return path + "/" + step
+}
+
+func indent(text string) string {
+	lines := strings.SplitAfter(text, "\n")
+	var out strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			out.WriteString("    " + line)
+		}
+	}
+	if !strings.HasSuffix(text, "\n") {
+		out.WriteString("\n")
+	}
+	return out.String()
+}
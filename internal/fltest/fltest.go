@@ -0,0 +1,120 @@
+// Package fltest runs the `test "name": expr .` definitions of .fl
+// programs. Every test is compiled as its own entry point and run on a
+// fresh FVM; it passes when it finishes without an error, so its expression
+// is usually a call of assert or assertEq.
+package fltest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emrzvv/fl-compiler/internal/classes"
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/prelude"
+	"github.com/emrzvv/fl-compiler/internal/vm"
+)
+
+// Result is the outcome of a single test.
+type Result struct {
+	Name     string
+	Position string
+	// Output is what the test printed, including printErr.
+	Output string
+	// Err is nil if the test passed.
+	Err error
+}
+
+// Passed reports whether the test finished without an error.
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Run compiles the program at path, with the prelude imported if
+// withPrelude is set, and runs each of its tests. A program that does not
+// compile is an error, a program without tests has no results.
+func Run(path string, withPrelude bool) ([]Result, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	program, err := ast.ParseString(filepath.Base(path), string(source))
+	if err != nil {
+		return nil, err
+	}
+	if withPrelude {
+		program, err = prelude.Import(program)
+		if err != nil {
+			return nil, err
+		}
+	}
+	program, err = classes.Resolve(program)
+	if err != nil {
+		return nil, err
+	}
+	err = ast.CheckSemantics(
+		program,
+		make(map[ast.TypeDefKey]interface{}),
+		make(map[ast.ConstructorDefKey]interface{}),
+		make(map[ast.FunctionDefKey]interface{}),
+		make(map[ast.VariableDefKey]interface{}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	c := compiler.NewCompiler()
+	err = c.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	bytecode := c.Bytecode()
+
+	results := []Result{}
+	for _, test := range bytecode.Tests {
+		var out bytes.Buffer
+		entry := &compiler.Bytecode{
+			Instructions: test.Instructions,
+			Constants:    bytecode.Constants,
+			VarAmount:    bytecode.VarAmount,
+		}
+		// tests never wait for input
+		err := vm.NewFVM(entry,
+			vm.WithOutput(&out),
+			vm.WithErrorOutput(&out),
+			vm.WithInput(strings.NewReader("")),
+		).Run()
+		results = append(results, Result{
+			Name:     test.Name,
+			Position: fmt.Sprintf("%s:%d:%d", path, test.Line, test.Column),
+			Output:   out.String(),
+			Err:      err,
+		})
+	}
+	return results, nil
+}
+
+// Report writes a line per failed test to w, followed by its output and
+// the reason of the failure, and returns the number of failed tests. With
+// verbose set, passed tests are listed too.
+func Report(w io.Writer, results []Result, verbose bool) int {
+	failed := 0
+	for _, r := range results {
+		if r.Passed() {
+			if verbose {
+				fmt.Fprintf(w, "--- PASS %s (%s)\n", r.Name, r.Position)
+			}
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "--- FAIL %s (%s)\n", r.Name, r.Position)
+		if r.Output != "" {
+			fmt.Fprint(w, indent(r.Output))
+		}
+		fmt.Fprint(w, indent(Explain(r.Err)))
+	}
+	return failed
+}
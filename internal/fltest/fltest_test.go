@@ -0,0 +1,86 @@
+package fltest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/golden"
+)
+
+// TestSuite runs the tests defined in the programs in testdata/ at the
+// root of the repository.
+func TestSuite(t *testing.T) {
+	paths, err := golden.Discover([]string{"../../testdata"}, true)
+	if err != nil {
+		t.Fatalf("discover error: %s", err)
+	}
+	amount := 0
+	for _, path := range paths {
+		results, err := Run(path, true)
+		if err != nil {
+			continue
+		}
+		amount += len(results)
+		for _, r := range results {
+			if !r.Passed() {
+				t.Errorf("%s (%s): %s", r.Name, r.Position, Explain(r.Err))
+			}
+		}
+	}
+	if amount == 0 {
+		t.Fatalf("no tests found")
+	}
+}
+
+func TestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prog.fl")
+	err := os.WriteFile(path, []byte(`type [List x]: Cons x [List x] | Nil .
+type [Letter]: A | B .
+test "passes": (assertEq 3 (+ 1 2)) .
+test "differs": (assertEq [Cons [B] [Cons [A] [Nil]]] [Cons [B] [Cons [B] [Nil]]]) .
+test "prints": (assert (print 0)) .
+(print "not run")
+`), 0644)
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+
+	results, err := Run(path, true)
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if !results[0].Passed() || results[1].Passed() || results[2].Passed() {
+		t.Errorf("wrong results: %v", results)
+	}
+	if results[1].Position != path+":4:1" {
+		t.Errorf("wrong position %s", results[1].Position)
+	}
+	if results[2].Output != "0\n" {
+		t.Errorf("wrong output %q", results[2].Output)
+	}
+
+	var out bytes.Buffer
+	failed := Report(&out, results, false)
+	if failed != 2 {
+		t.Errorf("expected 2 failed tests, got %d", failed)
+	}
+	report := out.String()
+	for _, expected := range []string{
+		"--- FAIL differs",
+		"at Cons.1/Cons.0: expected [A], got [B]",
+		"--- FAIL prints",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("report does not contain %q:\n%s", expected, report)
+		}
+	}
+	if strings.Contains(report, "passes") {
+		t.Errorf("report lists a passed test:\n%s", report)
+	}
+}
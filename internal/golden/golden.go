@@ -0,0 +1,245 @@
+// Package golden runs .fl programs and compares what they print and the
+// error they stop with against expectation files next to them: prog.fl is
+// expected to print the contents of prog.out and to fail with the message
+// in prog.err. A missing expectation file means no output or no error. If
+// there is a prog.in, the program reads its input from it; what it prints
+// with printErr goes to prog.out too.
+package golden
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/emrzvv/fl-compiler/internal/classes"
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/prelude"
+	"github.com/emrzvv/fl-compiler/internal/vm"
+)
+
+const (
+	sourceExt = ".fl"
+	outExt    = ".out"
+	inExt     = ".in"
+	errExt    = ".err"
+)
+
+// Result is what running a program produced.
+type Result struct {
+	Output string
+	Err    string
+}
+
+// Failure describes a program whose result differs from its expectations.
+type Failure struct {
+	Path string
+	Diff string
+}
+
+func (f *Failure) Error() string {
+	return f.Path + ":\n" + f.Diff
+}
+
+// Discover returns the programs found in paths, which may be files or
+// directories searched recursively. Programs in directories are returned
+// only if they have an expectation file, unless all is set.
+func Discover(paths []string, all bool) ([]string, error) {
+	found := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			found = append(found, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || filepath.Ext(path) != sourceExt {
+				return nil
+			}
+			if all || exists(expectation(path, outExt)) || exists(expectation(path, errExt)) {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(found)
+	return found, nil
+}
+
+// Run compiles the program at path, with the prelude imported if
+// withPrelude is set, and runs it on the FVM, capturing what it prints.
+// Compilation errors are reported like runtime errors.
+func Run(path string, withPrelude bool) Result {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return Result{Err: err.Error()}
+	}
+	// positions in messages are relative to the file name only, so the
+	// expectations do not depend on where the suite is run from
+	program, err := ast.ParseString(filepath.Base(path), string(source))
+	if err != nil {
+		return Result{Err: err.Error()}
+	}
+	if withPrelude {
+		program, err = prelude.Import(program)
+		if err != nil {
+			return Result{Err: err.Error()}
+		}
+	}
+	program, err = classes.Resolve(program)
+	if err != nil {
+		return Result{Err: err.Error()}
+	}
+	err = ast.CheckSemantics(
+		program,
+		make(map[ast.TypeDefKey]interface{}),
+		make(map[ast.ConstructorDefKey]interface{}),
+		make(map[ast.FunctionDefKey]interface{}),
+		make(map[ast.VariableDefKey]interface{}),
+	)
+	if err != nil {
+		return Result{Err: err.Error()}
+	}
+	c := compiler.NewCompiler()
+	err = c.Compile(program)
+	if err != nil {
+		return Result{Err: err.Error()}
+	}
+
+	input, err := readExpectation(expectation(path, inExt))
+	if err != nil {
+		return Result{Err: err.Error()}
+	}
+	var out bytes.Buffer
+	err = vm.NewFVM(c.Bytecode(),
+		vm.WithOutput(&out),
+		vm.WithErrorOutput(&out),
+		vm.WithInput(strings.NewReader(input)),
+	).Run()
+	result := Result{Output: out.String()}
+	if err != nil {
+		result.Err = err.Error()
+	}
+	return result
+}
+
+// Check runs the program at path and compares the result with its
+// expectations. With update set, it writes the result to the expectation
+// files instead and never fails.
+func Check(path string, update bool, withPrelude bool) (*Failure, error) {
+	result := Run(path, withPrelude)
+	if update {
+		err := writeExpectation(expectation(path, outExt), result.Output)
+		if err != nil {
+			return nil, err
+		}
+		return nil, writeExpectation(expectation(path, errExt), result.Err)
+	}
+
+	expectedOutput, err := readExpectation(expectation(path, outExt))
+	if err != nil {
+		return nil, err
+	}
+	expectedErr, err := readExpectation(expectation(path, errExt))
+	if err != nil {
+		return nil, err
+	}
+	var diff strings.Builder
+	if result.Output != expectedOutput {
+		diff.WriteString("output differs:\n" + Diff(expectedOutput, result.Output))
+	}
+	if strings.TrimSpace(result.Err) != strings.TrimSpace(expectedErr) {
+		diff.WriteString("error differs:\n" + Diff(expectedErr, result.Err))
+	}
+	if diff.Len() == 0 {
+		return nil, nil
+	}
+	return &Failure{Path: path, Diff: diff.String()}, nil
+}
+
+// CheckAll checks paths with up to parallel programs running at once, or
+// one per CPU if parallel is not positive. Failures are returned in the
+// order of paths.
+func CheckAll(paths []string, update bool, parallel int, withPrelude bool) ([]*Failure, error) {
+	if parallel <= 0 {
+		parallel = runtime.NumCPU()
+	}
+	failures := make([]*Failure, len(paths))
+	errs := make([]error, len(paths))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indices {
+				failures[index], errs[index] = Check(paths[index], update, withPrelude)
+			}
+		}()
+	}
+	for i := range paths {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+	found := []*Failure{}
+	for _, f := range failures {
+		if f != nil {
+			found = append(found, f)
+		}
+	}
+	return found, nil
+}
+
+func expectation(path string, ext string) string {
+	return strings.TrimSuffix(path, sourceExt) + ext
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func readExpectation(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// writeExpectation writes content to path, or removes path if there is
+// nothing to expect.
+func writeExpectation(path string, content string) error {
+	if content == "" {
+		err := os.Remove(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
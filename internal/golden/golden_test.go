@@ -0,0 +1,105 @@
+package golden
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the expectation files of the suite")
+
+// TestSuite runs the programs in testdata/ at the root of the repository.
+func TestSuite(t *testing.T) {
+	paths, err := Discover([]string{"../../testdata"}, *update)
+	if err != nil {
+		t.Fatalf("discover error: %s", err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no programs found")
+	}
+	failures, err := CheckAll(paths, *update, 0, true)
+	if err != nil {
+		t.Fatalf("check error: %s", err)
+	}
+	for _, f := range failures {
+		t.Error(f)
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	program := filepath.Join(dir, "prog.fl")
+	writeFile(t, program, `(print "a") (print (charAt "" 0))`)
+	writeFile(t, filepath.Join(dir, "prog.out"), "b\n")
+	writeFile(t, filepath.Join(dir, "ignored.fl"), `(print "c")`)
+
+	paths, err := Discover([]string{dir}, false)
+	if err != nil {
+		t.Fatalf("discover error: %s", err)
+	}
+	if len(paths) != 1 || paths[0] != program {
+		t.Fatalf("expected only %s, got %v", program, paths)
+	}
+
+	failure, err := Check(program, false, true)
+	if err != nil {
+		t.Fatalf("check error: %s", err)
+	}
+	if failure == nil {
+		t.Fatalf("expected a failure")
+	}
+	for _, expected := range []string{"- b\n+ a\n", "+ error when indexing string"} {
+		if !strings.Contains(failure.Diff, expected) {
+			t.Errorf("expected diff to contain %q, got:\n%s", expected, failure.Diff)
+		}
+	}
+
+	failure, err = Check(program, true, true)
+	if failure != nil || err != nil {
+		t.Fatalf("update failed: %v %v", failure, err)
+	}
+	failure, err = Check(program, false, true)
+	if failure != nil || err != nil {
+		t.Fatalf("check after update failed: %v %v", failure, err)
+	}
+
+	writeFile(t, program, `(print "a")`)
+	_, err = Check(program, true, true)
+	if err != nil {
+		t.Fatalf("update error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "prog.err")); !os.IsNotExist(err) {
+		t.Errorf("expected stale prog.err to be removed, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		expected string
+		actual   string
+		diff     string
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", "  a\n  b\n  c\n"},
+		{"a\nb\nc\n", "a\nc\n", "  a\n- b\n  c\n"},
+		{"a\nc\n", "a\nb\nc\n", "  a\n+ b\n  c\n"},
+		{"", "x\n", "+ x\n"},
+		{"x\n", "y\n", "- x\n+ y\n"},
+	}
+
+	for _, tt := range tests {
+		diff := Diff(tt.expected, tt.actual)
+		if diff != tt.diff {
+			t.Errorf("wrong diff of %q and %q.\nexpected:\n%s\ngot:\n%s", tt.expected, tt.actual, tt.diff, diff)
+		}
+	}
+}
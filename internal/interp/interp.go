@@ -0,0 +1,516 @@
+// Package interp evaluates an ast.Program directly, without compiling it to
+// bytecode. It follows the semantics of the compiler and the FVM and serves
+// both as a quick way to run scripts and as a reference implementation to
+// test them against.
+package interp
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/native"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+	"github.com/emrzvv/fl-compiler/internal/types/pattern"
+)
+
+// MaxDepth limits nested function calls, like vm.MaxFrames does for the FVM.
+const MaxDepth = 1024
+
+type Interpreter struct {
+	constructors map[string][]*object.Constructor
+	// types has the names of the declared types
+	types     map[string]bool
+	functions map[string]*function
+	depth     int
+	registry  *native.Registry
+
+	out    io.Writer
+	errOut io.Writer
+	in     io.Reader
+	// input buffers in from the first read on
+	input *bufio.Reader
+}
+
+type function struct {
+	signature *ast.FunSignature
+	rules     []*rule
+}
+
+// rule is a function rule with its pattern converted to pattern.Pattern.
+// Variables of the rule are numbered from zero in the order they are bound.
+type rule struct {
+	patterns   []pattern.Pattern
+	variables  map[string]int
+	expression *ast.Expression
+}
+
+type Option func(*Interpreter)
+
+// WithNatives makes the native functions of registry callable.
+func WithNatives(registry *native.Registry) Option {
+	return func(in *Interpreter) {
+		in.registry = registry
+	}
+}
+
+// WithOutput redirects print and printNoNewline, which write to os.Stdout
+// by default.
+func WithOutput(out io.Writer) Option {
+	return func(in *Interpreter) {
+		in.out = out
+	}
+}
+
+// WithErrorOutput redirects printErr, which writes to os.Stderr by default.
+func WithErrorOutput(errOut io.Writer) Option {
+	return func(in *Interpreter) {
+		in.errOut = errOut
+	}
+}
+
+// WithInput sets where readInt and readLine read from, os.Stdin by default.
+func WithInput(input io.Reader) Option {
+	return func(in *Interpreter) {
+		in.in = input
+	}
+}
+
+func NewInterpreter(options ...Option) *Interpreter {
+	in := &Interpreter{
+		constructors: make(map[string][]*object.Constructor),
+		types:        make(map[string]bool),
+		functions:    make(map[string]*function),
+		out:          os.Stdout,
+		errOut:       os.Stderr,
+		in:           os.Stdin,
+	}
+	for _, option := range options {
+		option(in)
+	}
+	return in
+}
+
+// Run declares the types and functions of the program and evaluates its
+// top-level calls in order. It returns the value of the last call that has
+// one, which is what the FVM leaves on top of its stack.
+func (in *Interpreter) Run(program *ast.Program) (object.Object, error) {
+	for _, d := range program.Definitions {
+		if d.TypeDef != nil {
+			in.declareType(d.TypeDef)
+		}
+	}
+	for _, d := range program.Definitions {
+		if d.FunDef != nil {
+			err := in.declareFunction(d.FunDef)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var result object.Object
+	for _, d := range program.Definitions {
+		if d.FunCall == nil {
+			continue
+		}
+		value, err := in.call(d.FunCall, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			result = value
+		}
+	}
+	return result, nil
+}
+
+func (in *Interpreter) declareType(node *ast.TypeDef) {
+	in.types[node.TypeName.Name] = true
+	for _, constructor := range node.Constructors() {
+		in.constructors[constructor.Name] = append(in.constructors[constructor.Name], constructor)
+	}
+}
+
+func (in *Interpreter) declareFunction(node *ast.FunDef) error {
+	if _, ok := in.registry.Lookup(node.Signature.Name); ok {
+		return fmt.Errorf("function %s is already declared as native", node.Signature.Name)
+	}
+	f := &function{signature: node.Signature}
+	for _, r := range node.Rules {
+		compiled := &rule{variables: make(map[string]int), expression: r.Expression}
+		for _, arg := range r.Pattern.Arguments {
+			p, err := in.collectPattern(arg, compiled.variables)
+			if err != nil {
+				return err
+			}
+			compiled.patterns = append(compiled.patterns, p)
+		}
+		f.rules = append(f.rules, compiled)
+	}
+	in.functions[node.Signature.Name] = f
+	return nil
+}
+
+func (in *Interpreter) collectPattern(p *ast.PatternArgument, variables map[string]int) (pattern.Pattern, error) {
+	switch {
+	case p.Variable != "":
+		index := len(variables)
+		variables[p.Variable] = index
+		return &pattern.VariablePattern{Name: p.Variable, Index: index}, nil
+	case p.Const != nil:
+		return &pattern.ConstPattern{Const: constObject(p.Const)}, nil
+	case p.Tuple != nil:
+		args := []pattern.Pattern{}
+		for _, element := range p.Tuple.Elements {
+			elementPattern, err := in.collectPattern(element, variables)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, elementPattern)
+		}
+		return &pattern.TuplePattern{Args: args}, nil
+	}
+	constructor, err := in.resolveConstructor(&p.Name)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsRecord() {
+		return in.collectRecordPattern(p, constructor, variables)
+	}
+	args := []pattern.Pattern{}
+	for _, arg := range p.Arguments {
+		argPattern, err := in.collectPattern(arg, variables)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, argPattern)
+	}
+	return &pattern.ConstructorPattern{Constructor: constructor, Args: args}, nil
+}
+
+func (in *Interpreter) collectRecordPattern(p *ast.PatternArgument, constructor *object.Constructor, variables map[string]int) (pattern.Pattern, error) {
+	if len(constructor.Fields) == 0 {
+		return nil, fmt.Errorf("constructor %s is not a record", p.Name.String())
+	}
+	for _, field := range p.Fields {
+		if _, ok := constructor.Field(field); !ok {
+			return nil, fmt.Errorf("constructor %s has no field %s", p.Name.String(), field)
+		}
+	}
+	args := []pattern.Pattern{}
+	for _, field := range constructor.Fields {
+		if !slices.Contains(p.Fields, field) {
+			args = append(args, &pattern.WildcardPattern{})
+			continue
+		}
+		index := len(variables)
+		variables[field] = index
+		args = append(args, &pattern.VariablePattern{Name: field, Index: index})
+	}
+	return &pattern.ConstructorPattern{Constructor: constructor, Args: args}, nil
+}
+
+func (in *Interpreter) resolveConstructor(name *ast.ConstructorName) (*object.Constructor, error) {
+	found := []*object.Constructor{}
+	for _, constructor := range in.constructors[name.Name] {
+		if name.Type == "" || constructor.Supertype == name.Type {
+			found = append(found, constructor)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("could not find constructor %s", name)
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("ambiguous constructor %s, qualify it with the type name", name)
+}
+
+// eval evaluates e in the scope of a rule: variables holds the values bound
+// by its pattern, names maps variable names to their indices.
+func (in *Interpreter) eval(e *ast.Expression, variables []object.Object, names map[string]int) (object.Object, error) {
+	switch {
+	case e.FunCall != nil:
+		return in.call(e.FunCall, variables, names)
+	case e.ExprConstructor != nil:
+		constructor, err := in.resolveConstructor(&e.ExprConstructor.Name)
+		if err != nil {
+			return nil, err
+		}
+		args, err := in.evalArguments(e.ExprConstructor.Arguments, variables, names)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Instance{Constructor: constructor, Args: args}, nil
+	case e.Const != nil:
+		return constObject(e.Const), nil
+	case e.Tuple != nil:
+		elements, err := in.evalArguments(e.Tuple.Elements, variables, names)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Tuple{Elements: elements}, nil
+	case e.Field != nil:
+		return in.field(e.Field, variables, names)
+	}
+	index, ok := names[e.Variable]
+	if ok {
+		return variables[index], nil
+	}
+	// A function used as a value is represented by its name, like the
+	// CompiledFunction the compiler puts into the constants.
+	if f, ok := in.functions[e.Variable]; ok {
+		return &object.CompiledFunction{Name: e.Variable, Arity: len(f.signature.Parameters)}, nil
+	}
+	return nil, fmt.Errorf("no such variable %s", e.Variable)
+}
+
+func (in *Interpreter) field(node *ast.FieldAccess, variables []object.Object, names map[string]int) (object.Object, error) {
+	value, err := in.eval(node.Value, variables, names)
+	if err != nil {
+		return nil, err
+	}
+	if node.IsIndex() {
+		index, err := strconv.Atoi(node.Field)
+		if err != nil {
+			return nil, fmt.Errorf("wrong tuple index %s", node.Field)
+		}
+		tuple, ok := value.(*object.Tuple)
+		if !ok {
+			return nil, fmt.Errorf("error when projecting a tuple: not a tuple")
+		}
+		if index >= len(tuple.Elements) {
+			return nil, fmt.Errorf("error when projecting a tuple: no element %d in a tuple of %d", index, len(tuple.Elements))
+		}
+		return tuple.Elements[index], nil
+	}
+	instance, ok := value.(*object.Instance)
+	if !ok {
+		return nil, fmt.Errorf("error when accessing field %s: not a record", node.Field)
+	}
+	field, ok := instance.Constructor.Field(node.Field)
+	if !ok {
+		return nil, fmt.Errorf("error when accessing field %s: %s has no such field", node.Field, instance.Constructor.Name)
+	}
+	if field >= len(instance.Args) {
+		return nil, fmt.Errorf("error when accessing field %s: %s has %d arguments", node.Field, instance.Constructor.Name, len(instance.Args))
+	}
+	return instance.Args[field], nil
+}
+
+func (in *Interpreter) evalArguments(args []*ast.Expression, variables []object.Object, names map[string]int) ([]object.Object, error) {
+	values := make([]object.Object, len(args))
+	for i, arg := range args {
+		value, err := in.eval(arg, variables, names)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, fmt.Errorf("error when evaluating %s: expression has no value", arg)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (in *Interpreter) call(node *ast.FunCall, variables []object.Object, names map[string]int) (object.Object, error) {
+	args, err := in.evalArguments(node.Arguments, variables, names)
+	if err != nil {
+		return nil, err
+	}
+	name := node.Name
+	if index, ok := names[name]; ok {
+		function, ok := variables[index].(*object.CompiledFunction)
+		if !ok {
+			return nil, fmt.Errorf("error when trying to call function: %s is not a function", name)
+		}
+		if function.Arity != len(args) {
+			return nil, fmt.Errorf("error when trying to call function: %s expects %d arguments, got %d", function.Name, function.Arity, len(args))
+		}
+		name = function.Name
+	} else if ast.IsBuiltin(name) {
+		return in.builtin(name, args)
+	} else if nativeFunction, ok := in.registry.Lookup(name); ok {
+		return nativeFunction.Call(args, in.types)
+	}
+	f, ok := in.functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	if in.depth >= MaxDepth {
+		return nil, fmt.Errorf("stack overflow")
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+
+	for _, r := range f.rules {
+		bound := make([]object.Object, len(r.variables))
+		if matches(r.patterns, args, bound) {
+			return in.eval(r.expression, bound, r.variables)
+		}
+	}
+	return nil, fmt.Errorf("error when trying to match")
+}
+
+func matches(patterns []pattern.Pattern, args []object.Object, variables []object.Object) bool {
+	if len(patterns) != len(args) {
+		return false
+	}
+	for i, p := range patterns {
+		if !p.Matches(args[i], variables) {
+			return false
+		}
+	}
+	return true
+}
+
+func constObject(node *ast.Const) object.Object {
+	switch {
+	case node.Str != nil:
+		return &object.String{Value: *node.Str}
+	case node.Char != nil:
+		return &object.Char{Value: []rune(*node.Char)[0]}
+	}
+	return object.NewInteger(node.Number)
+}
+
+func (in *Interpreter) builtin(name string, args []object.Object) (object.Object, error) {
+	if arity, fixed := ast.BuiltinArity(name); fixed && arity != len(args) {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", name, arity, len(args))
+	}
+	switch name {
+	case "+":
+		sum := new(big.Int)
+		for _, arg := range args {
+			value, ok := object.IntegerValue(arg)
+			if !ok {
+				return nil, fmt.Errorf("error when adding values: not an integer")
+			}
+			sum.Add(sum, value)
+		}
+		return object.NewInteger(sum), nil
+	case "print":
+		fmt.Fprintln(in.out, args[0].String())
+		return nil, nil
+	case "concat":
+		parts := make([]string, len(args))
+		for i, arg := range args {
+			switch arg := arg.(type) {
+			case *object.String:
+				parts[i] = arg.Value
+			case *object.Char:
+				parts[i] = string(arg.Value)
+			default:
+				return nil, fmt.Errorf("error when concatenating: %s is not a string or char", arg.Type())
+			}
+		}
+		return &object.String{Value: strings.Join(parts, "")}, nil
+	}
+
+	switch name {
+	case "eq":
+		if object.Equal(args[0], args[1]) {
+			return &object.Integer{Value: 1}, nil
+		}
+		return &object.Integer{Value: 0}, nil
+	case "compare":
+		return &object.Integer{Value: int64(object.Compare(args[0], args[1]))}, nil
+	case "show":
+		return &object.String{Value: object.Render(args[0])}, nil
+	case "printNoNewline":
+		fmt.Fprint(in.out, args[0].String())
+		return nil, nil
+	case "printErr":
+		fmt.Fprintln(in.errOut, args[0].String())
+		return nil, nil
+	case "readLine":
+		return object.ReadLine(in.reader())
+	case "readInt":
+		value, err := object.ReadInt(in.reader())
+		if err != nil {
+			return nil, err
+		}
+		return object.NewInteger(value), nil
+	case "strlen":
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("error when taking length: not a string")
+		}
+		return &object.Integer{Value: int64(utf8.RuneCountInString(str.Value))}, nil
+	case "charAt":
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("error when indexing string: not a string")
+		}
+		index, ok := object.IntegerValue(args[1])
+		if !ok {
+			return nil, fmt.Errorf("error when indexing string: index is not an integer")
+		}
+		runes := []rune(str.Value)
+		if index.Sign() < 0 || index.Cmp(big.NewInt(int64(len(runes)))) >= 0 {
+			return nil, fmt.Errorf("error when indexing string: index %s out of range [0, %d)", index, len(runes))
+		}
+		return &object.Char{Value: runes[index.Int64()]}, nil
+	case "strcmp":
+		return compareText(args[0], args[1])
+	case "intToString":
+		integer, ok := object.IntegerValue(args[0])
+		if !ok {
+			return nil, fmt.Errorf("error when converting to string: not an integer")
+		}
+		return &object.String{Value: integer.String()}, nil
+	case "stringToInt":
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("error when converting to integer: not a string")
+		}
+		value, ok := new(big.Int).SetString(str.Value, 10)
+		if !ok {
+			return nil, fmt.Errorf("error when converting to integer: %q is not a number", str.Value)
+		}
+		return object.NewInteger(value), nil
+	case "assert":
+		if !object.Holds(args[0]) {
+			return nil, &object.AssertionError{Actual: args[0]}
+		}
+		return &object.Integer{Value: 1}, nil
+	case "assertEq":
+		if !object.Equal(args[0], args[1]) {
+			return nil, &object.AssertionError{Expected: args[0], Actual: args[1]}
+		}
+		return &object.Integer{Value: 1}, nil
+	}
+	return nil, fmt.Errorf("unknown builtin %s", name)
+}
+
+func (in *Interpreter) reader() *bufio.Reader {
+	if in.input == nil {
+		in.input = bufio.NewReader(in.in)
+	}
+	return in.input
+}
+
+func compareText(left, right object.Object) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.String:
+		right, ok := right.(*object.String)
+		if ok {
+			return &object.Integer{Value: int64(strings.Compare(left.Value, right.Value))}, nil
+		}
+	case *object.Char:
+		right, ok := right.(*object.Char)
+		if ok {
+			return &object.Integer{Value: int64(cmp.Compare(left.Value, right.Value))}, nil
+		}
+	}
+	return nil, fmt.Errorf("error when comparing: cannot compare %s with %s", left.Type(), right.Type())
+}
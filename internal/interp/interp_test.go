@@ -0,0 +1,213 @@
+package interp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/vm"
+)
+
+const lists = `type [List x]: Cons x [List x] | Nil .
+type [Letter]: A | B | C | D .
+fun (fab [List Letter]) -> [List Letter] :
+	(fab [Cons [A] xs]) -> [Cons [B] (fab xs)] |
+	(fab [Cons x xs]) -> [Cons x (fab xs)] |
+	(fab [Nil]) -> [Nil] .
+fun (len [List x]) -> Int :
+	(len [Cons x xs]) -> (+ 1 (len xs)) |
+	(len [Nil]) -> 0 .
+`
+
+type interpTestCase struct {
+	input    string
+	expected string
+	output   string
+}
+
+func runInterpTests(t *testing.T, tests []interpTestCase) {
+	t.Helper()
+	for _, tt := range tests {
+		program, err := ast.ParseString("tests", tt.input)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		var out bytes.Buffer
+		result, err := NewInterpreter(WithOutput(&out)).Run(program)
+		if err != nil {
+			t.Fatalf("interpreter error for %s: %s", tt.input, err)
+		}
+		actual := ""
+		if result != nil {
+			actual = result.String()
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong result for %s.\nexpected %s\ngot %s", tt.input, tt.expected, actual)
+		}
+		if out.String() != tt.output {
+			t.Errorf("wrong output for %s.\nexpected %q\ngot %q", tt.input, tt.output, out.String())
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []interpTestCase{
+		{"(+ 1 2)", "3", ""},
+		{"(print (+ 1 2))", "", "3\n"},
+		{"(+ 9223372036854775807 1)", "9223372036854775808", ""},
+		{`(concat "len: " (intToString (strlen "héllo")))`, "len: 5", ""},
+		{`(charAt "héllo" 1)`, "é", ""},
+		{`(strcmp "abc" "abd")`, "-1", ""},
+		{lists + "(len [Cons 1 [Cons 2 [Nil]]])", "2", ""},
+		{
+			lists + "(print (len [Nil])) (len [Cons [A] [Nil]])",
+			"1",
+			"0\n",
+		},
+		{
+			`fun (isZero Int) -> String :
+				(isZero 0) -> "zero" |
+				(isZero x) -> (concat "not zero: " (intToString x)) .
+			(isZero 0) (isZero 7)`,
+			"not zero: 7",
+			"",
+		},
+		{
+			`type [A]: Leaf .
+			type [B]: Node | Leaf .
+			fun (f [B]) -> Int :
+				(f [B.Leaf]) -> 1 |
+				(f [Node]) -> 2 .
+			(f [B.Leaf])`,
+			"1",
+			"",
+		},
+		{
+			`(f 3)
+			fun (f Int) -> Int : (f x) -> (g x) .
+			fun (g Int) -> Int : (g x) -> (+ x 1) .`,
+			"4",
+			"",
+		},
+	}
+
+	runInterpTests(t, tests)
+}
+
+func TestRecursionKeepsBindings(t *testing.T) {
+	tests := []interpTestCase{
+		{
+			`fun (sum Int Int) -> Int :
+				(sum 0 acc) -> acc |
+				(sum n acc) -> (+ acc (sum (stringToInt (intToString 0)) n)) .
+			(sum 5 10)`,
+			"15",
+			"",
+		},
+	}
+
+	runInterpTests(t, tests)
+}
+
+func TestInputOutput(t *testing.T) {
+	program, err := ast.ParseString("tests", `(printNoNewline "a")
+	(print (concat (readLine) "!"))
+	(printErr (+ (readInt) 1))
+	(readLine)`)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	var out, errOut bytes.Buffer
+	result, err := NewInterpreter(
+		WithOutput(&out),
+		WithErrorOutput(&errOut),
+		WithInput(strings.NewReader("b\r\n 41 \nlast")),
+	).Run(program)
+	if err != nil {
+		t.Fatalf("interpreter error: %s", err)
+	}
+	if out.String() != "ab!\n" || errOut.String() != "42\n" {
+		t.Errorf("wrong output %q and %q", out.String(), errOut.String())
+	}
+	if result.String() != "last" {
+		t.Errorf("expected the last line, got %s", result)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{`(charAt "abc" 3)`, "out of range"},
+		{`(stringToInt "4x")`, "is not a number"},
+		{`(+ 1 "2")`, "not an integer"},
+		{`fun (f Int) -> Int : (f 0) -> 0 . (f 1)`, "error when trying to match"},
+		{"type [A]: X | Y .\ntype [B]: P | Q .\nfun (f [A]) -> Int : (f [X]) -> 1 | (f [Y]) -> 2 .\n(f [Q])", "error when trying to match"},
+		{`fun (f Int) -> Int : (f x) -> (f x) . (f 1)`, "stack overflow"},
+		{`(g 1)`, "unknown function g"},
+		{"type [A]: Leaf .\ntype [B]: Leaf .\n(print [Leaf])", "ambiguous constructor Leaf"},
+		{`(readLine)`, "end of input"},
+		{`(readInt "x")`, "readInt expects 0 arguments, got 1"},
+		{"(print 1 2)", "print expects 1 arguments, got 2"},
+		{`(assert 0)`, "assertion failed: got 0"},
+		{`(assertEq "a" "b")`, `assertion failed: expected "a", got "b"`},
+	}
+
+	for _, tt := range tests {
+		program, err := ast.ParseString("tests", tt.input)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		_, err = NewInterpreter(WithOutput(&bytes.Buffer{}), WithInput(strings.NewReader(""))).Run(program)
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("expected error containing %q for %s, got %v", tt.contains, tt.input, err)
+		}
+	}
+}
+
+// TestSameAsVM checks that the interpreter and the FVM agree on programs
+// that the compiler handles.
+func TestSameAsVM(t *testing.T) {
+	tests := []string{
+		"(+ 1 2 (+ 3 4))",
+		`(concat "a" 'b' (intToString (+ 40 2)))`,
+		lists + "(fab [Cons [A] [Cons [C] [Cons [A] [Nil]]]])",
+		lists + "(len [Cons [A] [Cons [B] [Nil]]])",
+		lists + "(compare [Cons [A] [Nil]] [Cons [B] [Nil]])",
+		lists + `(eq [Cons "a" [Nil]] [Cons "a" [Nil]])`,
+		"fun (twice [Fun Int Int] Int) -> Int : (twice f x) -> (f (f x)) .\n" +
+			"fun (inc Int) -> Int : (inc x) -> (+ x 1) .\n(twice inc 1)",
+		"type [P]: P {a: Int, b: String} .\n" +
+			"fun (swap (, x y)) -> (, y x) : (swap (, l r)) -> (, r l) .\n" +
+			"fun (get [P]) -> (, String Int) : (get [P: b]) -> (swap (, (.a [P 1 b]) b)) .\n" +
+			`(get [P 7 "x"])`,
+	}
+
+	for _, input := range tests {
+		program, err := ast.ParseString("tests", input)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		expected, err := NewInterpreter().Run(program)
+		if err != nil {
+			t.Fatalf("interpreter error: %s", err)
+		}
+
+		comp := compiler.NewCompiler()
+		err = comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := vm.NewFVM(comp.Bytecode())
+		err = machine.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if machine.StackTop().String() != expected.String() {
+			t.Errorf("results differ for %s.\ninterpreter: %s\nvm: %s", input, expected, machine.StackTop())
+		}
+	}
+}
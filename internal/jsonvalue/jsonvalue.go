@@ -0,0 +1,359 @@
+// Package jsonvalue converts runtime values to JSON and back. Int is a JSON
+// number, String is a JSON string, Char is {"char":"c"} and an instance is
+// {"con":"Cons","args":[...]}, optionally with "type" to tell apart
+// same-named constructors of different types. A tuple is a JSON array.
+// Decoding checks the values against the type definitions of a program.
+package jsonvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"unicode/utf8"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+)
+
+// instance is the JSON form of an object.Instance.
+type instance struct {
+	Type        string            `json:"type,omitempty"`
+	Constructor string            `json:"con"`
+	Args        []json.RawMessage `json:"args"`
+}
+
+type char struct {
+	Char string `json:"char"`
+}
+
+// Encode returns the JSON form of value.
+func Encode(value object.Object) ([]byte, error) {
+	switch value := value.(type) {
+	case *object.Integer:
+		return json.Marshal(value.Value)
+	case *object.BigInteger:
+		return []byte(value.Value.String()), nil
+	case *object.String:
+		return json.Marshal(value.Value)
+	case *object.Char:
+		return json.Marshal(char{Char: string(value.Value)})
+	case *object.Instance:
+		encoded := instance{
+			Constructor: value.Constructor.Name,
+			Args:        make([]json.RawMessage, len(value.Args)),
+		}
+		for i, arg := range value.Args {
+			data, err := Encode(arg)
+			if err != nil {
+				return nil, err
+			}
+			encoded.Args[i] = data
+		}
+		return json.Marshal(encoded)
+	case *object.Tuple:
+		elements := make([]json.RawMessage, len(value.Elements))
+		for i, element := range value.Elements {
+			data, err := Encode(element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = data
+		}
+		return json.Marshal(elements)
+	case nil:
+		return nil, fmt.Errorf("no value to encode")
+	}
+	return nil, fmt.Errorf("cannot encode %s as JSON", value.Type())
+}
+
+// Types holds the type definitions of a program and the constructors
+// built from them, numbered like the compiler numbers them.
+type Types struct {
+	definitions  map[string]*ast.TypeDef
+	constructors map[string][]*object.Constructor
+	// parameters are the parameter types of each constructor
+	parameters map[*object.Constructor][]*ast.ConstructorParameter
+}
+
+// NewTypes collects the type definitions of program.
+func NewTypes(program *ast.Program) *Types {
+	types := &Types{
+		definitions:  make(map[string]*ast.TypeDef),
+		constructors: make(map[string][]*object.Constructor),
+		parameters:   make(map[*object.Constructor][]*ast.ConstructorParameter),
+	}
+	for _, d := range program.Definitions {
+		if d.TypeDef == nil {
+			continue
+		}
+		types.definitions[d.TypeDef.TypeName.Name] = d.TypeDef
+		for i, constructor := range d.TypeDef.Constructors() {
+			types.constructors[constructor.Name] = append(types.constructors[constructor.Name], constructor)
+			types.parameters[constructor] = d.TypeDef.TypeAlternatives[i].Constructor.Parameters
+		}
+	}
+	return types
+}
+
+// valueType is a type with its type variables replaced. A nil *valueType
+// stands for a type variable that is not known, which accepts any value.
+type valueType struct {
+	builtin string
+	name    string
+	// tuple types keep their element types in parameters
+	tuple      bool
+	parameters []*valueType
+}
+
+func (t *valueType) String() string {
+	if t == nil {
+		return "any value"
+	}
+	if t.builtin != "" {
+		return t.builtin
+	}
+	if t.tuple {
+		s := "(,"
+		for _, p := range t.parameters {
+			s += " " + p.String()
+		}
+		return s + ")"
+	}
+	s := "[" + t.name
+	for _, p := range t.parameters {
+		// parameters are written like in signatures, [List Letter]
+		if p != nil && p.builtin == "" && !p.tuple && len(p.parameters) == 0 {
+			s += " " + p.name
+			continue
+		}
+		s += " " + p.String()
+	}
+	return s + "]"
+}
+
+// Decode converts data to a value of type t, written as in a function
+// signature.
+func (types *Types) Decode(data []byte, t *ast.TypeCommon) (object.Object, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the value")
+	}
+	return types.decode(value, types.fromCommon(t, nil), "$")
+}
+
+func (types *Types) decode(value any, t *valueType, path string) (object.Object, error) {
+	switch value := value.(type) {
+	case json.Number:
+		if t != nil && t.builtin != "Int" {
+			return nil, fmt.Errorf("%s: expected %s, got a number", path, t)
+		}
+		integer, ok := new(big.Int).SetString(value.String(), 10)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is not an integer", path, value)
+		}
+		return object.NewInteger(integer), nil
+	case string:
+		if t != nil && t.builtin != "String" {
+			return nil, fmt.Errorf("%s: expected %s, got a string", path, t)
+		}
+		return &object.String{Value: value}, nil
+	case map[string]any:
+		if c, ok := value["char"]; ok && len(value) == 1 {
+			return decodeChar(c, t, path)
+		}
+		return types.decodeInstance(value, t, path)
+	case []any:
+		return types.decodeTuple(value, t, path)
+	}
+	return nil, fmt.Errorf("%s: expected %s, got %s", path, t, describe(value))
+}
+
+func decodeChar(value any, t *valueType, path string) (object.Object, error) {
+	if t != nil && t.builtin != "Char" {
+		return nil, fmt.Errorf("%s: expected %s, got a char", path, t)
+	}
+	s, ok := value.(string)
+	if !ok || utf8.RuneCountInString(s) != 1 {
+		return nil, fmt.Errorf("%s: a char has to be a string of one character", path)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return &object.Char{Value: r}, nil
+}
+
+func (types *Types) decodeInstance(value map[string]any, t *valueType, path string) (object.Object, error) {
+	if t != nil && (t.builtin != "" || t.tuple) {
+		return nil, fmt.Errorf("%s: expected %s, got a constructor", path, t)
+	}
+	name, ok := value["con"].(string)
+	if !ok {
+		return nil, fmt.Errorf(`%s: a constructor needs a "con" name`, path)
+	}
+	typeName, _ := value["type"].(string)
+	if t != nil {
+		if typeName != "" && typeName != t.name {
+			return nil, fmt.Errorf("%s: expected %s, got type %s", path, t, typeName)
+		}
+		typeName = t.name
+	}
+	constructor, err := types.constructor(typeName, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	args, ok := value["args"].([]any)
+	if value["args"] == nil {
+		args, ok = []any{}, true
+	}
+	if !ok {
+		return nil, fmt.Errorf(`%s: "args" of %s has to be an array`, path, name)
+	}
+	if int64(len(args)) != constructor.Arity {
+		return nil, fmt.Errorf("%s: %s takes %d arguments, got %d", path, name, constructor.Arity, len(args))
+	}
+
+	// bind the type variables of the definition to the parameters of t
+	definition := types.definitions[constructor.Supertype]
+	env := make(map[string]*valueType)
+	for i, general := range definition.TypeGeneral {
+		env[general.Name] = nil
+		if t != nil && i < len(t.parameters) {
+			env[general.Name] = t.parameters[i]
+		}
+	}
+	decoded := make([]object.Object, len(args))
+	for i, arg := range args {
+		argType := types.fromConstructorParameter(types.parameters[constructor][i], env)
+		decoded[i], err = types.decode(arg, argType, fmt.Sprintf("%s.args[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &object.Instance{Constructor: constructor, Args: decoded}, nil
+}
+
+func (types *Types) decodeTuple(value []any, t *valueType, path string) (object.Object, error) {
+	if t != nil && !t.tuple {
+		return nil, fmt.Errorf("%s: expected %s, got an array", path, t)
+	}
+	if t != nil && len(value) != len(t.parameters) {
+		return nil, fmt.Errorf("%s: expected %s, got an array of %d", path, t, len(value))
+	}
+	elements := make([]object.Object, len(value))
+	for i, element := range value {
+		var elementType *valueType
+		if t != nil {
+			elementType = t.parameters[i]
+		}
+		var err error
+		elements[i], err = types.decode(element, elementType, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &object.Tuple{Elements: elements}, nil
+}
+
+// constructor finds a constructor by name, in typeName if it is not empty.
+func (types *Types) constructor(typeName string, name string) (*object.Constructor, error) {
+	found := []*object.Constructor{}
+	for _, c := range types.constructors[name] {
+		if typeName == "" || c.Supertype == typeName {
+			found = append(found, c)
+		}
+	}
+	switch {
+	case len(found) == 1:
+		return found[0], nil
+	case len(found) > 1:
+		return nil, fmt.Errorf(`ambiguous constructor %s, add its "type"`, name)
+	case typeName != "":
+		return nil, fmt.Errorf("type %s has no constructor %s", typeName, name)
+	}
+	return nil, fmt.Errorf("unknown constructor %s", name)
+}
+
+func (types *Types) fromCommon(t *ast.TypeCommon, env map[string]*valueType) *valueType {
+	if t.TypeBuiltin != nil {
+		return &valueType{builtin: t.TypeBuiltin.Type}
+	}
+	if t.Tuple != nil {
+		return types.fromTuple(t.Tuple, env)
+	}
+	if len(t.TypeParameters) == 0 {
+		// [x] is how a signature writes a type variable
+		return types.fromName(t.TypeName.Name, env)
+	}
+	result := &valueType{name: t.TypeName.Name}
+	for _, p := range t.TypeParameters {
+		result.parameters = append(result.parameters, types.fromParameter(p, env))
+	}
+	return result
+}
+
+func (types *Types) fromParameter(p *ast.TypeParameter, env map[string]*valueType) *valueType {
+	switch {
+	case p.TypeCommon != nil:
+		return types.fromCommon(p.TypeCommon, env)
+	case p.TypeBuiltin != nil:
+		return &valueType{builtin: p.TypeBuiltin.Type}
+	}
+	return types.fromName(p.TypeGeneral.Name, env)
+}
+
+func (types *Types) fromConstructorParameter(p *ast.ConstructorParameter, env map[string]*valueType) *valueType {
+	if p.TypeGeneral != nil {
+		return types.fromName(p.TypeGeneral.Name, env)
+	}
+	if p.Tuple != nil {
+		return types.fromTuple(p.Tuple, env)
+	}
+	result := &valueType{name: p.TypeName.Name}
+	for _, list := range p.List {
+		result.parameters = append(result.parameters, types.fromParameter(list, env))
+	}
+	return result
+}
+
+func (types *Types) fromTuple(t *ast.TupleType, env map[string]*valueType) *valueType {
+	result := &valueType{tuple: true}
+	for _, element := range t.Elements {
+		result.parameters = append(result.parameters, types.fromParameter(element, env))
+	}
+	return result
+}
+
+// fromName resolves a name written without brackets, which the parser
+// does not tell apart from a type variable: it is a variable of the
+// definition in env, a builtin type, a defined type without parameters or
+// an unknown variable, in this order.
+func (types *Types) fromName(name string, env map[string]*valueType) *valueType {
+	if t, ok := env[name]; ok {
+		return t
+	}
+	switch name {
+	case "Int", "String", "Char":
+		return &valueType{builtin: name}
+	}
+	if _, ok := types.definitions[name]; ok {
+		return &valueType{name: name}
+	}
+	return nil
+}
+
+func describe(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case []any:
+		return "an array"
+	}
+	return fmt.Sprintf("%T", value)
+}
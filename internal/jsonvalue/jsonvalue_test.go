@@ -0,0 +1,163 @@
+package jsonvalue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+	"github.com/emrzvv/fl-compiler/internal/vm"
+)
+
+const source = `type [List x]: Cons x [List x] | Nil .
+type [Letter]: A | B | C .
+type [Other]: A .
+type [Pair x y]: Pair x y .
+type [Point]: Point {x: Int, y: Int} .
+
+fun (fab [List Letter]) -> [List Letter] :
+    (fab [Cons [Letter.A] xs]) -> [Cons [B] (fab xs)] |
+    (fab [Cons x xs])   -> [Cons x (fab xs)] |
+    (fab [Nil])         -> [Nil] .
+
+fun (first [Pair x y]) -> Int :
+    (first [Pair x y]) -> x .
+
+fun (len [List x]) -> Int :
+    (len [Cons x xs]) -> (+ 1 (len xs)) |
+    (len [Nil])       -> 0 .
+
+fun (tag [Pair String Char]) -> Int :
+    (tag p) -> 0 .
+
+fun (id [x]) -> [x] :
+    (id x) -> x .
+
+fun (swap (, Int [Letter])) -> (, [Letter] Int) :
+    (swap (, a b)) -> (, b a) .
+
+fun (gety [Point]) -> Int :
+    (gety p) -> (.y p) .
+`
+
+func parse(t *testing.T) *ast.Program {
+	t.Helper()
+	program, err := ast.ParseString("tests", source)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	return program
+}
+
+func parameter(program *ast.Program, name string) *ast.TypeCommon {
+	for _, d := range program.Definitions {
+		if d.FunDef != nil && d.FunDef.Signature.Name == name {
+			return d.FunDef.Signature.Parameters[0]
+		}
+	}
+	return nil
+}
+
+func TestCall(t *testing.T) {
+	program := parse(t)
+	c := compiler.NewCompiler()
+	err := c.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.NewFVM(c.Bytecode())
+	types := NewTypes(program)
+
+	tests := []struct {
+		function string
+		arg      string
+		expected string
+	}{
+		{"fab", `{"con":"Cons","args":[{"con":"A"},{"con":"Cons","args":[{"con":"C","args":[]},{"con":"Nil"}]}]}`,
+			`{"con":"Cons","args":[{"con":"B","args":[]},{"con":"Cons","args":[{"con":"C","args":[]},{"con":"Nil","args":[]}]}]}`},
+		{"first", `{"con":"Pair","args":[123456789012345678901234567890,{"char":"é"}]}`, `123456789012345678901234567890`},
+		{"first", `{"type":"Pair","con":"Pair","args":["text",{"type":"Other","con":"A"}]}`, `"text"`},
+		{"len", `{"con":"Cons","args":[{"char":"x"},{"con":"Cons","args":[1,{"con":"Nil"}]}]}`, `2`},
+		{"id", `{"con":"Nil"}`, `{"con":"Nil","args":[]}`},
+		{"id", `[1,["a",{"char":"b"}],[]]`, `[1,["a",{"char":"b"}],[]]`},
+		{"swap", `[1,{"con":"C"}]`, `[{"con":"C","args":[]},1]`},
+		{"gety", `{"con":"Point","args":[3,4]}`, `4`},
+	}
+
+	for _, tt := range tests {
+		arg, err := types.Decode([]byte(tt.arg), parameter(program, tt.function))
+		if err != nil {
+			t.Fatalf("decode error for %s: %s", tt.arg, err)
+		}
+		result, err := machine.Call(tt.function, arg)
+		if err != nil {
+			t.Fatalf("call error: %s", err)
+		}
+		data, err := Encode(result)
+		if err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("wrong result of %s.\nexpected %s\ngot %s", tt.function, tt.expected, data)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	program := parse(t)
+	types := NewTypes(program)
+	tests := []struct {
+		function string
+		arg      string
+		contains string
+	}{
+		{"fab", `{"con":"Cons","args":[1,{"con":"Nil"}]}`, "$.args[0]: expected [Letter], got a number"},
+		{"fab", `{"con":"Cons","args":[{"con":"D"},{"con":"Nil"}]}`, "$.args[0]: type Letter has no constructor D"},
+		{"fab", `{"con":"Cons","args":[{"con":"A"}]}`, "$: Cons takes 2 arguments, got 1"},
+		{"fab", `{"con":"Pair","args":[1,2]}`, "type List has no constructor Pair"},
+		{"fab", `{"type":"Pair","con":"Pair","args":[1,2]}`, "expected [List Letter], got type Pair"},
+		{"fab", `[1]`, "expected [List Letter], got an array"},
+		{"fab", `{"con":"Nil"} 1`, "unexpected data after the value"},
+		{"len", `{"con":"Cons","args":[{"con":"A"},{"con":"Nil"}]}`, "$.args[0]: ambiguous constructor A"},
+		{"len", `1.5`, "expected [List any value], got a number"},
+		{"tag", `{"con":"Pair","args":["a","b"]}`, "$.args[1]: expected Char, got a string"},
+		{"tag", `{"con":"Pair","args":["a",{"char":"bc"}]}`, "a char has to be a string of one character"},
+		{"tag", `{"con":"Pair","args":[true,{"char":"b"}]}`, "$.args[0]: expected String, got a boolean"},
+		{"first", `{"args":[]}`, `a constructor needs a "con" name`},
+		{"swap", `[1]`, "$: expected (, Int [Letter]), got an array of 1"},
+		{"swap", `[1,{"con":"Nil"}]`, "$[1]: type Letter has no constructor Nil"},
+		{"swap", `{"con":"Nil"}`, "expected (, Int [Letter]), got a constructor"},
+	}
+
+	for _, tt := range tests {
+		_, err := types.Decode([]byte(tt.arg), parameter(program, tt.function))
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("expected error containing %q for %s, got %v", tt.contains, tt.arg, err)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		value    object.Object
+		expected string
+	}{
+		{&object.Integer{Value: 42}, `42`},
+		{&object.String{Value: "a\"b"}, `"a\"b"`},
+		{&object.Char{Value: 'x'}, `{"char":"x"}`},
+	}
+	for _, tt := range tests {
+		data, err := Encode(tt.value)
+		if err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, data)
+		}
+	}
+	_, err := Encode(&object.CompiledFunction{})
+	if err == nil {
+		t.Errorf("expected an error for a function")
+	}
+}
@@ -0,0 +1,508 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/emrzvv/fl-compiler/internal/classes"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/prelude"
+)
+
+type document struct {
+	uri         string
+	version     int
+	text        string
+	diagnostics []Diagnostic
+
+	// program is the last successfully parsed version of the document and
+	// programText is the text it was parsed from, so completion keeps
+	// offering its names while the user is in the middle of an edit.
+	// Definition and hover take positions in text, which only match the
+	// positions of program while the document parses.
+	program     *ast.Program
+	programText string
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri}
+	d.update(version, text)
+	return d
+}
+
+func (d *document) update(version int, text string) {
+	d.version = version
+	d.text = text
+	d.diagnostics = []Diagnostic{}
+
+	program, err := ast.ParseString(d.uri, text)
+	if err != nil {
+		d.diagnostics = append(d.diagnostics, d.diagnostic(err))
+		return
+	}
+	d.program = program
+	d.programText = text
+
+	// the program is checked with the prelude, like fl runs it, but only
+	// its own definitions are navigated
+	imported, err := prelude.Import(program)
+	if err != nil {
+		d.diagnostics = append(d.diagnostics, d.diagnostic(err))
+		return
+	}
+	imported, err = classes.Resolve(imported)
+	if err != nil {
+		d.diagnostics = append(d.diagnostics, d.diagnostic(err))
+		return
+	}
+	err = ast.CheckSemantics(
+		imported,
+		make(map[ast.TypeDefKey]interface{}),
+		make(map[ast.ConstructorDefKey]interface{}),
+		make(map[ast.FunctionDefKey]interface{}),
+		make(map[ast.VariableDefKey]interface{}),
+	)
+	if err != nil {
+		d.diagnostics = append(d.diagnostics, d.diagnostic(err))
+	}
+}
+
+func (d *document) diagnostic(err error) Diagnostic {
+	offset := 0
+	message := err.Error()
+
+	var semanticErr *ast.SemanticError
+	var parseErr participle.Error
+	switch {
+	case errors.As(err, &semanticErr):
+		offset = semanticErr.Pos.Offset
+		message = semanticErr.Message
+		// calls are positioned at their opening bracket, point at the name
+		for offset < len(d.text) && d.text[offset] == '(' {
+			offset++
+		}
+	case errors.As(err, &parseErr):
+		offset = parseErr.Position().Offset
+		message = parseErr.Message()
+	}
+	start, end := wordBounds(d.text, offset)
+	if start == end && end < len(d.text) {
+		_, size := utf8.DecodeRuneInString(d.text[end:])
+		end += size
+	}
+	return Diagnostic{
+		Range:    textRange(d.text, start, end),
+		Severity: SeverityError,
+		Source:   "fl",
+		Message:  message,
+	}
+}
+
+// parsed reports whether program was parsed from the current text.
+func (d *document) parsed() bool {
+	return d.program != nil && d.programText == d.text
+}
+
+func (d *document) definition(pos Position) []Location {
+	offset := positionToOffset(d.text, pos)
+	start, end := wordBounds(d.text, offset)
+	if start == end || !d.parsed() {
+		return nil
+	}
+	word := d.text[start:end]
+	typeContext, rule := d.context(start)
+
+	var locations []Location
+	switch bracketBefore(d.text, start) {
+	case '(':
+		locations = d.functionLocations(word)
+	case '[':
+		switch {
+		case typeContext || (end < len(d.text) && d.text[end] == '.'):
+			locations = d.typeLocations(word)
+		default:
+			locations = d.constructorLocations(word, "")
+		}
+	case '.':
+		if qualifier := qualifierBefore(d.text, start); qualifier != "" {
+			locations = d.constructorLocations(word, qualifier)
+		}
+	default:
+		switch {
+		case rule != nil:
+			locations = d.variableLocations(rule, word)
+		case typeContext:
+			locations = append(d.typeLocations(word), d.constructorLocations(word, "")...)
+		}
+	}
+	return locations
+}
+
+func (d *document) hover(pos Position) *Hover {
+	offset := positionToOffset(d.text, pos)
+	start, end := wordBounds(d.text, offset)
+	if start == end || !d.parsed() {
+		return nil
+	}
+	word := d.text[start:end]
+	if bracketBefore(d.text, start) != '(' {
+		return nil
+	}
+
+	var signature string
+	if ast.IsBuiltin(word) {
+		signature = "builtin " + word
+	}
+	for _, def := range d.program.Definitions {
+		switch {
+		case def.FunDef != nil && def.FunDef.Signature.Name == word:
+			signature = def.FunDef.Signature.String()
+		case def.Class != nil && def.Class.Method(word) != nil:
+			signature = fmt.Sprintf("class [%s %s] : %s", def.Class.Name, def.Class.Variable, def.Class.Method(word))
+		}
+	}
+	if signature == "" {
+		return nil
+	}
+
+	r := textRange(d.text, start, end)
+	return &Hover{
+		Contents: MarkupContent{
+			Kind:  "markdown",
+			Value: "```fl\n" + signature + "\n```",
+		},
+		Range: &r,
+	}
+}
+
+func (d *document) completion(pos Position) []CompletionItem {
+	offset := positionToOffset(d.text, pos)
+	start := offset
+	for start > 0 && isIdentByte(d.text[start-1]) {
+		start--
+	}
+	prefix := d.text[start:offset]
+	items := []CompletionItem{}
+	if d.program == nil {
+		return items
+	}
+
+	add := func(label string, kind CompletionItemKind, detail string) {
+		if strings.HasPrefix(label, prefix) {
+			items = append(items, CompletionItem{Label: label, Kind: kind, Detail: detail})
+		}
+	}
+
+	switch bracketBefore(d.text, start) {
+	case '[', '.':
+		qualifier := qualifierBefore(d.text, start)
+		if qualifier == "" && bracketBefore(d.text, start) == '.' {
+			break
+		}
+		for _, def := range d.program.Definitions {
+			if def.TypeDef == nil || (qualifier != "" && def.TypeDef.TypeName.Name != qualifier) {
+				continue
+			}
+			for _, alt := range def.TypeDef.TypeAlternatives {
+				add(alt.Constructor.Name, CompletionConstructor, def.TypeDef.TypeName.Name)
+			}
+		}
+	case '(':
+		for _, def := range d.program.Definitions {
+			switch {
+			case def.FunDef != nil:
+				add(def.FunDef.Signature.Name, CompletionFunction, def.FunDef.Signature.String())
+			case def.Class != nil:
+				for _, m := range def.Class.Methods {
+					add(m.Name, CompletionMethod, m.String())
+				}
+			}
+		}
+		for _, builtin := range ast.Builtins {
+			add(builtin, CompletionFunction, "builtin")
+		}
+	}
+	return items
+}
+
+func (d *document) symbols() []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	if d.program == nil {
+		return symbols
+	}
+	text := d.programText
+
+	for _, def := range d.program.Definitions {
+		switch {
+		case def.TypeDef != nil:
+			td := def.TypeDef
+			symbol := DocumentSymbol{
+				Name:           td.TypeName.Name,
+				Kind:           SymbolClass,
+				Range:          textRange(text, td.Pos.Offset, trimEnd(text, td.EndPos.Offset)),
+				SelectionRange: nameRange(text, td.TypeName.Pos, td.TypeName.Name),
+			}
+			for _, alt := range td.TypeAlternatives {
+				selection := nameRange(text, alt.Constructor.Pos, alt.Constructor.Name)
+				symbol.Children = append(symbol.Children, DocumentSymbol{
+					Name:           alt.Constructor.Name,
+					Kind:           SymbolConstructor,
+					Range:          selection,
+					SelectionRange: selection,
+				})
+			}
+			symbols = append(symbols, symbol)
+		case def.FunDef != nil:
+			fd := def.FunDef
+			symbols = append(symbols, DocumentSymbol{
+				Name:           fd.Signature.Name,
+				Detail:         fd.Signature.String(),
+				Kind:           SymbolFunction,
+				Range:          textRange(text, fd.Pos.Offset, trimEnd(text, fd.EndPos.Offset)),
+				SelectionRange: nameRange(text, fd.Signature.Pos, fd.Signature.Name),
+			})
+		case def.Class != nil:
+			cd := def.Class
+			symbol := DocumentSymbol{
+				Name:           cd.Name,
+				Kind:           SymbolInterface,
+				Range:          textRange(text, cd.Pos.Offset, trimEnd(text, cd.EndPos.Offset)),
+				SelectionRange: nameRange(text, cd.Pos, cd.Name),
+			}
+			for _, m := range cd.Methods {
+				selection := nameRange(text, m.Pos, m.Name)
+				symbol.Children = append(symbol.Children, DocumentSymbol{
+					Name:           m.Name,
+					Detail:         m.String(),
+					Kind:           SymbolMethod,
+					Range:          selection,
+					SelectionRange: selection,
+				})
+			}
+			symbols = append(symbols, symbol)
+		case def.Instance != nil:
+			id := def.Instance
+			symbols = append(symbols, DocumentSymbol{
+				Name:           fmt.Sprintf("%s %s", id.Class, id.Type),
+				Kind:           SymbolObject,
+				Range:          textRange(text, id.Pos.Offset, trimEnd(text, id.EndPos.Offset)),
+				SelectionRange: nameRange(text, id.Pos, id.Class),
+			})
+		}
+	}
+	return symbols
+}
+
+// context reports whether offset lies inside a type expression (a type
+// definition, a class or the signature of a function or an instance) and,
+// if it lies inside a rule, which one.
+func (d *document) context(offset int) (bool, *ast.FunRule) {
+	inside := func(start, end lexer.Position) bool {
+		return start.Offset <= offset && offset < end.Offset
+	}
+	inRules := func(rules []*ast.FunRule) (bool, *ast.FunRule) {
+		if offset < rules[0].Pos.Offset {
+			return true, nil
+		}
+		for i, rule := range rules {
+			if i+1 == len(rules) || offset < rules[i+1].Pos.Offset {
+				return false, rule
+			}
+		}
+		return false, nil
+	}
+	for _, def := range d.program.Definitions {
+		switch {
+		case def.TypeDef != nil && inside(def.TypeDef.Pos, def.TypeDef.EndPos),
+			def.Class != nil && inside(def.Class.Pos, def.Class.EndPos):
+			return true, nil
+		case def.FunDef != nil && inside(def.FunDef.Pos, def.FunDef.EndPos):
+			return inRules(def.FunDef.Rules)
+		case def.Instance != nil && inside(def.Instance.Pos, def.Instance.EndPos):
+			return inRules(def.Instance.Rules)
+		}
+	}
+	return false, nil
+}
+
+func (d *document) functionLocations(name string) []Location {
+	locations := []Location{}
+	for _, def := range d.program.Definitions {
+		switch {
+		case def.FunDef != nil && def.FunDef.Signature.Name == name:
+			locations = append(locations, d.location(def.FunDef.Signature.Pos, name))
+		case def.Class != nil && def.Class.Method(name) != nil:
+			locations = append(locations, d.location(def.Class.Method(name).Pos, name))
+		}
+	}
+	return locations
+}
+
+func (d *document) typeLocations(name string) []Location {
+	locations := []Location{}
+	for _, def := range d.program.Definitions {
+		if def.TypeDef != nil && def.TypeDef.TypeName.Name == name {
+			locations = append(locations, d.location(def.TypeDef.TypeName.Pos, name))
+		}
+	}
+	return locations
+}
+
+// constructorLocations finds the constructors called name, only in the type
+// called typeName unless it is empty.
+func (d *document) constructorLocations(name string, typeName string) []Location {
+	locations := []Location{}
+	for _, def := range d.program.Definitions {
+		if def.TypeDef == nil || (typeName != "" && def.TypeDef.TypeName.Name != typeName) {
+			continue
+		}
+		for _, alt := range def.TypeDef.TypeAlternatives {
+			if alt.Constructor.Name == name {
+				locations = append(locations, d.location(alt.Constructor.Pos, name))
+			}
+		}
+	}
+	return locations
+}
+
+func (d *document) variableLocations(rule *ast.FunRule, name string) []Location {
+	locations := []Location{}
+	var collect func(args []*ast.PatternArgument)
+	collect = func(args []*ast.PatternArgument) {
+		for _, arg := range args {
+			if arg.Variable == name || (arg.IsRecord() && slices.Contains(arg.Fields, name)) {
+				locations = append(locations, d.location(arg.Pos, name))
+			}
+			if arg.Tuple != nil {
+				collect(arg.Tuple.Elements)
+			}
+			collect(arg.Arguments)
+		}
+	}
+	collect(rule.Pattern.Arguments)
+	return locations
+}
+
+func (d *document) location(pos lexer.Position, name string) Location {
+	return Location{URI: d.uri, Range: nameRange(d.programText, pos, name)}
+}
+
+// nameRange returns the range of the first occurrence of name at or after
+// pos; nodes like FunSignature start at a keyword rather than at their name.
+func nameRange(text string, pos lexer.Position, name string) Range {
+	start := pos.Offset
+	for i := start; i+len(name) <= len(text); i++ {
+		if text[i:i+len(name)] != name {
+			continue
+		}
+		before := i == 0 || !isIdentByte(text[i-1])
+		after := i+len(name) == len(text) || !isIdentByte(text[i+len(name)])
+		if before && after {
+			start = i
+			break
+		}
+	}
+	end := start + len(name)
+	if end > len(text) {
+		end = len(text)
+	}
+	return textRange(text, start, end)
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b == '+' ||
+		('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
+
+func wordBounds(text string, offset int) (int, int) {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	start, end := offset, offset
+	for start > 0 && isIdentByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isIdentByte(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+// bracketBefore returns the first non-blank character preceding offset.
+func bracketBefore(text string, offset int) byte {
+	for i := offset - 1; i >= 0; i-- {
+		switch text[i] {
+		case ' ', '\t', '\n', '\r':
+			continue
+		default:
+			return text[i]
+		}
+	}
+	return 0
+}
+
+// qualifierBefore returns the type name in front of a qualified
+// constructor reference such as Tree.Leaf, given the offset of the
+// constructor name.
+func qualifierBefore(text string, offset int) string {
+	if offset == 0 || text[offset-1] != '.' {
+		return ""
+	}
+	start, end := wordBounds(text, offset-1)
+	if start == end || bracketBefore(text, start) != '[' {
+		return ""
+	}
+	return text[start:end]
+}
+
+// trimEnd moves an EndPos offset, which points at the next token, back to
+// the end of the node's own last token.
+func trimEnd(text string, offset int) int {
+	for offset > 0 && strings.ContainsRune(" \t\n\r", rune(text[offset-1])) {
+		offset--
+	}
+	return offset
+}
+
+func textRange(text string, start, end int) Range {
+	return Range{Start: offsetToPosition(text, start), End: offsetToPosition(text, end)}
+}
+
+func offsetToPosition(text string, offset int) Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	return Position{
+		Line:      strings.Count(text[:offset], "\n"),
+		Character: utf16Len(text[lineStart:offset]),
+	}
+}
+
+func positionToOffset(text string, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		offset += next + 1
+	}
+	units := 0
+	for offset < len(text) && text[offset] != '\n' && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		units += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
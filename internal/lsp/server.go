@@ -0,0 +1,175 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// Run serves requests until the client sends "exit" or closes the input.
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			err = s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+
+		result, rerr := s.handle(&req)
+		if req.ID == nil {
+			continue
+		}
+		err = s.reply(req.ID, result, rerr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req *request) (interface{}, *responseError) {
+	switch req.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:       1, // full document sync
+				DefinitionProvider:     true,
+				HoverProvider:          true,
+				DocumentSymbolProvider: true,
+				CompletionProvider: &CompletionOptions{
+					TriggerCharacters: []string{"[", "("},
+				},
+			},
+			ServerInfo: ServerInfo{Name: "fl-lsp"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc := newDocument(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+		s.docs[doc.uri] = doc
+		s.publishDiagnostics(doc)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok || len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		doc.update(params.TextDocument.Version, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		s.publishDiagnostics(doc)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	case "textDocument/definition":
+		doc, params, rerr := s.positionParams(req)
+		if doc == nil {
+			return nil, rerr
+		}
+		return doc.definition(params.Position), nil
+	case "textDocument/hover":
+		doc, params, rerr := s.positionParams(req)
+		if doc == nil {
+			return nil, rerr
+		}
+		return doc.hover(params.Position), nil
+	case "textDocument/completion":
+		doc, params, rerr := s.positionParams(req)
+		if doc == nil {
+			return nil, rerr
+		}
+		return CompletionList{Items: doc.completion(params.Position)}, nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		return doc.symbols(), nil
+	default:
+		if req.ID != nil {
+			return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) positionParams(req *request) (*document, *TextDocumentPositionParams, *responseError) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, nil, invalidParams(err)
+	}
+	return s.docs[params.TextDocument.URI], &params, nil
+}
+
+func (s *Server) publishDiagnostics(doc *document) {
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: doc.diagnostics,
+	})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) error {
+	if rerr != nil {
+		return writeMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: rerr})
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
@@ -0,0 +1,380 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+)
+
+const testURI = "file:///test.fl"
+
+const testProgram = `type [List x]: Cons x [List x] | Nil .
+type [Letter]: A | B | C | D .
+
+fun (fab [List Letter]) -> [List Letter] :
+    (fab [Cons [A] xs]) -> [Cons [B] (fab xs)] |
+    (fab [Cons x xs]) -> [Cons x (fab xs)] |
+    (fab [Nil]) -> [Nil] .
+
+(print (fab [Cons [A] [Nil]]))`
+
+type rawMessage struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func runSession(t *testing.T, messages ...interface{}) []rawMessage {
+	t.Helper()
+	var in bytes.Buffer
+	for _, msg := range messages {
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatalf("writeMessage failed: %s", err)
+		}
+	}
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Run(); err != nil {
+		t.Fatalf("server error: %s", err)
+	}
+
+	replies := []rawMessage{}
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var msg rawMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("malformed reply %s: %s", body, err)
+		}
+		replies = append(replies, msg)
+	}
+	return replies
+}
+
+func call(id int, method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notify(method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func didOpen(text string) map[string]interface{} {
+	return notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "fl", Version: 1, Text: text},
+	})
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func findReply(t *testing.T, replies []rawMessage, id int) json.RawMessage {
+	t.Helper()
+	for _, r := range replies {
+		if r.ID != nil && *r.ID == id {
+			if r.Error != nil {
+				t.Fatalf("request %d failed: %s", id, r.Error.Message)
+			}
+			return r.Result
+		}
+	}
+	t.Fatalf("no reply for request %d", id)
+	return nil
+}
+
+func diagnostics(t *testing.T, replies []rawMessage) []Diagnostic {
+	t.Helper()
+	for _, r := range replies {
+		if r.Method == "textDocument/publishDiagnostics" {
+			var params PublishDiagnosticsParams
+			if err := json.Unmarshal(r.Params, &params); err != nil {
+				t.Fatalf("malformed diagnostics: %s", err)
+			}
+			return params.Diagnostics
+		}
+	}
+	t.Fatalf("no diagnostics published")
+	return nil
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Range
+		contains string
+	}{
+		{testProgram, []Range{}, ""},
+		{
+			"type [List x]: Cons x [List x] | Nil\n(print 1)",
+			[]Range{{Position{1, 0}, Position{1, 1}}},
+			"unexpected token",
+		},
+		{
+			"type [List x]: Nil .\n(print [Cons 1 [Nil]])",
+			[]Range{{Position{1, 8}, Position{1, 12}}},
+			"unknown constructor Cons",
+		},
+		{
+			"fun (id Int) -> Int :\n  (id x) -> y .",
+			[]Range{{Position{1, 12}, Position{1, 13}}},
+			"unknown variable y",
+		},
+	}
+
+	for _, tt := range tests {
+		replies := runSession(t, didOpen(tt.input))
+		actual := diagnostics(t, replies)
+		if len(actual) != len(tt.expected) {
+			t.Fatalf("wrong diagnostics for %q. expected %d, got %+v", tt.input, len(tt.expected), actual)
+		}
+		for i, d := range actual {
+			if d.Range != tt.expected[i] {
+				t.Errorf("wrong range. expected %+v, got %+v", tt.expected[i], d.Range)
+			}
+			if !strings.Contains(d.Message, tt.contains) {
+				t.Errorf("wrong message. expected %q in %q", tt.contains, d.Message)
+			}
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected Range
+	}{
+		{at(8, 9), Range{Position{3, 5}, Position{3, 8}}},    // fab call
+		{at(4, 11), Range{Position{0, 15}, Position{0, 19}}}, // Cons in pattern
+		{at(3, 11), Range{Position{0, 6}, Position{0, 10}}},  // List in signature
+		{at(5, 31), Range{Position{5, 15}, Position{5, 16}}}, // x bound in pattern
+		{at(0, 24), Range{Position{0, 6}, Position{0, 10}}},  // List in constructor parameter
+	}
+
+	messages := []interface{}{didOpen(testProgram)}
+	for i, tt := range tests {
+		messages = append(messages, call(i+1, "textDocument/definition", tt.position))
+	}
+	replies := runSession(t, messages...)
+	for i, tt := range tests {
+		var locations []Location
+		if err := json.Unmarshal(findReply(t, replies, i+1), &locations); err != nil {
+			t.Fatalf("malformed locations: %s", err)
+		}
+		if len(locations) != 1 || locations[0].Range != tt.expected {
+			t.Errorf("wrong definition at %+v. expected %+v, got %+v", tt.position.Position, tt.expected, locations)
+		}
+	}
+}
+
+func TestQualifiedConstructors(t *testing.T) {
+	program := "type [A]: Leaf .\ntype [B]: Leaf | Node .\n(print [B.Leaf])"
+	replies := runSession(t,
+		didOpen(program),
+		call(1, "textDocument/definition", at(2, 11)),
+		call(2, "textDocument/definition", at(2, 8)),
+		call(3, "textDocument/completion", at(2, 10)),
+	)
+
+	expected := []Range{
+		{Position{1, 10}, Position{1, 14}}, // B.Leaf
+		{Position{1, 6}, Position{1, 7}},   // B
+	}
+	for i, e := range expected {
+		var locations []Location
+		if err := json.Unmarshal(findReply(t, replies, i+1), &locations); err != nil {
+			t.Fatalf("malformed locations: %s", err)
+		}
+		if len(locations) != 1 || locations[0].Range != e {
+			t.Errorf("wrong definition %d. expected %+v, got %+v", i+1, e, locations)
+		}
+	}
+
+	var list CompletionList
+	if err := json.Unmarshal(findReply(t, replies, 3), &list); err != nil {
+		t.Fatalf("malformed completion: %s", err)
+	}
+	if len(list.Items) != 2 || list.Items[0].Label != "Leaf" || list.Items[1].Label != "Node" {
+		t.Errorf("wrong completion after qualifier: %+v", list.Items)
+	}
+}
+
+func TestHover(t *testing.T) {
+	replies := runSession(t,
+		didOpen(testProgram),
+		call(1, "textDocument/hover", at(4, 39)),
+		call(2, "textDocument/hover", at(4, 11)),
+	)
+
+	var hover Hover
+	if err := json.Unmarshal(findReply(t, replies, 1), &hover); err != nil {
+		t.Fatalf("malformed hover: %s", err)
+	}
+	expected := "fun (fab [List Letter]) -> [List Letter]"
+	if !strings.Contains(hover.Contents.Value, expected) {
+		t.Errorf("wrong hover. expected %q in %q", expected, hover.Contents.Value)
+	}
+	if string(findReply(t, replies, 2)) != "null" {
+		t.Errorf("expected no hover on constructor, got %s", findReply(t, replies, 2))
+	}
+}
+
+func TestNavigationAfterParseError(t *testing.T) {
+	// the new first line shifts fab, whose call is now on line 9
+	broken := "(print\n" + testProgram
+	replies := runSession(t,
+		didOpen(testProgram),
+		notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   VersionedTextDocumentIdentifier{URI: testURI, Version: 2},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: broken}},
+		}),
+		call(1, "textDocument/definition", at(9, 9)),
+		call(2, "textDocument/hover", at(9, 9)),
+	)
+
+	for id := 1; id <= 2; id++ {
+		if result := string(findReply(t, replies, id)); result != "null" {
+			t.Errorf("expected no result %d while the document does not parse, got %s", id, result)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	incomplete := testProgram + "\n(print (f [C"
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected []string
+	}{
+		{at(9, 12), []string{"Cons", "C"}},
+		{at(9, 9), []string{"fab"}},
+		{at(9, 1), append([]string{"fab"}, ast.Builtins...)},
+	}
+
+	messages := []interface{}{
+		didOpen(testProgram),
+		notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   VersionedTextDocumentIdentifier{URI: testURI, Version: 2},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: incomplete}},
+		}),
+	}
+	for i, tt := range tests {
+		messages = append(messages, call(i+1, "textDocument/completion", tt.position))
+	}
+	replies := runSession(t, messages...)
+	for i, tt := range tests {
+		var list CompletionList
+		if err := json.Unmarshal(findReply(t, replies, i+1), &list); err != nil {
+			t.Fatalf("malformed completion: %s", err)
+		}
+		labels := []string{}
+		for _, item := range list.Items {
+			labels = append(labels, item.Label)
+		}
+		if strings.Join(labels, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("wrong completion at %+v. expected %v, got %v", tt.position.Position, tt.expected, labels)
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	replies := runSession(t,
+		didOpen(testProgram),
+		call(1, "textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}),
+	)
+
+	var symbols []DocumentSymbol
+	if err := json.Unmarshal(findReply(t, replies, 1), &symbols); err != nil {
+		t.Fatalf("malformed symbols: %s", err)
+	}
+	expected := []struct {
+		name     string
+		kind     SymbolKind
+		children int
+	}{
+		{"List", SymbolClass, 2},
+		{"Letter", SymbolClass, 4},
+		{"fab", SymbolFunction, 0},
+	}
+	if len(symbols) != len(expected) {
+		t.Fatalf("wrong symbols count. expected %d, got %d", len(expected), len(symbols))
+	}
+	for i, e := range expected {
+		if symbols[i].Name != e.name || symbols[i].Kind != e.kind || len(symbols[i].Children) != e.children {
+			t.Errorf("wrong symbol %d. expected %+v, got %+v", i, e, symbols[i])
+		}
+	}
+	fab := symbols[2].Range
+	if fab.Start != (Position{3, 0}) || fab.End != (Position{6, 26}) {
+		t.Errorf("wrong function range %+v", fab)
+	}
+}
+
+func TestClasses(t *testing.T) {
+	program := `class [Pretty a] :
+    (pretty [a]) -> String .
+instance [Pretty Int] :
+    (pretty n) -> (show n) .
+(print (pretty 1))`
+	replies := runSession(t,
+		didOpen(program),
+		call(1, "textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}),
+		call(2, "textDocument/hover", at(4, 9)),
+		call(3, "textDocument/definition", at(4, 9)),
+		call(4, "textDocument/definition", at(3, 24)),
+	)
+
+	var symbols []DocumentSymbol
+	if err := json.Unmarshal(findReply(t, replies, 1), &symbols); err != nil {
+		t.Fatalf("malformed symbols: %s", err)
+	}
+	if len(symbols) != 2 ||
+		symbols[0].Name != "Pretty" || symbols[0].Kind != SymbolInterface || len(symbols[0].Children) != 1 ||
+		symbols[1].Name != "Pretty Int" || symbols[1].Kind != SymbolObject {
+		t.Errorf("wrong symbols %+v", symbols)
+	}
+
+	var hover Hover
+	if err := json.Unmarshal(findReply(t, replies, 2), &hover); err != nil {
+		t.Fatalf("malformed hover: %s", err)
+	}
+	expected := "class [Pretty a] : (pretty [a]) -> String"
+	if !strings.Contains(hover.Contents.Value, expected) {
+		t.Errorf("wrong hover. expected %q in %q", expected, hover.Contents.Value)
+	}
+
+	for id, expected := range map[int]Range{
+		3: {Position{1, 5}, Position{1, 11}},  // method in a call
+		4: {Position{3, 12}, Position{3, 13}}, // variable bound in an instance rule
+	} {
+		var locations []Location
+		if err := json.Unmarshal(findReply(t, replies, id), &locations); err != nil {
+			t.Fatalf("malformed locations: %s", err)
+		}
+		if len(locations) != 1 || locations[0].Range != expected {
+			t.Errorf("wrong definition %d. expected %+v, got %+v", id, expected, locations)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	replies := runSession(t,
+		call(1, "initialize", map[string]interface{}{}),
+		call(2, "shutdown", nil),
+		notify("exit", nil),
+		call(3, "textDocument/hover", at(0, 0)),
+	)
+	if len(replies) != 2 {
+		t.Errorf("expected server to stop after exit, got %d replies", len(replies))
+	}
+}
@@ -0,0 +1,139 @@
+// Package native lets host Go code expose functions to fl programs. A
+// function is declared with an fl signature and implemented in Go; the
+// compiler turns calls to it into OpCallNative and the FVM and the
+// interpreter call the implementation, checking the types of the arguments
+// and of the result against the signature.
+package native
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+)
+
+// Func implements a native function. It gets as many arguments as the
+// signature declares and has to return a value or an error.
+type Func func(args []object.Object) (object.Object, error)
+
+type Function struct {
+	Signature *ast.FunSignature
+	Impl      Func
+}
+
+// Registry is a set of native functions. The zero value is not usable, a
+// nil *Registry is an empty one.
+type Registry struct {
+	functions map[string]*Function
+}
+
+func NewRegistry() *Registry {
+	return &Registry{functions: make(map[string]*Function)}
+}
+
+// Register declares a native function with a signature written as in
+// source code, such as "fun (lookup String) -> Int".
+func (r *Registry) Register(signature string, impl Func) error {
+	parsed, err := ast.ParseSignature(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature %q: %w", signature, err)
+	}
+	name := parsed.Name
+	if ast.IsBuiltin(name) {
+		return fmt.Errorf("native function %s shadows a builtin", name)
+	}
+	if _, ok := r.functions[name]; ok {
+		return fmt.Errorf("native function %s already registered", name)
+	}
+	if impl == nil {
+		return fmt.Errorf("native function %s has no implementation", name)
+	}
+	r.functions[name] = &Function{Signature: parsed, Impl: impl}
+	return nil
+}
+
+// Lookup returns the native function called name.
+func (r *Registry) Lookup(name string) (*Function, bool) {
+	if r == nil {
+		return nil, false
+	}
+	f, ok := r.functions[name]
+	return f, ok
+}
+
+// Names returns the names of the registered functions in sorted order.
+func (r *Registry) Names() []string {
+	names := []string{}
+	if r == nil {
+		return names
+	}
+	for name := range r.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Declare adds the signatures of the registered functions to a function
+// map of ast.CheckSemantics, so that programs can call them and cannot
+// redefine them.
+func (r *Registry) Declare(functions map[ast.FunctionDefKey]interface{}) {
+	for _, name := range r.Names() {
+		functions[ast.FunctionDefKey{Name: name}] = r.functions[name].Signature
+	}
+}
+
+// Call runs the implementation of f after checking args against the
+// signature, and checks the result too. types has the names of the types
+// the program declares; other names in the signature are type variables.
+func (f *Function) Call(args []object.Object, types map[string]bool) (object.Object, error) {
+	name := f.Signature.Name
+	if len(args) != len(f.Signature.Parameters) {
+		return nil, fmt.Errorf("error when calling %s: expected %d arguments, got %d",
+			name, len(f.Signature.Parameters), len(args))
+	}
+	for i, arg := range args {
+		if !conforms(f.Signature.Parameters[i], arg, types) {
+			return nil, fmt.Errorf("error when calling %s: argument %d is not %s",
+				name, i, f.Signature.Parameters[i])
+		}
+	}
+	result, err := f.Impl(args)
+	if err != nil {
+		return nil, fmt.Errorf("error when calling %s: %w", name, err)
+	}
+	if result == nil || !conforms(f.Signature.ReturnType, result, types) {
+		return nil, fmt.Errorf("error when calling %s: result is not %s", name, f.Signature.ReturnType)
+	}
+	return result, nil
+}
+
+// conforms reports whether value has the type t. Type parameters and the
+// element types of tuples are not checked, and a type variable, a name
+// that is not in types, accepts any value.
+func conforms(t *ast.TypeCommon, value object.Object, types map[string]bool) bool {
+	if t.TypeBuiltin != nil {
+		switch t.TypeBuiltin.Type {
+		case "Int":
+			_, ok := object.IntegerValue(value)
+			return ok
+		case "String":
+			_, ok := value.(*object.String)
+			return ok
+		case "Char":
+			_, ok := value.(*object.Char)
+			return ok
+		}
+		return false
+	}
+	if t.Tuple != nil {
+		tuple, ok := value.(*object.Tuple)
+		return ok && len(tuple.Elements) == len(t.Tuple.Elements)
+	}
+	if !types[t.TypeName.Name] {
+		return true
+	}
+	instance, ok := value.(*object.Instance)
+	return ok && instance.Constructor.Supertype == t.TypeName.Name
+}
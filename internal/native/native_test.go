@@ -0,0 +1,244 @@
+package native_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+	"github.com/emrzvv/fl-compiler/internal/interp"
+	"github.com/emrzvv/fl-compiler/internal/native"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+	"github.com/emrzvv/fl-compiler/internal/vm"
+)
+
+// registry stubs a database of ages.
+func registry(t *testing.T) *native.Registry {
+	t.Helper()
+	ages := map[string]int64{"ann": 31, "bob": 27}
+	r := native.NewRegistry()
+	err := r.Register("fun (age String) -> Int", func(args []object.Object) (object.Object, error) {
+		name := args[0].(*object.String).Value
+		age, ok := ages[name]
+		if !ok {
+			return nil, fmt.Errorf("no such person %s", name)
+		}
+		return &object.Integer{Value: age}, nil
+	})
+	if err != nil {
+		t.Fatalf("register error: %s", err)
+	}
+	err = r.Register("fun (broken Int) -> [Person]", func(args []object.Object) (object.Object, error) {
+		return args[0], nil
+	})
+	if err != nil {
+		t.Fatalf("register error: %s", err)
+	}
+	// short returns a record without its last field
+	point := &object.Constructor{Name: "Point", Arity: 2, Supertype: "Point", Fields: []string{"x", "y"}}
+	err = r.Register("fun (short Int) -> [Point]", func(args []object.Object) (object.Object, error) {
+		return &object.Instance{Constructor: point, Args: args}, nil
+	})
+	if err != nil {
+		t.Fatalf("register error: %s", err)
+	}
+	return r
+}
+
+func check(t *testing.T, r *native.Registry, source string) (*ast.Program, error) {
+	t.Helper()
+	program, err := ast.ParseString("tests", source)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	functions := make(map[ast.FunctionDefKey]interface{})
+	r.Declare(functions)
+	return program, ast.CheckSemantics(
+		program,
+		make(map[ast.TypeDefKey]interface{}),
+		make(map[ast.ConstructorDefKey]interface{}),
+		functions,
+		make(map[ast.VariableDefKey]interface{}),
+	)
+}
+
+type outcome struct {
+	out string
+	err error
+}
+
+// run executes source on the FVM, after a round trip through the bytecode
+// format, and on the interpreter.
+func run(t *testing.T, r *native.Registry, source string) (outcome, outcome) {
+	t.Helper()
+	program, err := check(t, r, source)
+	if err != nil {
+		t.Fatalf("semantic error: %s", err)
+	}
+	c := compiler.NewCompiler(compiler.WithNatives(r))
+	err = c.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buffer bytes.Buffer
+	err = c.Bytecode().Write(&buffer)
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	bytecode, err := compiler.ReadBytecode(&buffer)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	err = vm.Verify(bytecode)
+	if err != nil {
+		t.Fatalf("verify error: %s", err)
+	}
+	var vmOut, interpOut bytes.Buffer
+	vmErr := vm.NewFVM(bytecode, vm.WithNatives(r), vm.WithOutput(&vmOut)).Run()
+	_, interpErr := interp.NewInterpreter(interp.WithNatives(r), interp.WithOutput(&interpOut)).Run(program)
+	return outcome{vmOut.String(), vmErr}, outcome{interpOut.String(), interpErr}
+}
+
+func TestNativeCalls(t *testing.T) {
+	r := registry(t)
+	machine, interpreter := run(t, r, `
+	fun (older String Int) -> Int : (older name n) -> (+ (age name) n) .
+	(print (older "ann" 1))
+	(print (+ (age "bob") (age "ann")))`)
+	if machine.err != nil || interpreter.err != nil {
+		t.Fatalf("run errors: %v, %v", machine.err, interpreter.err)
+	}
+	if machine.out != "32\n58\n" || interpreter.out != machine.out {
+		t.Errorf("wrong output %q and %q", machine.out, interpreter.out)
+	}
+}
+
+func TestPolymorphicNative(t *testing.T) {
+	r := native.NewRegistry()
+	err := r.Register("fun (pick Int [x] [x]) -> [x]", func(args []object.Object) (object.Object, error) {
+		if n, _ := object.IntegerValue(args[0]); n.Sign() == 0 {
+			return args[1], nil
+		}
+		return args[2], nil
+	})
+	if err != nil {
+		t.Fatalf("register error: %s", err)
+	}
+	machine, interpreter := run(t, r, `type [Color]: Red | Green .
+	(print (pick 0 "a" "b"))
+	(print (pick 1 [Red] [Green]))
+	(print (pick 1 (, 1 2) (, 3 4)))`)
+	if machine.err != nil || interpreter.err != nil {
+		t.Fatalf("run errors: %v, %v", machine.err, interpreter.err)
+	}
+	if machine.out != "a\n[Green]\n(, 3 4)\n" || interpreter.out != machine.out {
+		t.Errorf("wrong output %q and %q", machine.out, interpreter.out)
+	}
+}
+
+func TestNativeErrors(t *testing.T) {
+	r := registry(t)
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{`(age "eve")`, "error when calling age: no such person eve"},
+		{`(age 1)`, "error when calling age: argument 0 is not String"},
+		{"type [Person]: Person String .\n(broken 1)", "error when calling broken: result is not [Person]"},
+		{
+			"type [Point]: Point {x: Int, y: Int} .\n(print (.y (short 1)))",
+			"error when accessing field y: Point has 1 arguments",
+		},
+	}
+
+	for _, tt := range tests {
+		machine, interpreter := run(t, r, tt.input)
+		for _, err := range []error{machine.err, interpreter.err} {
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected error containing %q for %s, got %v", tt.contains, tt.input, err)
+			}
+		}
+	}
+}
+
+func TestNativeSemantics(t *testing.T) {
+	r := registry(t)
+	tests := []struct {
+		input       string
+		expectError bool
+	}{
+		{`(print (age "ann"))`, false},
+		{`(print (age "ann" "bob"))`, true},
+		{`fun (age String) -> Int : (age x) -> 0 .`, true},
+	}
+
+	for _, tt := range tests {
+		_, err := check(t, r, tt.input)
+		if (err != nil) != tt.expectError {
+			t.Errorf("CheckSemantics(%s) error = %v, expectErr %v", tt.input, err, tt.expectError)
+		}
+	}
+
+	_, err := check(t, nil, `(print (age "ann"))`)
+	if err == nil {
+		t.Errorf("expected an unknown function without natives")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	identity := func(args []object.Object) (object.Object, error) { return args[0], nil }
+	r := native.NewRegistry()
+	tests := []struct {
+		signature string
+		impl      native.Func
+		contains  string
+	}{
+		{"fun (id Int) -> Int", identity, ""},
+		{"fun (id String) -> String", identity, "already registered"},
+		{"fun (print Int) -> Int", identity, "shadows a builtin"},
+		{"fun (f Int) -> Int", nil, "has no implementation"},
+		{"fun (f Int)", identity, "invalid signature"},
+	}
+
+	for _, tt := range tests {
+		err := r.Register(tt.signature, tt.impl)
+		if tt.contains == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %s: %s", tt.signature, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("expected error containing %q for %s, got %v", tt.contains, tt.signature, err)
+		}
+	}
+	if names := r.Names(); len(names) != 1 || names[0] != "id" {
+		t.Errorf("wrong names %v", names)
+	}
+}
+
+func TestMissingNative(t *testing.T) {
+	r := registry(t)
+	program, err := check(t, r, `(print (age "ann"))`)
+	if err != nil {
+		t.Fatalf("semantic error: %s", err)
+	}
+	c := compiler.NewCompiler(compiler.WithNatives(r))
+	err = c.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = vm.NewFVM(c.Bytecode()).Run()
+	if err == nil || !strings.Contains(err.Error(), "unknown function age") {
+		t.Errorf("expected an unknown native function, got %v", err)
+	}
+
+	bytecode := c.Bytecode()
+	bytecode.Natives = nil
+	err = vm.Verify(bytecode)
+	if err == nil || !strings.Contains(err.Error(), "no native function 0") {
+		t.Errorf("expected a verify error, got %v", err)
+	}
+}
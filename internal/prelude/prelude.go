@@ -0,0 +1,277 @@
+// Package prelude holds the library of types and functions that every fl
+// program can use without declaring them: List, Maybe, Either, Pair, Bool,
+// Ordering and the usual functions over lists. The source is prelude.fl,
+// embedded into the binaries.
+package prelude
+
+import (
+	_ "embed"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+)
+
+// Filename is the file name positions in the prelude refer to.
+const Filename = "prelude.fl"
+
+//go:embed prelude.fl
+var source string
+
+// Program parses the prelude. Every call returns a new tree, so callers
+// may change it.
+func Program() (*ast.Program, error) {
+	return ast.ParseString(Filename, source)
+}
+
+type constructorKey struct {
+	name  string
+	arity int
+}
+
+type instanceKey struct {
+	class string
+	head  string
+}
+
+// Import returns program with the prelude definitions it does not override
+// added. A prelude type is left out if program declares a type
+// of the same name or one of its constructors; a prelude function if
+// program declares a function or a method of the same name, or if it
+// refers to a constructor or a prelude function that is left out. A prelude
+// class is left out if program declares a class of the same name or a
+// function or a method named like one of its methods, and a prelude
+// instance if program declares the instance of the class for the same type,
+// or if its class, its type or what it refers to is left out. This way the
+// definitions of the program always win and the prelude never refers to
+// something the program has replaced.
+func Import(program *ast.Program) (*ast.Program, error) {
+	lib, err := Program()
+	if err != nil {
+		return nil, err
+	}
+
+	typeNames := map[string]bool{}
+	constructorNames := map[string]bool{}
+	functionNames := map[string]bool{}
+	constructors := map[constructorKey]bool{}
+	classNames := map[string]bool{}
+	instances := map[instanceKey]bool{}
+	for _, d := range program.Definitions {
+		switch {
+		case d.TypeDef != nil:
+			typeNames[d.TypeDef.TypeName.Name] = true
+			for _, alt := range d.TypeDef.TypeAlternatives {
+				constructorNames[alt.Constructor.Name] = true
+				constructors[constructorKey{alt.Constructor.Name, len(alt.Constructor.Parameters)}] = true
+			}
+		case d.FunDef != nil:
+			functionNames[d.FunDef.Signature.Name] = true
+		case d.Class != nil:
+			classNames[d.Class.Name] = true
+			for _, m := range d.Class.Methods {
+				functionNames[m.Name] = true
+			}
+		case d.Instance != nil:
+			instances[instanceKey{d.Instance.Class, d.Instance.Head()}] = true
+		}
+	}
+
+	keptTypes := map[string]bool{}
+	libTypes := map[string]bool{}
+	libFunctions := map[string]*ast.FunDef{}
+	libMethods := map[string]string{}
+	keptClasses := map[string]bool{}
+	for _, d := range lib.Definitions {
+		switch {
+		case d.TypeDef != nil:
+			libTypes[d.TypeDef.TypeName.Name] = true
+			if overridesType(d.TypeDef, typeNames, constructorNames) {
+				continue
+			}
+			keptTypes[d.TypeDef.TypeName.Name] = true
+			for _, alt := range d.TypeDef.TypeAlternatives {
+				constructors[constructorKey{alt.Constructor.Name, len(alt.Constructor.Parameters)}] = true
+			}
+		case d.FunDef != nil:
+			libFunctions[d.FunDef.Signature.Name] = d.FunDef
+		case d.Class != nil:
+			keptClasses[d.Class.Name] = !classNames[d.Class.Name]
+			for _, m := range d.Class.Methods {
+				libMethods[m.Name] = d.Class.Name
+				keptClasses[d.Class.Name] = keptClasses[d.Class.Name] && !functionNames[m.Name]
+			}
+		}
+	}
+
+	kept := map[string]bool{}
+	for name := range libFunctions {
+		kept[name] = !functionNames[name]
+	}
+	// refers reports whether a call of name still refers to a function or
+	// a method that is there
+	refers := func(name string) bool {
+		if class, ok := libMethods[name]; ok {
+			return keptClasses[class]
+		}
+		_, inPrelude := libFunctions[name]
+		return !inPrelude || kept[name]
+	}
+	// leaving out a function may leave out the functions that call it
+	for changed := true; changed; {
+		changed = false
+		for name, f := range libFunctions {
+			if kept[name] && !resolves(f.Rules, constructors, refers) {
+				kept[name] = false
+				changed = true
+			}
+		}
+	}
+
+	keptInstances := map[*ast.InstanceDef]bool{}
+	for _, d := range lib.Definitions {
+		if d.Instance == nil {
+			continue
+		}
+		head := d.Instance.Head()
+		keptInstances[d.Instance] = keptClasses[d.Instance.Class] &&
+			!instances[instanceKey{d.Instance.Class, head}] &&
+			(!libTypes[head] || keptTypes[head]) &&
+			resolves(d.Instance.Rules, constructors, refers)
+	}
+
+	// types go first: the compiler resolves constructors in the order of the
+	// definitions, and prelude functions may use the types of the program
+	definitions := []*ast.Definition{}
+	for _, d := range lib.Definitions {
+		if d.TypeDef != nil && keptTypes[d.TypeDef.TypeName.Name] {
+			definitions = append(definitions, d)
+		}
+	}
+	for _, d := range program.Definitions {
+		if d.TypeDef != nil {
+			definitions = append(definitions, d)
+		}
+	}
+	for _, d := range lib.Definitions {
+		switch {
+		case d.FunDef != nil && kept[d.FunDef.Signature.Name],
+			d.Class != nil && keptClasses[d.Class.Name],
+			d.Instance != nil && keptInstances[d.Instance]:
+			definitions = append(definitions, d)
+		}
+	}
+	for _, d := range program.Definitions {
+		if d.TypeDef == nil {
+			definitions = append(definitions, d)
+		}
+	}
+	return &ast.Program{
+		Pos:         program.Pos,
+		Definitions: definitions,
+		Comments:    program.Comments,
+	}, nil
+}
+
+func overridesType(t *ast.TypeDef, typeNames map[string]bool, constructorNames map[string]bool) bool {
+	if typeNames[t.TypeName.Name] {
+		return true
+	}
+	for _, alt := range t.TypeAlternatives {
+		if constructorNames[alt.Constructor.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// resolves reports whether every constructor the rules refer to is still
+// there, and every function for which function reports true.
+func resolves(rules []*ast.FunRule, constructors map[constructorKey]bool, function func(string) bool) bool {
+	for _, rule := range rules {
+		bound := map[string]bool{}
+		for _, arg := range rule.Pattern.Arguments {
+			if !patternResolves(arg, constructors, bound) {
+				return false
+			}
+		}
+		refers := func(name string) bool {
+			return bound[name] || function(name)
+		}
+		if !expressionResolves(rule.Expression, constructors, refers) {
+			return false
+		}
+	}
+	return true
+}
+
+func patternResolves(p *ast.PatternArgument, constructors map[constructorKey]bool, bound map[string]bool) bool {
+	switch {
+	case p.Variable != "":
+		bound[p.Variable] = true
+		return true
+	case p.Const != nil:
+		return true
+	case p.Tuple != nil:
+		for _, element := range p.Tuple.Elements {
+			if !patternResolves(element, constructors, bound) {
+				return false
+			}
+		}
+		return true
+	case p.IsRecord():
+		if !constructorNamed(constructors, p.Name.Name) {
+			return false
+		}
+		for _, field := range p.Fields {
+			bound[field] = true
+		}
+		return true
+	}
+	if !constructors[constructorKey{p.Name.Name, len(p.Arguments)}] {
+		return false
+	}
+	for _, arg := range p.Arguments {
+		if !patternResolves(arg, constructors, bound) {
+			return false
+		}
+	}
+	return true
+}
+
+func expressionResolves(e *ast.Expression, constructors map[constructorKey]bool, function func(string) bool) bool {
+	var args []*ast.Expression
+	switch {
+	case e.FunCall != nil:
+		if !function(e.FunCall.Name) {
+			return false
+		}
+		args = e.FunCall.Arguments
+	case e.ExprConstructor != nil:
+		if !constructors[constructorKey{e.ExprConstructor.Name.Name, len(e.ExprConstructor.Arguments)}] {
+			return false
+		}
+		args = e.ExprConstructor.Arguments
+	case e.Tuple != nil:
+		args = e.Tuple.Elements
+	case e.Field != nil:
+		args = []*ast.Expression{e.Field.Value}
+	case e.Variable != "":
+		return function(e.Variable)
+	}
+	for _, arg := range args {
+		if !expressionResolves(arg, constructors, function) {
+			return false
+		}
+	}
+	return true
+}
+
+// constructorNamed reports whether there is a constructor called name of any
+// arity, which is all a record pattern tells about its constructor.
+func constructorNamed(constructors map[constructorKey]bool, name string) bool {
+	for key := range constructors {
+		if key.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package prelude
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/classes"
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+)
+
+func names(program *ast.Program) []string {
+	found := []string{}
+	for _, d := range program.Definitions {
+		switch {
+		case d.TypeDef != nil:
+			found = append(found, d.TypeDef.TypeName.Name)
+		case d.FunDef != nil:
+			found = append(found, d.FunDef.Signature.Name)
+		case d.Class != nil:
+			found = append(found, d.Class.Name)
+		case d.Instance != nil:
+			found = append(found, d.Instance.Class+" "+d.Instance.Head())
+		}
+	}
+	return found
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		kept    []string
+		dropped []string
+	}{
+		{
+			name:  "nothing overridden",
+			input: `(print (sort [Cons 2 [Cons 1 [Nil]]]))`,
+			kept:  []string{"List", "Maybe", "map", "sort", "lookup"},
+		},
+		{
+			name:  "same List",
+			input: `type [List x]: Cons x [List x] | Nil .`,
+			kept:  []string{"map", "reverse", "zip"},
+		},
+		{
+			name:    "function",
+			input:   `fun (foldl Int) -> Int : (foldl x) -> x .`,
+			kept:    []string{"foldr", "map"},
+			dropped: []string{"reverse", "sum"},
+		},
+		{
+			name:    "constructor of another type",
+			input:   `type [Color]: Red | Nothing .`,
+			kept:    []string{"List", "map"},
+			dropped: []string{"Maybe", "lookup", "lookupNext"},
+		},
+		{
+			name:    "constructor with another arity",
+			input:   `type [List x]: Cons x | Nil .`,
+			kept:    []string{"toBool", "order"},
+			dropped: []string{"map", "length", "sort"},
+		},
+		{
+			name:    "method",
+			input:   `class [Mappable f] : (fmap [Fun a b] [f a]) -> [f b] .`,
+			kept:    []string{"Show", "Eq", "map"},
+			dropped: []string{"Functor", "Functor List", "Functor Maybe"},
+		},
+		{
+			name:    "type of an instance",
+			input:   `type [Maybe x]: None | Some x .`,
+			kept:    []string{"Functor", "Functor List"},
+			dropped: []string{"Functor Maybe"},
+		},
+		{
+			name:    "function of an instance",
+			input:   `fun (map Int) -> Int : (map x) -> x .`,
+			kept:    []string{"Functor", "Functor Maybe"},
+			dropped: []string{"Functor List"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := ast.ParseString("tests", tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %s", err)
+			}
+			imported, err := Import(program)
+			if err != nil {
+				t.Fatalf("import error: %s", err)
+			}
+			found := names(imported)
+			for _, name := range tt.kept {
+				if !slices.Contains(found, name) {
+					t.Errorf("%s is not imported", name)
+				}
+			}
+			for _, name := range tt.dropped {
+				if slices.Contains(found, name) {
+					t.Errorf("%s is imported", name)
+				}
+			}
+			imported, err = classes.Resolve(imported)
+			if err != nil {
+				t.Fatalf("resolve error: %s", err)
+			}
+			err = ast.CheckSemantics(
+				imported,
+				make(map[ast.TypeDefKey]interface{}),
+				make(map[ast.ConstructorDefKey]interface{}),
+				make(map[ast.FunctionDefKey]interface{}),
+				make(map[ast.VariableDefKey]interface{}),
+			)
+			if err != nil {
+				t.Fatalf("semantic error: %s", err)
+			}
+			err = compiler.NewCompiler().Compile(imported)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+		})
+	}
+}
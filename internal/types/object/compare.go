@@ -0,0 +1,113 @@
+package object
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// Equal compares values structurally: instances are equal if they are built
+// by the same constructor from equal arguments. It agrees with Compare.
+func Equal(a, b Object) bool {
+	return Compare(a, b) == 0
+}
+
+// Compare orders all values. Values of different kinds are ordered Int,
+// Char, String, instances, tuples and then functions. Ints, chars and strings are
+// compared by value. Instances of the same type are ordered by the
+// declaration order of their constructors and then by their arguments from
+// left to right; instances of different types by the names of the types.
+func Compare(a, b Object) int {
+	if c := cmp.Compare(kind(a), kind(b)); c != 0 {
+		return c
+	}
+	switch a := a.(type) {
+	case *Integer, *BigInteger:
+		left, _ := IntegerValue(a)
+		right, _ := IntegerValue(b)
+		return left.Cmp(right)
+	case *Char:
+		return cmp.Compare(a.Value, b.(*Char).Value)
+	case *String:
+		return strings.Compare(a.Value, b.(*String).Value)
+	case *Instance:
+		b := b.(*Instance)
+		if c := compareConstructors(a.Constructor, b.Constructor); c != 0 {
+			return c
+		}
+		for i := 0; i < len(a.Args) && i < len(b.Args); i++ {
+			if c := Compare(a.Args[i], b.Args[i]); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(len(a.Args), len(b.Args))
+	case *Tuple:
+		b := b.(*Tuple)
+		for i := 0; i < len(a.Elements) && i < len(b.Elements); i++ {
+			if c := Compare(a.Elements[i], b.Elements[i]); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(len(a.Elements), len(b.Elements))
+	case *CompiledFunction:
+		return strings.Compare(a.Name, b.(*CompiledFunction).Name)
+	case *Constructor:
+		return compareConstructors(a, b.(*Constructor))
+	}
+	return 0
+}
+
+func compareConstructors(a, b *Constructor) int {
+	if c := strings.Compare(a.Supertype, b.Supertype); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Tag, b.Tag); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Name, b.Name); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Arity, b.Arity)
+}
+
+// kind ranks the kinds of values for Compare.
+func kind(value Object) int {
+	switch value.(type) {
+	case *Integer, *BigInteger:
+		return 0
+	case *Char:
+		return 1
+	case *String:
+		return 2
+	case *Instance:
+		return 3
+	case *Tuple:
+		return 4
+	case *CompiledFunction:
+		return 5
+	case *Constructor:
+		return 6
+	}
+	return 7
+}
+
+// AssertionError is the error of a failed assert or assertEq. Expected is
+// nil for assert, which only has the value it checked.
+type AssertionError struct {
+	Expected Object
+	Actual   Object
+}
+
+func (e *AssertionError) Error() string {
+	if e.Expected == nil {
+		return fmt.Sprintf("assertion failed: got %s", Render(e.Actual))
+	}
+	return fmt.Sprintf("assertion failed: expected %s, got %s", Render(e.Expected), Render(e.Actual))
+}
+
+// Holds reports whether assert accepts value, which it does for every Int
+// but zero.
+func Holds(value Object) bool {
+	integer, ok := IntegerValue(value)
+	return ok && integer.Sign() != 0
+}
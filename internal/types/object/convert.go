@@ -0,0 +1,87 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Data is the Go form of an Instance returned by ToGo.
+type Data struct {
+	Type        string
+	Constructor string
+	Args        []any
+}
+
+// FromGo converts a Go value to an object: integers become Int, strings
+// become String, runes become Char and slices of convertible values become
+// tuples. Objects are returned as they are.
+func FromGo(value any) (Object, error) {
+	switch value := value.(type) {
+	case Object:
+		return value, nil
+	case int:
+		return &Integer{Value: int64(value)}, nil
+	case int64:
+		return &Integer{Value: value}, nil
+	case *big.Int:
+		return NewInteger(value), nil
+	case string:
+		return &String{Value: value}, nil
+	case rune:
+		return &Char{Value: value}, nil
+	case []any:
+		tuple := &Tuple{Elements: make([]Object, len(value))}
+		for i, element := range value {
+			converted, err := FromGo(element)
+			if err != nil {
+				return nil, err
+			}
+			tuple.Elements[i] = converted
+		}
+		return tuple, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to an object", value)
+}
+
+// ToGo converts an object to a Go value: Int becomes int64, or *big.Int if
+// it does not fit, String becomes string, Char becomes rune, a Tuple becomes
+// []any and an Instance becomes a Data with converted arguments.
+func ToGo(value Object) (any, error) {
+	switch value := value.(type) {
+	case *Integer:
+		return value.Value, nil
+	case *BigInteger:
+		return new(big.Int).Set(value.Value), nil
+	case *String:
+		return value.Value, nil
+	case *Char:
+		return value.Value, nil
+	case *Instance:
+		data := Data{
+			Type:        value.Constructor.Supertype,
+			Constructor: value.Constructor.Name,
+			Args:        make([]any, len(value.Args)),
+		}
+		for i, arg := range value.Args {
+			converted, err := ToGo(arg)
+			if err != nil {
+				return nil, err
+			}
+			data.Args[i] = converted
+		}
+		return data, nil
+	case *Tuple:
+		elements := make([]any, len(value.Elements))
+		for i, element := range value.Elements {
+			converted, err := ToGo(element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = converted
+		}
+		return elements, nil
+	case nil:
+		return nil, fmt.Errorf("no value")
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Go value", value.Type())
+}
@@ -0,0 +1,43 @@
+package object
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// ReadLine implements readLine: it reads the next line of in without its
+// line ending. The last line does not need one.
+func ReadLine(in *bufio.Reader) (Object, error) {
+	line, err := in.ReadString('\n')
+	if errors.Is(err, io.EOF) && line != "" {
+		err = nil
+	}
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error when reading: end of input")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error when reading: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &String{Value: line}, nil
+}
+
+// ReadInt implements readInt: it reads the next line of in, which has to
+// hold a decimal integer, possibly surrounded by spaces.
+func ReadInt(in *bufio.Reader) (*big.Int, error) {
+	line, err := ReadLine(in)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(line.(*String).Value)
+	value, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return nil, fmt.Errorf("error when reading integer: %q is not a number", text)
+	}
+	return value, nil
+}
@@ -2,7 +2,7 @@ package object
 
 import (
 	"fmt"
-	"strings"
+	"math/big"
 
 	"github.com/emrzvv/fl-compiler/internal/compiler/code"
 )
@@ -11,9 +11,13 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	BIG_INTEGER_OBJ       = "BIG_INTEGER"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 	CONSTRUCTOR_OBJ       = "CONSTRUCTOR"
 	INSTANCE_OBJ          = "INSTANCE"
+	STRING_OBJ            = "STRING"
+	CHAR_OBJ              = "CHAR"
+	TUPLE_OBJ             = "TUPLE"
 )
 
 type Object interface {
@@ -21,6 +25,10 @@ type Object interface {
 	String() string
 }
 
+type Comparable interface {
+	EqualsTo(other Object) bool
+}
+
 type Integer struct {
 	Value int64
 }
@@ -41,8 +49,97 @@ func (i *Integer) EqualsTo(other Object) bool {
 	return i.Value == otherI.Value
 }
 
+// BigInteger holds Int values that do not fit into int64. Values that fit
+// are always represented by Integer, so two Int values are equal only if
+// they have the same representation.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType {
+	return BIG_INTEGER_OBJ
+}
+
+func (bi *BigInteger) String() string {
+	return bi.Value.String()
+}
+
+func (bi *BigInteger) EqualsTo(other Object) bool {
+	otherBI, ok := other.(*BigInteger)
+	if !ok {
+		return false
+	}
+	return bi.Value.Cmp(otherBI.Value) == 0
+}
+
+// NewInteger returns an Integer if value fits into int64 and a BigInteger
+// otherwise.
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: new(big.Int).Set(value)}
+}
+
+// IntegerValue returns the value of an Integer or a BigInteger.
+func IntegerValue(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInteger:
+		return obj.Value, true
+	}
+	return nil, false
+}
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType {
+	return STRING_OBJ
+}
+
+func (s *String) String() string {
+	return s.Value
+}
+
+func (s *String) EqualsTo(other Object) bool {
+	otherS, ok := other.(*String)
+	if !ok {
+		return false
+	}
+	return s.Value == otherS.Value
+}
+
+type Char struct {
+	Value rune
+}
+
+func (c *Char) Type() ObjectType {
+	return CHAR_OBJ
+}
+
+func (c *Char) String() string {
+	return string(c.Value)
+}
+
+func (c *Char) EqualsTo(other Object) bool {
+	otherC, ok := other.(*Char)
+	if !ok {
+		return false
+	}
+	return c.Value == otherC.Value
+}
+
+// CompiledFunction is a function body. Locals is the number of variables
+// its patterns bind; every call gets its own slots for them. Name and Arity
+// come from the signature and are used to call the function by name.
 type CompiledFunction struct {
 	Instructions code.Instructions
+	Locals       int
+	Name         string
+	Arity        int
 }
 
 func (cf *CompiledFunction) Type() ObjectType {
@@ -53,10 +150,35 @@ func (cf *CompiledFunction) String() string {
 	return fmt.Sprintf("CompiledFunction[\n%s\n]", cf.Instructions.String())
 }
 
+// Constructor describes one alternative of a type. Tag is the position of
+// the alternative in the type definition, so the constructors of a type
+// have distinct tags; a value is matched by its type and its tag.
 type Constructor struct {
 	Name      string
 	Arity     int64
 	Supertype string
+	Tag       int64
+	// List is set on both constructors of a list-shaped type, which makes
+	// its instances render as [a, b, c].
+	List bool
+	// Fields names the arguments of a record constructor. It is empty for
+	// other constructors.
+	Fields []string
+}
+
+// Is reports whether c and other are the same alternative of the same type.
+func (c *Constructor) Is(other *Constructor) bool {
+	return c.Supertype == other.Supertype && c.Tag == other.Tag
+}
+
+// Field returns the position of the argument called name.
+func (c *Constructor) Field(name string) (int, bool) {
+	for i, field := range c.Fields {
+		if field == name {
+			return i, true
+		}
+	}
+	return 0, false
 }
 
 func (c *Constructor) Type() ObjectType {
@@ -68,7 +190,8 @@ func (c *Constructor) String() string {
 name=%s
 arity=%d
 supertype=%s
-	]`, c.Name, c.Arity, c.Supertype)
+tag=%d
+	]`, c.Name, c.Arity, c.Supertype, c.Tag)
 }
 
 func (c *Constructor) EqualsTo(other Object) bool {
@@ -76,7 +199,8 @@ func (c *Constructor) EqualsTo(other Object) bool {
 	if !ok {
 		return false
 	}
-	return c.Name == otherC.Name && c.Arity == otherC.Arity && c.Supertype == otherC.Supertype
+	return c.Name == otherC.Name && c.Arity == otherC.Arity &&
+		c.Supertype == otherC.Supertype && c.Tag == otherC.Tag
 }
 
 type Instance struct {
@@ -86,13 +210,15 @@ type Instance struct {
 
 func (i *Instance) Type() ObjectType { return "INSTANCE" }
 func (i *Instance) String() string {
-	args := []string{}
-	for _, arg := range i.Args {
-		args = append(args, arg.String())
-	}
-	return fmt.Sprintf(
-		"Instance[\n  Constructor: %s\n  Args: [%s]\n]",
-		i.Constructor.Name,
-		strings.Join(args, ", "),
-	)
+	return Render(i)
+}
+
+// Tuple is a value of a built-in product type, (, 1 "one").
+type Tuple struct {
+	Elements []Object
+}
+
+func (t *Tuple) Type() ObjectType { return TUPLE_OBJ }
+func (t *Tuple) String() string {
+	return Render(t)
 }
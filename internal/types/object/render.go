@@ -0,0 +1,110 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxRenderDepth is how deep Render descends into nested instances
+	// before writing "..." instead.
+	MaxRenderDepth = 100
+	// MaxRenderLength is how many elements of a list Render writes before
+	// writing "..." instead of the rest.
+	MaxRenderLength = 1000
+)
+
+// Render writes a value the way it is written in source code, such as
+// [Pair "a" 'b'], with strings and chars quoted. Instances of list-shaped
+// types are written as [a, b, c] instead of nested constructors.
+func Render(value Object) string {
+	return RenderLimited(value, MaxRenderDepth, MaxRenderLength)
+}
+
+// RenderLimited is Render with other limits of depth and list length.
+func RenderLimited(value Object, depth int, length int) string {
+	var out strings.Builder
+	render(&out, value, depth, length)
+	return out.String()
+}
+
+func render(out *strings.Builder, value Object, depth int, length int) {
+	switch value := value.(type) {
+	case *String:
+		out.WriteString(strconv.Quote(value.Value))
+	case *Char:
+		out.WriteString(strconv.QuoteRune(value.Value))
+	case *Instance:
+		if depth <= 0 {
+			out.WriteString("...")
+			return
+		}
+		if elements, ok := listElements(value); ok {
+			renderList(out, elements, depth, length)
+			return
+		}
+		out.WriteString("[" + value.Constructor.Name)
+		for _, arg := range value.Args {
+			out.WriteString(" ")
+			render(out, arg, depth-1, length)
+		}
+		out.WriteString("]")
+	case *Tuple:
+		if depth <= 0 {
+			out.WriteString("...")
+			return
+		}
+		out.WriteString("(,")
+		for _, element := range value.Elements {
+			out.WriteString(" ")
+			render(out, element, depth-1, length)
+		}
+		out.WriteString(")")
+	case nil:
+		out.WriteString("<nil>")
+	default:
+		out.WriteString(value.String())
+	}
+}
+
+// renderList writes the elements of a list, with constructors without
+// arguments written by their name only, except for empty lists.
+func renderList(out *strings.Builder, elements []Object, depth int, length int) {
+	out.WriteString("[")
+	for i, element := range elements {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		if i == length {
+			out.WriteString("...")
+			break
+		}
+		if instance, ok := element.(*Instance); ok && len(instance.Args) == 0 && !instance.Constructor.List {
+			out.WriteString(instance.Constructor.Name)
+			continue
+		}
+		render(out, element, depth-1, length)
+	}
+	out.WriteString("]")
+}
+
+// listElements collects the elements of an instance of a list-shaped type.
+// It fails if the list does not end with the empty constructor.
+func listElements(list *Instance) ([]Object, bool) {
+	elements := []Object{}
+	for list.Constructor.List {
+		if len(list.Args) == 0 {
+			return elements, true
+		}
+		if len(list.Args) != 2 {
+			return nil, false
+		}
+		rest, ok := list.Args[1].(*Instance)
+		if !ok || rest.Constructor.Supertype != list.Constructor.Supertype {
+			return nil, false
+		}
+		elements = append(elements, list.Args[0])
+		list = rest
+	}
+	return nil, false
+}
@@ -13,6 +13,8 @@ const (
 	CONSTRUCTOR_PAT = "CONSTRUCTOR"
 	VARIABLE_PAT    = "VARIABLE"
 	CONST_PAT       = "CONST"
+	TUPLE_PAT       = "TUPLE"
+	WILDCARD_PAT    = "WILDCARD"
 )
 
 type Pattern interface {
@@ -42,9 +44,7 @@ func (cp *ConstructorPattern) String() string {
 func (cp *ConstructorPattern) Matches(obj object.Object, variables []object.Object) bool {
 	switch obj := obj.(type) {
 	case *object.Instance:
-		if cp.Constructor.Name == obj.Constructor.Name &&
-			cp.Constructor.Arity == obj.Constructor.Arity &&
-			cp.Constructor.Supertype == obj.Constructor.Supertype {
+		if cp.Constructor.Is(obj.Constructor) && len(cp.Args) == len(obj.Args) {
 
 			for i, _ := range cp.Args {
 				if !cp.Args[i].Matches(obj.Args[i], variables) {
@@ -82,7 +82,7 @@ func (vp *VariablePattern) Matches(obj object.Object, variables []object.Object)
 }
 
 type ConstPattern struct {
-	Const *object.Integer
+	Const object.Object
 	Index int
 }
 
@@ -91,10 +91,57 @@ func (cp *ConstPattern) Type() PatternType {
 }
 
 func (cp *ConstPattern) String() string {
-	return (*cp.Const).String()
+	return cp.Const.String()
 }
 
 func (cp *ConstPattern) Matches(obj object.Object, variables []object.Object) bool {
-	result, ok := obj.(*object.Integer)
-	return ok && result.Value == cp.Const.Value
+	return object.Equal(cp.Const, obj)
+}
+
+type TuplePattern struct {
+	Args []Pattern
+}
+
+func (tp *TuplePattern) Type() PatternType {
+	return TUPLE_PAT
+}
+
+func (tp *TuplePattern) String() string {
+	args := []string{}
+	for _, arg := range tp.Args {
+		args = append(args, arg.String())
+	}
+	return fmt.Sprintf("Tuple Pattern (%s)", strings.Join(args, ", "))
+}
+
+func (tp *TuplePattern) Matches(obj object.Object, variables []object.Object) bool {
+	tuple, ok := obj.(*object.Tuple)
+	if !ok || len(tuple.Elements) != len(tp.Args) {
+		return false
+	}
+	for i, arg := range tp.Args {
+		if !arg.Matches(tuple.Elements[i], variables) {
+			return false
+		}
+	}
+	return true
+}
+
+// WildcardPattern matches anything without binding a variable. It stands
+// for the fields a record pattern leaves out. The compiler still gives it a
+// local, Index, to pop the matched value into.
+type WildcardPattern struct {
+	Index int
+}
+
+func (wp *WildcardPattern) Type() PatternType {
+	return WILDCARD_PAT
+}
+
+func (wp *WildcardPattern) String() string {
+	return "_"
+}
+
+func (wp *WildcardPattern) Matches(obj object.Object, variables []object.Object) bool {
+	return true
 }
@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler/code"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+)
+
+// Call runs the function called name with args and returns its value. It
+// does not run the top-level calls of the program, and it can be used any
+// number of times on the same FVM; the limits apply to every call
+// separately.
+func (fvm *FVM) Call(name string, args ...object.Object) (object.Object, error) {
+	return fvm.CallContext(context.Background(), name, args...)
+}
+
+// CallContext is Call that stops when ctx is done, like RunContext.
+func (fvm *FVM) CallContext(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	index, err := fvm.symbols.Function(name)
+	if err != nil {
+		return nil, err
+	}
+	function := fvm.constants[index].(*object.CompiledFunction)
+	if len(args) != function.Arity {
+		return nil, fmt.Errorf("function %s takes %d arguments, got %d", name, function.Arity, len(args))
+	}
+	if len(args)+1 > StackSize {
+		return nil, fmt.Errorf("too many arguments for function %s: %d", name, len(args))
+	}
+	for i, arg := range args {
+		if arg == nil {
+			return nil, fmt.Errorf("argument %d of %s is nil", i, name)
+		}
+	}
+
+	call := code.Make(code.OpCall, len(args))
+	if code.NeedsWide(code.OpCall, len(args)) {
+		call = code.MakeWide(code.OpCall, len(args))
+	}
+	fvm.frames[0] = NewFrame(&object.CompiledFunction{Instructions: call}, 0, []object.Object{})
+	fvm.framesIndex = 1
+	fvm.sp = 0
+	fvm.steps = 0
+	fvm.objects = 0
+	for _, arg := range args {
+		err = fvm.push(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = fvm.push(function)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fvm.RunContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := fvm.StackTop()
+	if result == nil {
+		return nil, fmt.Errorf("function %s returned no value", name)
+	}
+	return result, nil
+}
+
+// Construct builds an instance of the constructor called name, which may be
+// qualified with its type as Type.Name, to pass it to Call.
+func (fvm *FVM) Construct(name string, args ...object.Object) (*object.Instance, error) {
+	index, err := fvm.symbols.Constructor(name, fvm.constants)
+	if err != nil {
+		return nil, err
+	}
+	constructor := fvm.constants[index].(*object.Constructor)
+	if int64(len(args)) != constructor.Arity {
+		return nil, fmt.Errorf("constructor %s takes %d arguments, got %d", name, constructor.Arity, len(args))
+	}
+	for i, arg := range args {
+		if arg == nil {
+			return nil, fmt.Errorf("argument %d of %s is nil", i, name)
+		}
+	}
+	return &object.Instance{Constructor: constructor, Args: args}, nil
+}
@@ -0,0 +1,166 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+)
+
+const callProgram = `type [List x]: Cons x [List x] | Nil .
+type [Letter]: A | B | C .
+type [Other]: A .
+
+fun (fab [List Letter]) -> [List Letter] :
+    (fab [Cons [Letter.A] xs]) -> [Cons [B] (fab xs)] |
+    (fab [Cons x xs])   -> [Cons x (fab xs)] |
+    (fab [Nil])         -> [Nil] .
+
+fun (sum [List Int]) -> Int :
+    (sum [Cons x xs]) -> (+ (sum xs) x) |
+    (sum [Nil])       -> 0 .
+
+fun (greet String Int) -> String :
+    (greet name n) -> (concat name " " (intToString n)) .
+
+(print "top level")
+`
+
+func callMachine(t *testing.T) (*FVM, *bytes.Buffer) {
+	t.Helper()
+	comp := compiler.NewCompiler()
+	err := comp.Compile(parse(callProgram))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var out bytes.Buffer
+	return NewFVM(comp.Bytecode(), WithOutput(&out)), &out
+}
+
+func list(t *testing.T, machine *FVM, items ...object.Object) object.Object {
+	t.Helper()
+	result, err := machine.Construct("Nil")
+	if err != nil {
+		t.Fatalf("construct error: %s", err)
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		result, err = machine.Construct("Cons", items[i], result)
+		if err != nil {
+			t.Fatalf("construct error: %s", err)
+		}
+	}
+	return result
+}
+
+func TestCall(t *testing.T) {
+	machine, out := callMachine(t)
+
+	ints := []object.Object{}
+	for _, n := range []int{1, 2, 3} {
+		value, err := object.FromGo(n)
+		if err != nil {
+			t.Fatalf("conversion error: %s", err)
+		}
+		ints = append(ints, value)
+	}
+	result, err := machine.Call("sum", list(t, machine, ints...))
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	if value, _ := object.ToGo(result); value != int64(6) {
+		t.Errorf("expected 6, got %v", value)
+	}
+
+	// the machine can be called again
+	a, err := machine.Construct("Letter.A")
+	if err != nil {
+		t.Fatalf("construct error: %s", err)
+	}
+	c, err := machine.Construct("C")
+	if err != nil {
+		t.Fatalf("construct error: %s", err)
+	}
+	result, err = machine.Call("fab", list(t, machine, a, c))
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	value, err := object.ToGo(result)
+	if err != nil {
+		t.Fatalf("conversion error: %s", err)
+	}
+	expected := object.Data{Type: "List", Constructor: "Cons", Args: []any{
+		object.Data{Type: "Letter", Constructor: "B", Args: []any{}},
+		object.Data{Type: "List", Constructor: "Cons", Args: []any{
+			object.Data{Type: "Letter", Constructor: "C", Args: []any{}},
+			object.Data{Type: "List", Constructor: "Nil", Args: []any{}},
+		}},
+	}}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("expected %v, got %v", expected, value)
+	}
+
+	result, err = machine.Call("greet", &object.String{Value: "fl"}, object.NewInteger(new(big.Int).Lsh(big.NewInt(1), 70)))
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	if value, _ := object.ToGo(result); value != "fl 1180591620717411303424" {
+		t.Errorf("wrong greeting %v", value)
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("top-level calls were run: %q", out.String())
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	machine, _ := callMachine(t)
+	tests := []struct {
+		call     func() error
+		contains string
+	}{
+		{func() error { _, err := machine.Call("missing"); return err }, "unknown function missing"},
+		{func() error { _, err := machine.Call("sum"); return err }, "takes 1 arguments, got 0"},
+		{func() error { _, err := machine.Call("sum", nil); return err }, "argument 0 of sum is nil"},
+		{func() error { _, err := machine.Call("sum", &object.Integer{Value: 1}); return err }, "error when trying to match"},
+		{func() error { _, err := machine.Construct("A"); return err }, "ambiguous constructor A"},
+		{func() error { _, err := machine.Construct("D"); return err }, "could not find constructor D"},
+		{func() error { _, err := machine.Construct("Cons"); return err }, "takes 2 arguments, got 0"},
+		{func() error { _, err := object.FromGo(1.5); return err }, "cannot convert float64"},
+	}
+
+	for _, tt := range tests {
+		err := tt.call()
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("expected error containing %q, got %v", tt.contains, err)
+		}
+	}
+}
+
+func TestCallReadBytecode(t *testing.T) {
+	comp := compiler.NewCompiler()
+	err := comp.Compile(parse(callProgram))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buffer bytes.Buffer
+	err = comp.Bytecode().Write(&buffer)
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	bytecode, err := compiler.ReadBytecode(&buffer)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	machine := NewFVM(bytecode)
+	result, err := machine.Call("sum", list(t, machine, &object.Integer{Value: 4}))
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	if result.String() != "4" {
+		t.Errorf("expected 4, got %s", result)
+	}
+}
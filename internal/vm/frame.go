@@ -12,6 +12,7 @@ type Frame struct {
 	ip         int
 	ArgsAmount int
 	args       []object.Object
+	locals     []object.Object
 	stack      []object.Object
 	sp         int
 }
@@ -22,6 +23,7 @@ func NewFrame(fn *object.CompiledFunction, argsAmount int, args []object.Object)
 		ip:         -1,
 		ArgsAmount: argsAmount,
 		args:       args,
+		locals:     make([]object.Object, fn.Locals),
 		stack:      make([]object.Object, StackSize),
 		sp:         0,
 	}
@@ -54,6 +56,25 @@ func (f *Frame) top() object.Object {
 
 func (f *Frame) clear() {
 	f.stack = make([]object.Object, StackSize)
+	f.sp = 0
+}
+
+func (f *Frame) bind(index int, o object.Object) error {
+	if index >= len(f.locals) {
+		return fmt.Errorf("no such variable %d", index)
+	}
+	f.locals[index] = o
+	return nil
+}
+
+func (f *Frame) variable(index int) (object.Object, error) {
+	if index >= len(f.locals) {
+		return nil, fmt.Errorf("no such variable %d", index)
+	}
+	if f.locals[index] == nil {
+		return nil, fmt.Errorf("variable %d is not bound", index)
+	}
+	return f.locals[index], nil
 }
 
 func (f *Frame) transferArgs() error {
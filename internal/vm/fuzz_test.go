@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
+)
+
+// FuzzRun decodes arbitrary bytes as bytecode and runs whatever passes
+// Verify with step and allocation limits. Nothing may panic: malformed bytecode
+// has to be rejected by ReadBytecode or Verify, and bytecode that misbehaves
+// at run time has to make Run return an error.
+func FuzzRun(f *testing.F) {
+	paths, err := filepath.Glob("../../samples/*")
+	if err != nil {
+		f.Fatalf("glob error: %s", err)
+	}
+	sources := []string{
+		`(concat "a" 'b' (intToString (strlen "héllo")))`,
+		`(charAt "abc" (stringToInt "1")) (strcmp "a" "b")`,
+		`(+ 9223372036854775807 1)`,
+		`fun (f Int) -> Int : (f 0) -> 1 | (f x) -> (+ x (f 0)) . (f 3)`,
+	}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatalf("read error: %s", err)
+		}
+		sources = append(sources, string(source))
+	}
+	for _, source := range sources {
+		program, err := ast.ParseString("sample", source)
+		if err != nil {
+			continue
+		}
+		c := compiler.NewCompiler()
+		if c.Compile(program) != nil {
+			continue
+		}
+		var buffer bytes.Buffer
+		err = c.Bytecode().Write(&buffer)
+		if err != nil {
+			f.Fatalf("write error: %s", err)
+		}
+		f.Add(buffer.Bytes())
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bytecode, err := compiler.ReadBytecode(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		err = Verify(bytecode)
+		if err != nil {
+			return
+		}
+		NewFVM(bytecode, WithOutput(io.Discard), WithStepLimit(10000), WithAllocationLimit(10000)).Run()
+	})
+}
@@ -1,10 +1,20 @@
 package vm
 
 import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/emrzvv/fl-compiler/internal/compiler"
 	"github.com/emrzvv/fl-compiler/internal/compiler/code"
+	"github.com/emrzvv/fl-compiler/internal/native"
 	"github.com/emrzvv/fl-compiler/internal/types/object"
 	"github.com/emrzvv/fl-compiler/internal/types/pattern"
 )
@@ -12,25 +22,99 @@ import (
 const MaxFrames = 1024
 const StackSize = 2048
 
+var errStackUnderflow = errors.New("stack underflow")
+
 type FVM struct {
 	constants []object.Object
+	symbols   *compiler.SymbolTable
 	patterns  []pattern.Pattern
-	variables []object.Object
 
 	frames      []*Frame
 	framesIndex int
 
 	stack []object.Object
 	sp    int
+
+	overflow OverflowMode
+	out      io.Writer
+	errOut   io.Writer
+	in       io.Reader
+	// input buffers in from the first read on
+	input *bufio.Reader
+
+	registry *native.Registry
+	natives  []string
+
+	steps    int
+	maxSteps int
+	// objects counts allocations against maxObjects
+	objects    int
+	maxObjects int
+}
+
+// OverflowMode selects what happens when an Int result does not fit into
+// 64 bits.
+type OverflowMode int
+
+const (
+	// OverflowPromote switches to an arbitrary-precision representation.
+	OverflowPromote OverflowMode = iota
+	// OverflowError stops the program with an "integer overflow" error.
+	// Integer literals that do not fit are rejected before the program
+	// starts.
+	OverflowError
+)
+
+type Option func(*FVM)
+
+func WithIntegerOverflow(mode OverflowMode) Option {
+	return func(fvm *FVM) {
+		fvm.overflow = mode
+	}
+}
+
+// WithNatives provides the native functions the bytecode calls. They are
+// looked up by name when they are called.
+func WithNatives(registry *native.Registry) Option {
+	return func(fvm *FVM) {
+		fvm.registry = registry
+	}
+}
+
+// WithOutput redirects print and printNoNewline, which write to os.Stdout
+// by default.
+func WithOutput(out io.Writer) Option {
+	return func(fvm *FVM) {
+		fvm.out = out
+	}
+}
+
+// WithErrorOutput redirects printErr, which writes to os.Stderr by default.
+func WithErrorOutput(errOut io.Writer) Option {
+	return func(fvm *FVM) {
+		fvm.errOut = errOut
+	}
+}
+
+// WithInput sets where readInt and readLine read from, os.Stdin by default.
+// The FVM buffers it, so it may read further than the last line it returns.
+func WithInput(in io.Reader) Option {
+	return func(fvm *FVM) {
+		fvm.in = in
+	}
 }
 
 func (fvm *FVM) currentFrame() *Frame {
 	return fvm.frames[fvm.framesIndex-1]
 }
 
-func (fvm *FVM) pushFrame(f *Frame) {
+func (fvm *FVM) pushFrame(f *Frame) error {
+	if fvm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
 	fvm.frames[fvm.framesIndex] = f
 	fvm.framesIndex++
+	return nil
 }
 
 func (fvm *FVM) popFrame() *Frame {
@@ -38,94 +122,143 @@ func (fvm *FVM) popFrame() *Frame {
 	return fvm.frames[fvm.framesIndex]
 }
 
-func NewFVM(bytecode *compiler.Bytecode) *FVM {
+func NewFVM(bytecode *compiler.Bytecode, options ...Option) *FVM {
 	main := &object.CompiledFunction{Instructions: bytecode.Instructions}
 	mainFrame := NewFrame(main, 0, []object.Object{})
 	frames := make([]*Frame, MaxFrames)
 	frames[0] = mainFrame
 
-	return &FVM{
+	fvm := &FVM{
 		constants:   bytecode.Constants,
-		variables:   make([]object.Object, bytecode.VarAmount+1),
+		symbols:     bytecode.Symbols(),
+		natives:     bytecode.Natives,
 		frames:      frames,
 		framesIndex: 1,
 		stack:       make([]object.Object, StackSize),
 		sp:          0,
+		out:         os.Stdout,
+		errOut:      os.Stderr,
+		in:          os.Stdin,
 	}
+	for _, option := range options {
+		option(fvm)
+	}
+	return fvm
 }
 
 func (fvm *FVM) Run() error {
+	return fvm.RunContext(context.Background())
+}
+
+// contextCheckInterval is the number of instructions between checks of the
+// context in RunContext.
+const contextCheckInterval = 1024
+
+// RunContext runs the program like Run, but stops it when ctx is done and
+// returns ctx.Err() wrapped in a *CancelError. Everything printed until then
+// has already been written. The FVM stays as it was at the point of
+// stopping, so it can be inspected, but it cannot be resumed.
+func (fvm *FVM) RunContext(ctx context.Context) error {
 	// fmt.Println(fvm.currentFrame().Instructions().String())
 	// fmt.Println("====================")
 
+	err := fvm.checkConstants()
+	if err != nil {
+		return err
+	}
+
+	done := ctx.Done()
 	var ip int
 	var instructions code.Instructions
 	var op code.OpCode
 
 	for fvm.currentFrame().ip < len(fvm.currentFrame().Instructions())-1 {
+		if fvm.maxSteps > 0 && fvm.steps >= fvm.maxSteps {
+			return fvm.limitError(StepLimit, fvm.maxSteps)
+		}
+		if done != nil && fvm.steps%contextCheckInterval == 0 {
+			select {
+			case <-done:
+				return &CancelError{Err: ctx.Err(), Steps: fvm.steps, Stack: fvm.callStack()}
+			default:
+			}
+		}
+		fvm.steps++
 		fvm.currentFrame().ip++
 		ip = fvm.currentFrame().ip
 		instructions = fvm.currentFrame().Instructions()
 		op = code.OpCode(instructions[ip])
+		width := 2
+		if op == code.OpWide {
+			fvm.currentFrame().ip++
+			ip++
+			op = code.OpCode(instructions[ip])
+			width = 4
+		}
 		// fmt.Printf("%d %d\n", ip, op)
 		switch op {
 		case code.OpConstant:
-			constIndex := code.ReadUint16(instructions[ip+1:])
-			fvm.currentFrame().ip += 2
+			constIndex := code.ReadOperand(instructions[ip+1:], width)
+			fvm.currentFrame().ip += width
 			// fmt.Printf("constIndex: %d %d", constIndex, ip)
 			err := fvm.push(fvm.constants[constIndex])
 			if err != nil {
 				return err
 			}
 		case code.OpVariable:
-			variableIndex := code.ReadUint16(instructions[ip+1:])
-			fvm.currentFrame().ip += 2
-			err := fvm.push(fvm.variables[variableIndex])
+			variableIndex := code.ReadOperand(instructions[ip+1:], width)
+			fvm.currentFrame().ip += width
+			variable, err := fvm.currentFrame().variable(variableIndex)
+			if err != nil {
+				return err
+			}
+			err = fvm.push(variable)
 			if err != nil {
 				return err
 			}
 		case code.OpAdd:
-			amount := code.ReadUint16(instructions[ip+1:])
-			fvm.currentFrame().ip += 2
-			if int(amount) > len(fvm.stack) {
-				return fmt.Errorf("error when adding stack values")
-			}
-			var result int64 = 0
-			for i := 0; i < int(amount); i++ {
-				current := fvm.pop()
-				currentValue := current.(*object.Integer).Value
-				result += currentValue
-			}
-			fvm.push(&object.Integer{Value: result})
+			amount := code.ReadOperand(instructions[ip+1:], width)
+			fvm.currentFrame().ip += width
+			if amount > fvm.sp {
+				return fmt.Errorf("error when adding stack values: %w", errStackUnderflow)
+			}
+			result, err := fvm.add(amount)
+			if err != nil {
+				return err
+			}
+			if _, ok := result.(*object.BigInteger); ok {
+				err = fvm.allocated()
+				if err != nil {
+					return err
+				}
+			}
+			err = fvm.push(result)
+			if err != nil {
+				return err
+			}
 		case code.OpConstruct:
-			index := code.ReadUint16(instructions[ip+1:])
-			arity := code.ReadUint16(instructions[ip+3:])
-			fvm.currentFrame().ip += 4
+			index := code.ReadOperand(instructions[ip+1:], width)
+			arity := code.ReadOperand(instructions[ip+1+width:], width)
+			fvm.currentFrame().ip += 2 * width
 			// fmt.Println("============\nSTACK BEFORE OPCONSTRUCT")
 			// for i := 0; i < fvm.sp; i++ {
 			// 	fmt.Printf("%+v\n", fvm.stack[i])
 			// }
-			// fmt.Printf("VARIABLES\n")
-			vars := []string{}
-			for _, v := range fvm.variables {
-				if v != nil {
-					vars = append(vars, v.String())
-				}
-			}
-			// fmt.Printf("\n%s\n=============\n", strings.Join(vars, "\n"))
 			constructor, ok := fvm.constants[index].(*object.Constructor)
 			if !ok { // TODO: validation?
 				return fmt.Errorf("error when exctracting constructor type from constant pull")
 			}
+			if int64(arity) != constructor.Arity {
+				return fmt.Errorf("error when constructing %s: takes %d arguments, got %d", constructor.Name, constructor.Arity, arity)
+			}
+			if arity > fvm.sp {
+				return fmt.Errorf("error when constructing %s: %w", constructor.Name, errStackUnderflow)
+			}
 			args := make([]object.Object, arity)
 
-			for i := int(arity) - 1; i >= 0; i-- {
+			for i := arity - 1; i >= 0; i-- {
 				args[i] = fvm.pop()
 			}
-			aa := []string{}
-			for _, a := range args {
-				aa = append(aa, a.String())
-			}
 			// fmt.Printf("ARGS FOR CONSTRUCTOR %d\n", index)
 			// fmt.Printf("\n%s", strings.Join(aa, "\n"))
 			// fmt.Println("============")
@@ -133,19 +266,91 @@ func (fvm *FVM) Run() error {
 				Constructor: constructor,
 				Args:        args,
 			}
-
-			fvm.push(instance)
+			err := fvm.allocated()
+			if err != nil {
+				return err
+			}
+			err = fvm.push(instance)
+			if err != nil {
+				return err
+			}
+		case code.OpTuple:
+			size := code.ReadOperand(instructions[ip+1:], width)
+			fvm.currentFrame().ip += width
+			if size > fvm.sp {
+				return fmt.Errorf("error when constructing a tuple: %w", errStackUnderflow)
+			}
+			elements := make([]object.Object, size)
+			for i := size - 1; i >= 0; i-- {
+				elements[i] = fvm.pop()
+			}
+			err := fvm.allocated()
+			if err != nil {
+				return err
+			}
+			err = fvm.push(&object.Tuple{Elements: elements})
+			if err != nil {
+				return err
+			}
+		case code.OpProject:
+			index := code.ReadOperand(instructions[ip+1:], width)
+			fvm.currentFrame().ip += width
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when projecting a tuple: %w", errStackUnderflow)
+			}
+			tuple, ok := fvm.pop().(*object.Tuple)
+			if !ok {
+				return fmt.Errorf("error when projecting a tuple: not a tuple")
+			}
+			if index >= len(tuple.Elements) {
+				return fmt.Errorf("error when projecting a tuple: no element %d in a tuple of %d", index, len(tuple.Elements))
+			}
+			err = fvm.push(tuple.Elements[index])
+			if err != nil {
+				return err
+			}
+		case code.OpField:
+			nameIndex := code.ReadOperand(instructions[ip+1:], width)
+			fvm.currentFrame().ip += width
+			name, ok := fvm.constants[nameIndex].(*object.String)
+			if !ok {
+				return fmt.Errorf("error when accessing a field: constant %d is not a string", nameIndex)
+			}
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when accessing field %s: %w", name.Value, errStackUnderflow)
+			}
+			instance, ok := fvm.pop().(*object.Instance)
+			if !ok {
+				return fmt.Errorf("error when accessing field %s: not a record", name.Value)
+			}
+			field, ok := instance.Constructor.Field(name.Value)
+			if !ok {
+				return fmt.Errorf("error when accessing field %s: %s has no such field", name.Value, instance.Constructor.Name)
+			}
+			if field >= len(instance.Args) {
+				return fmt.Errorf("error when accessing field %s: %s has %d arguments", name.Value, instance.Constructor.Name, len(instance.Args))
+			}
+			err = fvm.push(instance.Args[field])
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
-			argsAmount := int(code.ReadUint16(instructions[ip+1:]))
-			fvm.currentFrame().ip += 2
+			argsAmount := code.ReadOperand(instructions[ip+1:], width)
+			fvm.currentFrame().ip += width
 			// fmt.Println("STACK BEFORE OPCALL")
 			// for i := 0; i < fvm.sp; i++ {
 			// 	fmt.Printf("%+v\n", fvm.stack[i])
 			// }
+			if argsAmount+1 > fvm.sp {
+				return fmt.Errorf("error when trying to call function: %w", errStackUnderflow)
+			}
 			function, ok := fvm.stack[fvm.sp-1].(*object.CompiledFunction)
 			if !ok {
 				return fmt.Errorf("error when trying to call function")
 			}
+			if function.Arity != argsAmount {
+				return fmt.Errorf("error when trying to call function: %s expects %d arguments, got %d", function.Name, function.Arity, argsAmount)
+			}
 			fvm.pop() // pop function object
 			args := make([]object.Object, argsAmount)
 			// fmt.Println("FVM STACK BEGIN")
@@ -162,10 +367,15 @@ func (fvm *FVM) Run() error {
 			if err != nil {
 				return err
 			}
-			fvm.pushFrame(frame)
+			err = fvm.pushFrame(frame)
+			if err != nil {
+				return err
+			}
 		case code.OpReturnValue:
 			// value := fvm.pop()
-
+			if fvm.framesIndex == 1 {
+				return fmt.Errorf("error when returning: not in a function")
+			}
 			fvm.popFrame()
 
 			// err := fvm.push(value)
@@ -175,26 +385,40 @@ func (fvm *FVM) Run() error {
 		case code.OpMatchFailed:
 			return fmt.Errorf("error when trying to match")
 		case code.OpExpandArgs:
-			instance, ok := fvm.currentFrame().pop().(*object.Instance)
-			if !ok {
+			if fvm.currentFrame().sp == 0 {
+				return fmt.Errorf("error when trying to expand constructor: %w", errStackUnderflow)
+			}
+			var args []object.Object
+			switch value := fvm.currentFrame().pop().(type) {
+			case *object.Instance:
+				args = value.Args
+			case *object.Tuple:
+				args = value.Elements
+			default:
 				return fmt.Errorf("error when trying to expand constructor")
 			}
-			for i := len(instance.Args) - 1; i >= 0; i-- {
-				err := fvm.currentFrame().push(instance.Args[i])
+			for i := len(args) - 1; i >= 0; i-- {
+				err := fvm.currentFrame().push(args[i])
 				if err != nil {
 					return err
 				}
 			}
 		case code.OpMatchConstructor:
+			if fvm.currentFrame().sp == 0 {
+				return fmt.Errorf("error when trying to match constructor: %w", errStackUnderflow)
+			}
 			instance, ok := fvm.currentFrame().top().(*object.Instance)
 			if !ok {
 				return fmt.Errorf("error when trying to match constructor, got %+v", fvm.currentFrame().top())
 			}
-			patternIdx := code.ReadUint16(instructions[ip+1:])
-			constructorPattern := fvm.constants[patternIdx]
-			jumpIfFail := code.ReadUint16(instructions[ip+3:])
-			fvm.currentFrame().ip += 4
-			if instance.Constructor.EqualsTo(constructorPattern) {
+			patternIdx := code.ReadOperand(instructions[ip+1:], width)
+			constructorPattern, ok := fvm.constants[patternIdx].(*object.Constructor)
+			if !ok {
+				return fmt.Errorf("error when trying to match constructor: constant %d is not a constructor", patternIdx)
+			}
+			jumpIfFail := code.ReadOperand(instructions[ip+1+width:], width)
+			fvm.currentFrame().ip += 2 * width
+			if instance.Constructor.Is(constructorPattern) {
 				if instance.Constructor.Arity == 0 {
 					fvm.currentFrame().pop()
 				}
@@ -202,34 +426,386 @@ func (fvm *FVM) Run() error {
 			}
 			fvm.currentFrame().clear()
 			fvm.currentFrame().transferArgs()
-			fvm.currentFrame().ip = int(jumpIfFail) - 1
+			fvm.currentFrame().ip = jumpIfFail - 1
+		case code.OpMatchTuple:
+			if fvm.currentFrame().sp == 0 {
+				return fmt.Errorf("error when trying to match tuple: %w", errStackUnderflow)
+			}
+			size := code.ReadOperand(instructions[ip+1:], width)
+			jumpIfFail := code.ReadOperand(instructions[ip+1+width:], width)
+			fvm.currentFrame().ip += 2 * width
+			tuple, ok := fvm.currentFrame().top().(*object.Tuple)
+			if !ok {
+				return fmt.Errorf("error when trying to match tuple, got %+v", fvm.currentFrame().top())
+			}
+			if len(tuple.Elements) == size {
+				if size == 0 {
+					fvm.currentFrame().pop()
+				}
+				continue
+			}
+			fvm.currentFrame().clear()
+			fvm.currentFrame().transferArgs()
+			fvm.currentFrame().ip = jumpIfFail - 1
 		case code.OpMatchConstant:
-			constant, ok := fvm.currentFrame().pop().(*object.Integer)
+			if fvm.currentFrame().sp == 0 {
+				return fmt.Errorf("error when trying to match constant: %w", errStackUnderflow)
+			}
+			constant := fvm.currentFrame().pop()
+			constantIdx := code.ReadOperand(instructions[ip+1:], width)
+			constantPattern, ok := fvm.constants[constantIdx].(object.Comparable)
 			if !ok {
 				return fmt.Errorf("error when trying to match constant")
 			}
-			constantIdx := code.ReadUint16(instructions[ip+1:])
-			constantPattern := fvm.constants[constantIdx]
-			jumpIfFail := code.ReadUint16(instructions[ip+3:])
-			fvm.currentFrame().ip += 4
-			if constant.EqualsTo(constantPattern) {
+			jumpIfFail := code.ReadOperand(instructions[ip+1+width:], width)
+			fvm.currentFrame().ip += 2 * width
+			if object.Equal(constantPattern.(object.Object), constant) {
 				continue
 			}
 			fvm.currentFrame().clear()
 			fvm.currentFrame().transferArgs()
-			fvm.currentFrame().ip = int(jumpIfFail) - 1
+			fvm.currentFrame().ip = jumpIfFail - 1
 		case code.OpBindVariable:
-			idx := code.ReadUint16(instructions[ip+1:])
-			fvm.variables[idx] = fvm.currentFrame().pop()
-			fvm.currentFrame().ip += 2
+			idx := code.ReadOperand(instructions[ip+1:], width)
+			if fvm.currentFrame().sp == 0 {
+				return fmt.Errorf("error when binding variable: %w", errStackUnderflow)
+			}
+			err := fvm.currentFrame().bind(idx, fvm.currentFrame().pop())
+			if err != nil {
+				return err
+			}
+			fvm.currentFrame().ip += width
 		case code.OpPrint:
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when printing: %w", errStackUnderflow)
+			}
 			obj := fvm.pop()
-			fmt.Println(obj.String())
+			fmt.Fprintln(fvm.out, obj.String())
+		case code.OpEq, code.OpCompare:
+			if fvm.sp < 2 {
+				return fmt.Errorf("error when comparing: %w", errStackUnderflow)
+			}
+			right := fvm.pop()
+			left := fvm.pop()
+			result := object.Compare(left, right)
+			if op == code.OpEq {
+				result = 0
+				if object.Equal(left, right) {
+					result = 1
+				}
+			}
+			err = fvm.push(&object.Integer{Value: int64(result)})
+			if err != nil {
+				return err
+			}
+		case code.OpShow:
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when showing: %w", errStackUnderflow)
+			}
+			shown := &object.String{Value: object.Render(fvm.pop())}
+			err := fvm.allocated()
+			if err != nil {
+				return err
+			}
+			err = fvm.push(shown)
+			if err != nil {
+				return err
+			}
+		case code.OpPrintNoNewline:
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when printing: %w", errStackUnderflow)
+			}
+			fmt.Fprint(fvm.out, fvm.pop().String())
+		case code.OpPrintErr:
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when printing: %w", errStackUnderflow)
+			}
+			fmt.Fprintln(fvm.errOut, fvm.pop().String())
+		case code.OpReadLine:
+			line, err := object.ReadLine(fvm.reader())
+			if err != nil {
+				return err
+			}
+			err = fvm.allocated()
+			if err != nil {
+				return err
+			}
+			err = fvm.push(line)
+			if err != nil {
+				return err
+			}
+		case code.OpReadInt:
+			value, err := object.ReadInt(fvm.reader())
+			if err != nil {
+				return err
+			}
+			integer, err := fvm.integer(value)
+			if err != nil {
+				return err
+			}
+			if _, ok := integer.(*object.BigInteger); ok {
+				err = fvm.allocated()
+				if err != nil {
+					return err
+				}
+			}
+			err = fvm.push(integer)
+			if err != nil {
+				return err
+			}
+		case code.OpConcat:
+			amount := code.ReadOperand(instructions[ip+1:], width)
+			fvm.currentFrame().ip += width
+			if amount > fvm.sp {
+				return fmt.Errorf("error when concatenating: %w", errStackUnderflow)
+			}
+			parts := make([]string, amount)
+			for i := amount - 1; i >= 0; i-- {
+				switch part := fvm.pop().(type) {
+				case *object.String:
+					parts[i] = part.Value
+				case *object.Char:
+					parts[i] = string(part.Value)
+				default:
+					return fmt.Errorf("error when concatenating: %s is not a string or char", part.Type())
+				}
+			}
+			err := fvm.allocated()
+			if err != nil {
+				return err
+			}
+			err = fvm.push(&object.String{Value: strings.Join(parts, "")})
+			if err != nil {
+				return err
+			}
+		case code.OpStrLen:
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when taking length: %w", errStackUnderflow)
+			}
+			str, ok := fvm.pop().(*object.String)
+			if !ok {
+				return fmt.Errorf("error when taking length: not a string")
+			}
+			err = fvm.push(&object.Integer{Value: int64(utf8.RuneCountInString(str.Value))})
+			if err != nil {
+				return err
+			}
+		case code.OpCharAt:
+			if fvm.sp < 2 {
+				return fmt.Errorf("error when indexing string: %w", errStackUnderflow)
+			}
+			index, ok := object.IntegerValue(fvm.pop())
+			if !ok {
+				return fmt.Errorf("error when indexing string: index is not an integer")
+			}
+			str, ok := fvm.pop().(*object.String)
+			if !ok {
+				return fmt.Errorf("error when indexing string: not a string")
+			}
+			runes := []rune(str.Value)
+			if index.Sign() < 0 || index.Cmp(big.NewInt(int64(len(runes)))) >= 0 {
+				return fmt.Errorf("error when indexing string: index %s out of range [0, %d)", index, len(runes))
+			}
+			err = fvm.push(&object.Char{Value: runes[index.Int64()]})
+			if err != nil {
+				return err
+			}
+		case code.OpStrCmp:
+			if fvm.sp < 2 {
+				return fmt.Errorf("error when comparing: %w", errStackUnderflow)
+			}
+			right := fvm.pop()
+			left := fvm.pop()
+			result, err := compareText(left, right)
+			if err != nil {
+				return err
+			}
+			err = fvm.push(&object.Integer{Value: int64(result)})
+			if err != nil {
+				return err
+			}
+		case code.OpIntToString:
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when converting to string: %w", errStackUnderflow)
+			}
+			integer, ok := object.IntegerValue(fvm.pop())
+			if !ok {
+				return fmt.Errorf("error when converting to string: not an integer")
+			}
+			err := fvm.allocated()
+			if err != nil {
+				return err
+			}
+			err = fvm.push(&object.String{Value: integer.String()})
+			if err != nil {
+				return err
+			}
+		case code.OpStringToInt:
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when converting to integer: %w", errStackUnderflow)
+			}
+			str, ok := fvm.pop().(*object.String)
+			if !ok {
+				return fmt.Errorf("error when converting to integer: not a string")
+			}
+			value, ok := new(big.Int).SetString(str.Value, 10)
+			if !ok {
+				return fmt.Errorf("error when converting to integer: %q is not a number", str.Value)
+			}
+			integer, err := fvm.integer(value)
+			if err != nil {
+				return err
+			}
+			if _, ok := integer.(*object.BigInteger); ok {
+				err = fvm.allocated()
+				if err != nil {
+					return err
+				}
+			}
+			err = fvm.push(integer)
+			if err != nil {
+				return err
+			}
+		case code.OpCallNative:
+			index := code.ReadOperand(instructions[ip+1:], width)
+			argsAmount := code.ReadOperand(instructions[ip+1+width:], width)
+			fvm.currentFrame().ip += 2 * width
+			if index >= len(fvm.natives) {
+				return fmt.Errorf("error when calling native function: no native function %d", index)
+			}
+			function, ok := fvm.registry.Lookup(fvm.natives[index])
+			if !ok {
+				return fmt.Errorf("error when calling native function: unknown function %s", fvm.natives[index])
+			}
+			if argsAmount > fvm.sp {
+				return fmt.Errorf("error when calling %s: %w", fvm.natives[index], errStackUnderflow)
+			}
+			args := make([]object.Object, argsAmount)
+			for i := argsAmount - 1; i >= 0; i-- {
+				args[i] = fvm.pop()
+			}
+			result, err := function.Call(args, fvm.symbols.Types)
+			if err != nil {
+				return err
+			}
+			err = fvm.allocated()
+			if err != nil {
+				return err
+			}
+			err = fvm.push(result)
+			if err != nil {
+				return err
+			}
+		case code.OpAssert:
+			if fvm.sp == 0 {
+				return fmt.Errorf("error when asserting: %w", errStackUnderflow)
+			}
+			value := fvm.pop()
+			if !object.Holds(value) {
+				return &object.AssertionError{Actual: value}
+			}
+			err = fvm.push(&object.Integer{Value: 1})
+			if err != nil {
+				return err
+			}
+		case code.OpAssertEq:
+			if fvm.sp < 2 {
+				return fmt.Errorf("error when asserting: %w", errStackUnderflow)
+			}
+			actual := fvm.pop()
+			expected := fvm.pop()
+			if !object.Equal(expected, actual) {
+				return &object.AssertionError{Expected: expected, Actual: actual}
+			}
+			err = fvm.push(&object.Integer{Value: 1})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// add pops amount integers and sums them. The sum is kept in an int64 until
+// it overflows and only then moves to big.Int.
+func (fvm *FVM) add(amount int) (object.Object, error) {
+	var sum int64
+	var bigSum *big.Int
+	for i := 0; i < amount; i++ {
+		switch current := fvm.pop().(type) {
+		case *object.Integer:
+			if bigSum != nil {
+				bigSum.Add(bigSum, big.NewInt(current.Value))
+				continue
+			}
+			next := sum + current.Value
+			if (next > sum) == (current.Value > 0) {
+				sum = next
+				continue
+			}
+			bigSum = big.NewInt(sum)
+			bigSum.Add(bigSum, big.NewInt(current.Value))
+		case *object.BigInteger:
+			if bigSum == nil {
+				bigSum = big.NewInt(sum)
+			}
+			bigSum.Add(bigSum, current.Value)
+		default:
+			return nil, fmt.Errorf("error when adding stack values: not an integer")
+		}
+	}
+	if bigSum == nil {
+		return &object.Integer{Value: sum}, nil
+	}
+	return fvm.integer(bigSum)
+}
+
+// checkConstants rejects the integer constants that do not fit into 64 bits
+// when overflow is an error, so a program with such a literal fails before
+// it runs rather than when it reaches the literal.
+func (fvm *FVM) checkConstants() error {
+	if fvm.overflow != OverflowError {
+		return nil
+	}
+	for _, constant := range fvm.constants {
+		if n, ok := constant.(*object.BigInteger); ok && n.Value != nil {
+			return fmt.Errorf("integer overflow: constant %s does not fit into 64 bits", n.Value)
 		}
 	}
 	return nil
 }
 
+// integer wraps value into an Int object according to the overflow mode.
+func (fvm *FVM) integer(value *big.Int) (object.Object, error) {
+	if !value.IsInt64() && fvm.overflow == OverflowError {
+		return nil, fmt.Errorf("integer overflow: %s does not fit into 64 bits", value)
+	}
+	return object.NewInteger(value), nil
+}
+
+func compareText(left, right object.Object) (int, error) {
+	switch left := left.(type) {
+	case *object.String:
+		right, ok := right.(*object.String)
+		if ok {
+			return strings.Compare(left.Value, right.Value), nil
+		}
+	case *object.Char:
+		right, ok := right.(*object.Char)
+		if ok {
+			return cmp.Compare(left.Value, right.Value), nil
+		}
+	}
+	return 0, fmt.Errorf("error when comparing: cannot compare %s with %s", left.Type(), right.Type())
+}
+
+func (fvm *FVM) reader() *bufio.Reader {
+	if fvm.input == nil {
+		fvm.input = bufio.NewReader(fvm.in)
+	}
+	return fvm.input
+}
+
 func (fvm *FVM) StackTop() object.Object {
 	if fvm.sp == 0 {
 		return nil
@@ -1,12 +1,13 @@
 package vm
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"math/big"
 	"strings"
 	"testing"
 
-	"github.com/alecthomas/participle/v2"
-	"github.com/alecthomas/participle/v2/lexer"
 	"github.com/emrzvv/fl-compiler/internal/compiler"
 	"github.com/emrzvv/fl-compiler/internal/compiler/ast"
 	"github.com/emrzvv/fl-compiler/internal/types/object"
@@ -37,7 +38,7 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		err = vm.Run()
 		t.Logf("VARIABLES")
 		vars := []string{}
-		for _, v := range vm.variables {
+		for _, v := range vm.currentFrame().locals {
 			if v != nil {
 				vars = append(vars, v.String())
 			}
@@ -74,28 +75,26 @@ func testExpectedObject(
 		if err != nil {
 			t.Errorf("testInstanceObject failed: %s", err)
 		}
+	case *big.Int:
+		err := testBigIntegerObject(expected, actual)
+		if err != nil {
+			t.Errorf("testBigIntegerObject failed: %s", err)
+		}
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Errorf("testStringObject failed: %s", err)
+		}
+	case rune:
+		err := testCharObject(expected, actual)
+		if err != nil {
+			t.Errorf("testCharObject failed: %s", err)
+		}
 	}
 }
 
 func parse(input string) *ast.Program {
-
-	var myLexer = lexer.MustSimple([]lexer.SimpleRule{
-		{Name: "Keyword", Pattern: `\b(type|fun)\b`},
-		{Name: "Operator", Pattern: `->|\||:`},
-		{Name: "Ident", Pattern: `[a-zA-Z\+][a-zA-Z0-9_]*`},
-		// {Name: "TypeName", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "TypeGeneral", Pattern: `[a-zA-Z][a-zA-Z0-9_]*`},
-		// {Name: "FunName", Pattern: `[a-zA-Z\+\-\*\/][a-zA-Z0-9_]*`},
-		// {Name: "VarName", Pattern: `[a-zA-Z][a-zA-Z0-9_]`},
-		{Name: "Int", Pattern: `[0-9]+`}, // TODO: remove leading zeroes
-		{Name: "Punct", Pattern: `[\[\]\(\)\.]`},
-		{Name: "whitespace", Pattern: `[ \t\n\r]+`},
-	}) // TODO: to config
-
-	parser := participle.MustBuild[ast.Program](
-		participle.Lexer(myLexer),
-	)
-	program, _ := parser.ParseString("tests", input)
+	program, _ := ast.ParseString("tests", input)
 	return program
 }
 
@@ -112,6 +111,48 @@ func testIntegerObject(t *testing.T, expected int64, actual object.Object) error
 	return nil
 }
 
+func testBigIntegerObject(expected *big.Int, actual object.Object) error {
+	result, ok := object.IntegerValue(actual)
+	if !ok {
+		return fmt.Errorf("object is not integer. got %T (%+v)", actual, actual)
+	}
+
+	if result.Cmp(expected) != 0 {
+		return fmt.Errorf("object has wrong value. expected %s, got %s", expected, result)
+	}
+	if result.IsInt64() != (actual.Type() == object.INTEGER_OBJ) {
+		return fmt.Errorf("object has wrong representation %s for %s", actual.Type(), result)
+	}
+
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not string. got %T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. expected %q, got %q", expected, result.Value)
+	}
+
+	return nil
+}
+
+func testCharObject(expected rune, actual object.Object) error {
+	result, ok := actual.(*object.Char)
+	if !ok {
+		return fmt.Errorf("object is not char. got %T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. expected %q, got %q", expected, result.Value)
+	}
+
+	return nil
+}
+
 func testInstanceObject(
 	t *testing.T,
 	expected object.Instance,
@@ -161,6 +202,303 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func bigInt(s string) *big.Int {
+	value, _ := new(big.Int).SetString(s, 10)
+	return value
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []vmTestCase{
+		{"(+ 9223372036854775807 1)", bigInt("9223372036854775808")},
+		{`(+ (stringToInt "-9223372036854775808") (stringToInt "-1"))`, bigInt("-9223372036854775809")},
+		{`(+ (stringToInt "-1") 9223372036854775807 1)`, bigInt("9223372036854775807")},
+		{"(+ 123456789012345678901234567890)", bigInt("123456789012345678901234567890")},
+		{`(+ 123456789012345678901234567890 (stringToInt "-123456789012345678901234567890"))`, 0},
+		{`(intToString (+ 9223372036854775807 9223372036854775807))`, "18446744073709551614"},
+		{`(+ (stringToInt "100000000000000000000") 1)`, bigInt("100000000000000000001")},
+		{
+			`fun (isHuge Int) -> Int :
+				(isHuge 100000000000000000000) -> 1 |
+				(isHuge x) -> 0 .
+
+			(isHuge (+ 99999999999999999999 1))`,
+			1,
+		},
+		{
+			`fun (isHuge Int) -> Int :
+				(isHuge 100000000000000000000) -> 1 |
+				(isHuge x) -> 0 .
+
+			(isHuge 100)`,
+			0,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIntegerOverflowError(t *testing.T) {
+	tests := []struct {
+		input    string
+		overflow bool
+	}{
+		{"(+ 9223372036854775807 1)", true},
+		{`(+ (stringToInt "-9223372036854775808") (stringToInt "-1"))`, true},
+		{`(stringToInt "9223372036854775808")`, true},
+		{`(+ (stringToInt "-1") 9223372036854775807 1)`, false},
+		{"(+ 9223372036854775806 1)", false},
+		{"(print 9223372036854775808)", true},
+		// literals are rejected before the program runs
+		{"(print 1) (print 9223372036854775808)", true},
+		{`fun (big Int) -> Int : (big n) -> 99999999999999999999 .
+		(print 1)`, true},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = NewFVM(comp.Bytecode(), WithIntegerOverflow(OverflowError)).Run()
+		if tt.overflow && (err == nil || !strings.Contains(err.Error(), "integer overflow")) {
+			t.Errorf("expected overflow error for %s, got %v", tt.input, err)
+		}
+		if !tt.overflow && err != nil {
+			t.Errorf("unexpected error for %s: %s", tt.input, err)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`(concat "hello")`, "hello"},
+		{`(concat "total: " (intToString 42))`, "total: 42"},
+		{`(concat "a" 'b' "-- not a comment")`, "ab-- not a comment"},
+		{`(strlen "héllo")`, 5},
+		{`(charAt "héllo" 1)`, 'é'},
+		{`(strcmp "abc" "abd")`, -1},
+		{`(strcmp 'b' 'a')`, 1},
+		{`(+ (stringToInt "40") 2)`, 42},
+		{
+			`fun (greet String) -> String :
+				(greet "world") -> "hello, world" |
+				(greet name) -> (concat "hi, " name) .
+
+			(greet "world")`,
+			"hello, world",
+		},
+		{
+			`fun (greet String) -> String :
+				(greet "world") -> "hello, world" |
+				(greet name) -> (concat "hi, " name) .
+
+			(greet "bob")`,
+			"hi, bob",
+		},
+		{
+			`fun (vowel Char) -> Int :
+				(vowel 'a') -> 1 |
+				(vowel c) -> 0 .
+
+			(vowel (charAt "bar" 1))`,
+			1,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestInputOutput(t *testing.T) {
+	comp := compiler.NewCompiler()
+	err := comp.Compile(parse(`(printNoNewline "a")
+	(print (concat (readLine) "!"))
+	(printErr (+ (readInt) 1))
+	(readLine)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var out, errOut bytes.Buffer
+	machine := NewFVM(comp.Bytecode(),
+		WithOutput(&out),
+		WithErrorOutput(&errOut),
+		WithInput(strings.NewReader("b\r\n 41 \nlast")),
+	)
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if out.String() != "ab!\n" || errOut.String() != "42\n" {
+		t.Errorf("wrong output %q and %q", out.String(), errOut.String())
+	}
+	if top := machine.StackTop(); top.String() != "last" {
+		t.Errorf("expected the last line, got %s", top)
+	}
+
+	for input, expected := range map[string]string{
+		"":     "end of input",
+		"4x\n": `"4x" is not a number`,
+	} {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(`(readInt)`))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = NewFVM(comp.Bytecode(), WithInput(strings.NewReader(input))).Run()
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestShow(t *testing.T) {
+	types := `type [List x]: Cons x [List x] | Nil .
+	type [Tree]: Node [Tree] [Tree] | Leaf .
+	type [Letter]: A | B .
+	`
+	tests := []vmTestCase{
+		{types + `(show [Cons [A] [Cons [B] [Nil]]])`, "[A, B]"},
+		{types + `(show [Cons [Nil] [Cons [Cons 'x' [Nil]] [Nil]]])`, "[[], ['x']]"},
+		{types + `(show [Node [Leaf] [Node [Leaf] [Leaf]]])`, "[Node [Leaf] [Node [Leaf] [Leaf]]]"},
+		{`(show "a\"b")`, `"a\"b"`},
+		{`(show 12)`, "12"},
+	}
+	runVmTests(t, tests)
+
+	comp := compiler.NewCompiler()
+	err := comp.Compile(parse(types + `(print [Nil])`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := NewFVM(comp.Bytecode())
+	list, _ := machine.Construct("Nil")
+	tree, _ := machine.Construct("Leaf")
+	for i := 0; i < 5; i++ {
+		list, _ = machine.Construct("Cons", &object.Integer{Value: int64(i)}, list)
+		tree, _ = machine.Construct("Node", tree, tree)
+	}
+	if actual := object.RenderLimited(list, 10, 3); actual != "[4, 3, 2, ...]" {
+		t.Errorf("wrong limited list %s", actual)
+	}
+	if actual := object.RenderLimited(tree, 2, 10); actual != "[Node [Node ... ...] [Node ... ...]]" {
+		t.Errorf("wrong limited tree %s", actual)
+	}
+}
+
+func TestEqAndCompare(t *testing.T) {
+	types := `type [List x]: Cons x [List x] | Nil .
+	type [Letter]: B | A .
+	`
+	tests := []vmTestCase{
+		{`(eq 2 2)`, 1},
+		{`(eq "a" "b")`, 0},
+		{`(compare 1 2)`, -1},
+		{`(compare 'b' 'a')`, 1},
+		{`(compare "ab" "ab")`, 0},
+		{`(compare 1 'a')`, -1},
+		{`(compare 100000000000000000000 1)`, 1},
+		{types + `(eq [Cons [A] [Nil]] [Cons [A] [Nil]])`, 1},
+		{types + `(eq [Cons [A] [Nil]] [Cons [B] [Nil]])`, 0},
+		{types + `(compare [B] [A])`, -1},
+		{types + `(compare [Nil] [Cons 1 [Nil]])`, 1},
+		{types + `(compare [Cons 1 [Cons 2 [Nil]]] [Cons 1 [Cons 3 [Nil]]])`, -1},
+	}
+	runVmTests(t, tests)
+}
+
+func TestFunctionValues(t *testing.T) {
+	functions := `fun (twice [Fun Int Int] Int) -> Int : (twice f x) -> (f (f x)) .
+	fun (inc Int) -> Int : (inc x) -> (+ x 1) .
+	fun (pick Int) -> [Fun Int Int] : (pick 0) -> inc | (pick n) -> double .
+	fun (double Int) -> Int : (double x) -> (+ x x) .
+	`
+	tests := []vmTestCase{
+		{functions + `(twice inc 1)`, 3},
+		{functions + `(twice (pick 1) 3)`, 12},
+		{functions + `(eq inc inc)`, 1},
+	}
+	runVmTests(t, tests)
+
+	comp := compiler.NewCompiler()
+	err := comp.Compile(parse(functions + `(twice twice 1)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = NewFVM(comp.Bytecode()).Run()
+	if err == nil || !strings.Contains(err.Error(), "twice expects 2 arguments, got 1") {
+		t.Errorf("expected an arity error, got %v", err)
+	}
+}
+
+func TestTuplesAndRecords(t *testing.T) {
+	definitions := `type [Point]: Point {x: Int, y: Int} .
+	type [Shape]: Circle {radius: Int} | Square {side: Int} .
+	fun (swap (, x y)) -> (, y x) : (swap (, a b)) -> (, b a) .
+	fun (norm [Point]) -> Int : (norm [Point: x y]) -> (+ x y) .
+	fun (getY [Point]) -> Int : (getY [Point: y]) -> y .
+	fun (size [Shape]) -> Int : (size [Circle: radius]) -> radius | (size [Square: side]) -> (+ side side) .
+	fun (first (, Int Int)) -> Int : (first (, 0 b)) -> b | (first (, a b)) -> a .
+	fun (empty (,)) -> Int : (empty (,)) -> 7 .
+	fun (id [x]) -> [x] : (id x) -> x .
+	`
+	tests := []vmTestCase{
+		{definitions + `(id (.0 (, 1 "one")))`, 1},
+		{definitions + `(id (.1 (, 1 "one")))`, "one"},
+		{definitions + `(id (.0 (swap (, 1 "one"))))`, "one"},
+		{definitions + `(id (.y [Point 3 4]))`, 4},
+		{definitions + `(norm [Point 3 4])`, 7},
+		{definitions + `(getY [Point 3 4])`, 4},
+		{definitions + `(size [Square 5])`, 10},
+		{definitions + `(size [Circle 5])`, 5},
+		{definitions + `(first (, 0 9))`, 9},
+		{definitions + `(first (, 2 9))`, 2},
+		{definitions + `(empty (,))`, 7},
+		{definitions + `(id (.1 (.0 (, (, 1 2) 3))))`, 2},
+	}
+	runVmTests(t, tests)
+
+	errors := []struct {
+		input    string
+		contains string
+	}{
+		{definitions + `(id (.2 (, 1 2)))`, "no element 2 in a tuple of 2"},
+		{definitions + `(id (.0 1))`, "not a tuple"},
+		{definitions + `(id (.side [Circle 1]))`, "Circle has no such field"},
+	}
+	for _, tt := range errors {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = NewFVM(comp.Bytecode()).Run()
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("expected an error containing %q for %s, got %v", tt.contains, tt.input, err)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []string{
+		`(charAt "abc" 3)`,
+		`(stringToInt "4x")`,
+		`(strcmp "a" 'a')`,
+		`(+ 1 "2")`,
+	}
+
+	for _, input := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = NewFVM(comp.Bytecode()).Run()
+		if err == nil {
+			t.Errorf("expected runtime error for %s", input)
+		}
+	}
+}
+
 func TestExprConstructor(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -474,3 +812,145 @@ func TestFunCalls(t *testing.T) {
 	}
 	runVmTests(t, tests)
 }
+
+// sumOf returns a call adding up 1..n in nested groups, so that the stack
+// never holds more than a few thousand values.
+func sumOf(n int) string {
+	var out strings.Builder
+	out.WriteString("(+")
+	for group := 1; group <= n; group += 1000 {
+		out.WriteString(" (+")
+		for i := group; i < group+1000 && i <= n; i++ {
+			fmt.Fprintf(&out, " %d", i)
+		}
+		out.WriteString(")")
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+func TestWideOperands(t *testing.T) {
+	long := fmt.Sprintf(`fun (f Int) -> Int :
+		(f 0) -> %s |
+		(f x) -> 7 .
+	`, sumOf(30000))
+	longTuple := fmt.Sprintf(`fun (g (, Int Int)) -> Int :
+		(g (, a b c)) -> %s |
+		(g t) -> 7 .
+	`, sumOf(30000))
+	tests := []vmTestCase{
+		{sumOf(70000), 70000 * 70001 / 2},
+		{long + "(f 0)", 30000 * 30001 / 2},
+		{long + "(f 1)", 7},
+		{longTuple + "(g (, 1 2))", 7},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		listing := comp.Bytecode().Instructions.String()
+		for _, c := range comp.Bytecode().Constants {
+			if fn, ok := c.(*object.CompiledFunction); ok {
+				listing += fn.Instructions.String()
+			}
+		}
+		if !strings.Contains(listing, "OpWide") {
+			t.Errorf("expected wide instructions in the program")
+		}
+		vm := NewFVM(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.StackTop())
+	}
+}
+
+func TestQualifiedConstructors(t *testing.T) {
+	types := `type [A]: Leaf .
+	type [B]: Node | Leaf .
+	fun (f [B]) -> Int :
+		(f [B.Leaf]) -> 1 |
+		(f [Node]) -> 2 .
+	`
+	tests := []vmTestCase{
+		{types + "(f [B.Leaf])", 1},
+		{types + "(f [Node])", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursion(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`type [L]: N | C Int [L] .
+			fun (s [L]) -> Int :
+				(s [C x xs]) -> (+ (s xs) x) |
+				(s [N]) -> 0 .
+			(s [C 1 [C 2 [N]]])`,
+			3,
+		},
+		{
+			`(f 3)
+			fun (f Int) -> Int : (f x) -> (g x) .
+			fun (g Int) -> Int : (g x) -> (+ x 1) .`,
+			4,
+		},
+		{
+			`type [N]: Z | S [N] .
+			fun (even [N]) -> Int : (even [Z]) -> 1 | (even [S n]) -> (odd n) .
+			fun (odd [N]) -> Int : (odd [Z]) -> 0 | (odd [S n]) -> (even n) .
+			(even [S [S [S [Z]]]])`,
+			0,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssertions(t *testing.T) {
+	types := "type [L]: N | C Int [L] .\n"
+	tests := []vmTestCase{
+		{`(assert 2)`, 1},
+		{`(assertEq "ab" (concat "a" "b"))`, 1},
+		{types + `(assertEq [C 1 [C 2 [N]]] [C 1 [C 2 [N]]])`, 1},
+	}
+	runVmTests(t, tests)
+
+	failing := []string{
+		`(assert 0)`,
+		`(assert "1")`,
+		`(assertEq 1 2)`,
+		`(assertEq 1 "1")`,
+		types + `(assertEq [C 1 [C 2 [N]]] [C 1 [C 3 [N]]])`,
+		types + `(assertEq [C 1 [N]] [N])`,
+	}
+	for _, input := range failing {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = NewFVM(comp.Bytecode()).Run()
+		var assertion *object.AssertionError
+		if !errors.As(err, &assertion) {
+			t.Errorf("expected an assertion error for %s, got %v", input, err)
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	comp := compiler.NewCompiler()
+	err := comp.Compile(parse(`fun (f Int) -> Int : (f x) -> (+ 1 (f x)) . (f 1)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = NewFVM(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "stack overflow" {
+		t.Errorf("expected stack overflow, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limit names a resource an FVM can be restricted in.
+type Limit int
+
+const (
+	// StepLimit is the number of executed instructions.
+	StepLimit Limit = iota
+	// AllocationLimit is the number of objects allocated at run time:
+	// instances, strings and integers that do not fit into 64 bits. Every
+	// allocation counts, including objects that are no longer reachable, so
+	// it bounds the work of a program rather than the memory it holds.
+	AllocationLimit
+)
+
+func (l Limit) String() string {
+	if l == AllocationLimit {
+		return "allocation limit"
+	}
+	return "step limit"
+}
+
+// LimitError is returned by Run when the program uses up a limit set with
+// WithStepLimit or WithAllocationLimit.
+type LimitError struct {
+	Limit Limit
+	Max   int
+	// Steps is the number of instructions executed before stopping.
+	Steps int
+	// Stack lists the active calls, innermost first, as "name at ip".
+	Stack []string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s of %d exceeded after %d instructions\ncall stack:\n  %s",
+		e.Limit, e.Max, e.Steps, strings.Join(e.Stack, "\n  "))
+}
+
+// CancelError is returned by RunContext when its context is done before the
+// program finishes. It unwraps to the error of the context.
+type CancelError struct {
+	Err   error
+	Steps int
+	Stack []string
+}
+
+func (e *CancelError) Error() string {
+	return fmt.Sprintf("%s after %d instructions\ncall stack:\n  %s",
+		e.Err, e.Steps, strings.Join(e.Stack, "\n  "))
+}
+
+func (e *CancelError) Unwrap() error {
+	return e.Err
+}
+
+// WithStepLimit stops Run with a *LimitError after max instructions. Zero
+// means no limit.
+func WithStepLimit(max int) Option {
+	return func(fvm *FVM) {
+		fvm.maxSteps = max
+	}
+}
+
+// WithAllocationLimit stops Run with a *LimitError once the program has
+// allocated more than max objects in total, whether or not they are still
+// reachable. Constants of the bytecode do not count. Zero means no limit.
+func WithAllocationLimit(max int) Option {
+	return func(fvm *FVM) {
+		fvm.maxObjects = max
+	}
+}
+
+// Steps returns the number of instructions executed so far.
+func (fvm *FVM) Steps() int {
+	return fvm.steps
+}
+
+// allocated counts an object created at run time against the allocation limit.
+func (fvm *FVM) allocated() error {
+	fvm.objects++
+	if fvm.maxObjects > 0 && fvm.objects > fvm.maxObjects {
+		return fvm.limitError(AllocationLimit, fvm.maxObjects)
+	}
+	return nil
+}
+
+func (fvm *FVM) limitError(limit Limit, max int) *LimitError {
+	return &LimitError{
+		Limit: limit,
+		Max:   max,
+		Steps: fvm.steps,
+		Stack: fvm.callStack(),
+	}
+}
+
+// callStack describes the frames from the innermost one to the main one.
+func (fvm *FVM) callStack() []string {
+	stack := make([]string, 0, fvm.framesIndex)
+	for i := fvm.framesIndex - 1; i >= 0; i-- {
+		frame := fvm.frames[i]
+		name := frame.fn.Name
+		switch {
+		case i == 0:
+			name = "main"
+		case name == "":
+			name = "<function>"
+		}
+		stack = append(stack, fmt.Sprintf("%s at %04d", name, max(frame.ip, 0)))
+	}
+	return stack
+}
@@ -0,0 +1,116 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+)
+
+func TestLimits(t *testing.T) {
+	loop := `fun (loop Int) -> Int : (loop x) -> (loop x) .
+	fun (start Int) -> Int : (start x) -> (loop x) .
+	(start 1)`
+	grow := `type [L]: N | C Int [L] .
+	fun (grow [L]) -> Int : (grow xs) -> (grow [C 1 xs]) .
+	(grow [N])`
+	tests := []struct {
+		input   string
+		options []Option
+		limit   Limit
+		max     int
+		stack   []string
+	}{
+		{loop, []Option{WithStepLimit(1000)}, StepLimit, 1000, []string{"loop", "loop"}},
+		{grow, []Option{WithAllocationLimit(50)}, AllocationLimit, 50, []string{"grow"}},
+		{grow, []Option{WithStepLimit(100), WithAllocationLimit(1000)}, StepLimit, 100, []string{"grow"}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := NewFVM(comp.Bytecode(), tt.options...)
+		err = machine.Run()
+		var limit *LimitError
+		if !errors.As(err, &limit) {
+			t.Fatalf("expected a limit error, got %v", err)
+		}
+		if limit.Limit != tt.limit || limit.Max != tt.max {
+			t.Errorf("expected %s of %d, got %s of %d", tt.limit, tt.max, limit.Limit, limit.Max)
+		}
+		if limit.Steps != machine.Steps() || limit.Steps == 0 {
+			t.Errorf("wrong amount of steps %d, executed %d", limit.Steps, machine.Steps())
+		}
+		if tt.limit == StepLimit && limit.Steps != tt.max {
+			t.Errorf("expected %d steps, got %d", tt.max, limit.Steps)
+		}
+		for i, name := range tt.stack {
+			if !strings.HasPrefix(limit.Stack[i], name+" at ") {
+				t.Errorf("expected %s in frame %d of %v", name, i, limit.Stack)
+			}
+		}
+		if !strings.HasPrefix(limit.Stack[len(limit.Stack)-1], "main at ") {
+			t.Errorf("expected the main frame last in %v", limit.Stack)
+		}
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	comp := compiler.NewCompiler()
+	err := comp.Compile(parse(`type [L]: N | C Int [L] .
+	fun (s [L]) -> Int : (s [C x xs]) -> (+ x (s xs)) | (s [N]) -> 0 .
+	(s [C 1 [C 2 [N]]])`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := NewFVM(comp.Bytecode(), WithStepLimit(1000), WithAllocationLimit(3))
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if machine.StackTop().String() != "3" {
+		t.Errorf("expected 3, got %s", machine.StackTop())
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	comp := compiler.NewCompiler()
+	// exponential recursion, as deep recursion would overflow the stack
+	n := strings.Repeat("[S ", 40) + "[Z]" + strings.Repeat("]", 40)
+	err := comp.Compile(parse(`(print "before")
+	type [N]: Z | S [N] .
+	fun (loop [N]) -> Int : (loop [S n]) -> (+ (loop n) (loop n)) | (loop [Z]) -> 1 .
+	(loop ` + n + `)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var out bytes.Buffer
+	machine := NewFVM(comp.Bytecode(), WithOutput(&out))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = machine.RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	var cancelled *CancelError
+	if !errors.As(err, &cancelled) || !strings.HasPrefix(cancelled.Stack[0], "loop at ") {
+		t.Errorf("expected the location in loop, got %v", err)
+	}
+	if out.String() != "before\n" {
+		t.Errorf("expected the output before cancelling, got %q", out.String())
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = NewFVM(comp.Bytecode(), WithOutput(&out)).RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
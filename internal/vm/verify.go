@@ -0,0 +1,175 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/code"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+)
+
+// Verify checks that bytecode is well-formed before it is run: every
+// instruction is complete and known, operands refer to existing constants of
+// the right kind and to existing variables, and jumps land on instructions.
+// The FVM assumes this of its input, so bytecode that was not produced by
+// the compiler, such as a file read with compiler.ReadFromFile, should be
+// verified first.
+func Verify(bytecode *compiler.Bytecode) error {
+	for i, constant := range bytecode.Constants {
+		err := verifyConstant(constant)
+		if err != nil {
+			return fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+	err := verifyInstructions(bytecode.Instructions, 0, bytecode)
+	if err != nil {
+		return fmt.Errorf("main: %w", err)
+	}
+	for _, test := range bytecode.Tests {
+		err := verifyInstructions(test.Instructions, 0, bytecode)
+		if err != nil {
+			return fmt.Errorf("test %q: %w", test.Name, err)
+		}
+	}
+	for i, constant := range bytecode.Constants {
+		function, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		err := verifyInstructions(function.Instructions, function.Locals, bytecode)
+		if err != nil {
+			return fmt.Errorf("function %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func verifyConstant(constant object.Object) error {
+	switch constant := constant.(type) {
+	case nil:
+		return fmt.Errorf("missing value")
+	case *object.BigInteger:
+		if constant.Value == nil {
+			return fmt.Errorf("missing value")
+		}
+	case *object.Constructor:
+		if constant.Arity < 0 {
+			return fmt.Errorf("negative arity of %s", constant.Name)
+		}
+		if len(constant.Fields) != 0 && int64(len(constant.Fields)) != constant.Arity {
+			return fmt.Errorf("%s has %d fields, expected %d", constant.Name, len(constant.Fields), constant.Arity)
+		}
+	case *object.CompiledFunction:
+		if constant.Locals < 0 {
+			return fmt.Errorf("negative amount of locals")
+		}
+		if constant.Arity < 0 {
+			return fmt.Errorf("negative arity of %s", constant.Name)
+		}
+	case *object.Instance:
+		if constant.Constructor == nil {
+			return fmt.Errorf("instance without constructor")
+		}
+		err := verifyConstant(constant.Constructor)
+		if err != nil {
+			return err
+		}
+		if int64(len(constant.Args)) != constant.Constructor.Arity {
+			return fmt.Errorf("instance of %s has %d arguments, expected %d",
+				constant.Constructor.Name, len(constant.Args), constant.Constructor.Arity)
+		}
+		for _, arg := range constant.Args {
+			if _, ok := arg.(*object.CompiledFunction); ok {
+				return fmt.Errorf("function as an argument of %s", constant.Constructor.Name)
+			}
+			err := verifyConstant(arg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func verifyInstructions(ins code.Instructions, locals int, bytecode *compiler.Bytecode) error {
+	constants := bytecode.Constants
+	starts := make(map[int]bool)
+	jumps := [][2]int{} // instruction and its jump target
+	for i := 0; i < len(ins); {
+		start := i
+		starts[start] = true
+		wide := code.OpCode(ins[i]) == code.OpWide
+		if wide {
+			i++
+			if i == len(ins) || code.OpCode(ins[i]) == code.OpWide {
+				return fmt.Errorf("%04d: OpWide is not followed by an instruction", start)
+			}
+		}
+		op := code.OpCode(ins[i])
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return fmt.Errorf("%04d: %w", start, err)
+		}
+		if wide {
+			def = def.Wide()
+		}
+		length := 0
+		for _, w := range def.OperandWidths {
+			length += w
+		}
+		if i+1+length > len(ins) {
+			return fmt.Errorf("%04d: %s is truncated", start, def.Name)
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		i += 1 + read
+
+		switch op {
+		case code.OpConstant:
+			if operands[0] >= len(constants) {
+				return fmt.Errorf("%04d: no constant %d", start, operands[0])
+			}
+		case code.OpConstruct, code.OpMatchConstructor:
+			if operands[0] >= len(constants) {
+				return fmt.Errorf("%04d: no constant %d", start, operands[0])
+			}
+			constructor, ok := constants[operands[0]].(*object.Constructor)
+			if !ok {
+				return fmt.Errorf("%04d: constant %d is not a constructor", start, operands[0])
+			}
+			if op == code.OpConstruct && int64(operands[1]) != constructor.Arity {
+				return fmt.Errorf("%04d: %s takes %d arguments, got %d", start, constructor.Name, constructor.Arity, operands[1])
+			}
+		case code.OpMatchConstant:
+			if operands[0] >= len(constants) {
+				return fmt.Errorf("%04d: no constant %d", start, operands[0])
+			}
+			if _, ok := constants[operands[0]].(object.Comparable); !ok {
+				return fmt.Errorf("%04d: constant %d cannot be matched", start, operands[0])
+			}
+		case code.OpField:
+			if operands[0] >= len(constants) {
+				return fmt.Errorf("%04d: no constant %d", start, operands[0])
+			}
+			if _, ok := constants[operands[0]].(*object.String); !ok {
+				return fmt.Errorf("%04d: constant %d is not a field name", start, operands[0])
+			}
+		case code.OpVariable, code.OpBindVariable:
+			if operands[0] >= locals {
+				return fmt.Errorf("%04d: no variable %d", start, operands[0])
+			}
+		case code.OpCallNative:
+			if operands[0] >= len(bytecode.Natives) {
+				return fmt.Errorf("%04d: no native function %d", start, operands[0])
+			}
+		}
+		if op == code.OpMatchConstructor || op == code.OpMatchConstant || op == code.OpMatchTuple {
+			jumps = append(jumps, [2]int{start, operands[1]})
+		}
+	}
+	for _, jump := range jumps {
+		if jump[1] != len(ins) && !starts[jump[1]] {
+			return fmt.Errorf("%04d: jump to %d is not an instruction", jump[0], jump[1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emrzvv/fl-compiler/internal/compiler"
+	"github.com/emrzvv/fl-compiler/internal/compiler/code"
+	"github.com/emrzvv/fl-compiler/internal/types/object"
+)
+
+func TestVerifyCompiled(t *testing.T) {
+	inputs := []string{
+		`(concat "a" 'b' (intToString (strlen "héllo")))`,
+		`type [List x]: Cons x [List x] | Nil .
+		fun (len [List x]) -> Int :
+			(len [Cons x xs]) -> (+ 1 (len xs)) |
+			(len [Nil]) -> 0 .
+		(len [Cons 1 [Cons 2 [Nil]]])`,
+		sumOf(70000),
+	}
+
+	for _, input := range inputs {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = Verify(comp.Bytecode())
+		if err != nil {
+			t.Errorf("compiled bytecode does not verify: %s", err)
+		}
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	concat := func(ins ...[]byte) code.Instructions {
+		out := code.Instructions{}
+		for _, i := range ins {
+			out = append(out, i...)
+		}
+		return out
+	}
+	cons := &object.Constructor{Name: "Cons", Arity: 2, Supertype: "List"}
+	tests := []struct {
+		bytecode *compiler.Bytecode
+		contains string
+	}{
+		{
+			&compiler.Bytecode{Instructions: code.Instructions{0xfe}},
+			"opcode 254 undefined",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpConstant, 1)[:2]},
+			"OpConstant is truncated",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Instructions{byte(code.OpWide)}},
+			"OpWide is not followed",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpConstant, 1), Constants: []object.Object{cons}},
+			"no constant 1",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: code.Make(code.OpConstruct, 0, 0),
+				Constants:    []object.Object{&object.Integer{Value: 1}},
+			},
+			"constant 0 is not a constructor",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: code.Make(code.OpConstruct, 0, 0),
+				Constants:    []object.Object{cons},
+			},
+			"0000: Cons takes 2 arguments, got 0",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpVariable, 0)},
+			"no variable 0",
+		},
+		{
+			&compiler.Bytecode{
+				Constants: []object.Object{&object.CompiledFunction{
+					Instructions: concat(
+						code.Make(code.OpMatchConstructor, 1, 2),
+						code.Make(code.OpMatchFailed),
+					),
+				}, cons},
+			},
+			"function 0: 0000: jump to 2 is not an instruction",
+		},
+		{
+			&compiler.Bytecode{Constants: []object.Object{
+				&object.Instance{Constructor: cons, Args: []object.Object{&object.Integer{Value: 1}}},
+			}},
+			"instance of Cons has 1 arguments, expected 2",
+		},
+		{
+			&compiler.Bytecode{Constants: []object.Object{&object.BigInteger{}}},
+			"constant 0: missing value",
+		},
+	}
+
+	for _, tt := range tests {
+		err := Verify(tt.bytecode)
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("expected error containing %q, got %v", tt.contains, err)
+		}
+	}
+}
+
+func TestRuntimeErrorsInsteadOfPanics(t *testing.T) {
+	// a full stack and a constructor without arguments to push on it
+	full := code.Instructions{}
+	for i := 0; i < StackSize; i++ {
+		full = append(full, code.Make(code.OpConstant, 0)...)
+	}
+	full = append(full, code.Make(code.OpConstruct, 1, 0)...)
+	tests := []struct {
+		bytecode *compiler.Bytecode
+		contains string
+	}{
+		{&compiler.Bytecode{Instructions: code.Make(code.OpPrint)}, "stack underflow"},
+		{&compiler.Bytecode{Instructions: code.Make(code.OpStrCmp)}, "stack underflow"},
+		{&compiler.Bytecode{Instructions: code.Make(code.OpExpandArgs)}, "stack underflow"},
+		{&compiler.Bytecode{Instructions: code.Make(code.OpReturnValue)}, "not in a function"},
+		{
+			&compiler.Bytecode{
+				Instructions: append(code.Make(code.OpConstant, 0), code.Make(code.OpCall, 0)...),
+				Constants: []object.Object{&object.CompiledFunction{
+					Instructions: code.Make(code.OpVariable, 0),
+					Locals:       1,
+				}},
+			},
+			"variable 0 is not bound",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: full,
+				Constants: []object.Object{
+					&object.Integer{Value: 1},
+					&object.Constructor{Name: "Nil", Supertype: "List"},
+				},
+			},
+			"stack overflow",
+		},
+	}
+
+	for _, tt := range tests {
+		err := Verify(tt.bytecode)
+		if err != nil {
+			t.Fatalf("verify error: %s", err)
+		}
+		err = NewFVM(tt.bytecode).Run()
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("expected error containing %q, got %v", tt.contains, err)
+		}
+	}
+}
+
+// TestUnverifiedBytecode checks that the FVM reports errors on bytecode that
+// Verify rejects, for callers that run it without verifying.
+func TestUnverifiedBytecode(t *testing.T) {
+	point := &object.Constructor{Name: "Point", Arity: 2, Supertype: "Point", Fields: []string{"x", "y"}}
+	tests := []struct {
+		bytecode *compiler.Bytecode
+		contains string
+	}{
+		{
+			&compiler.Bytecode{
+				Instructions: append(code.Make(code.OpConstruct, 0, 0), code.Make(code.OpField, 1)...),
+				Constants:    []object.Object{point, &object.String{Value: "y"}},
+			},
+			"error when constructing Point: takes 2 arguments, got 0",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: append(code.Make(code.OpConstant, 0), code.Make(code.OpField, 1)...),
+				Constants: []object.Object{
+					&object.Instance{Constructor: point, Args: []object.Object{&object.Integer{Value: 1}}},
+					&object.String{Value: "y"},
+				},
+			},
+			"error when accessing field y: Point has 1 arguments",
+		},
+	}
+
+	for _, tt := range tests {
+		if Verify(tt.bytecode) == nil {
+			t.Fatalf("expected the bytecode not to verify")
+		}
+		err := NewFVM(tt.bytecode).Run()
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("expected error containing %q, got %v", tt.contains, err)
+		}
+	}
+}